@@ -0,0 +1,44 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package types
+
+import "time"
+
+// HeaderRequestID is the header to propagate the request ID. The server
+// generates one if the request does not have it.
+const HeaderRequestID = "X-Request-Id"
+
+const (
+	AuditOutcomeSuccess = "success"
+	// AuditOutcomeFailure is the outcome of the rejected requests,
+	// e.g. invalid parameters or denied SSH authentication.
+	AuditOutcomeFailure = "failure"
+	AuditOutcomeError   = "error"
+)
+
+type AuditLog struct {
+	ID            int64     `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	RequestID     string    `json:"request_id"`
+	Actor         string    `json:"actor"`
+	Action        string    `json:"action" example:"environment.create"`
+	TargetType    string    `json:"target_type" example:"environment"`
+	Target        string    `json:"target" example:"pytorch-example"`
+	Outcome       string    `json:"outcome" example:"success"`
+	Message       string    `json:"message,omitempty"`
+	SourceAddress string    `json:"source_address"`
+}
+
+type AuditLogListRequest struct {
+	Actor  string `form:"actor"`
+	Action string `form:"action"`
+	// Before is the ID to list the audit logs before, used for pagination.
+	Before int64 `form:"before"`
+	Limit  int32 `form:"limit"`
+}
+
+type AuditLogListResponse struct {
+	Items []AuditLog `json:"items"`
+}
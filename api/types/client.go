@@ -0,0 +1,45 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package types
+
+import (
+	"bufio"
+	"net"
+)
+
+const (
+	// MediaTypeEventStream is the content type of the server-sent events.
+	MediaTypeEventStream = "text/event-stream"
+	// MediaTypeNDJSON is the content type of the newline-delimited JSON
+	// streams.
+	MediaTypeNDJSON = "application/x-ndjson"
+	// MediaTypeRawStream is the content type of the hijacked connections.
+	MediaTypeRawStream = "application/vnd.envd.raw-stream"
+)
+
+// HijackedResponse holds connection information for a hijacked request.
+type HijackedResponse struct {
+	Conn   net.Conn
+	Reader *bufio.Reader
+}
+
+// Close closes the hijacked connection and reader.
+func (h *HijackedResponse) Close() {
+	h.Conn.Close()
+}
+
+// CloseWriter is an interface that implements structs
+// that close input streams to prevent from writing.
+type CloseWriter interface {
+	CloseWrite() error
+}
+
+// CloseWrite closes a readWriter for writing.
+func (h *HijackedResponse) CloseWrite() error {
+	if conn, ok := h.Conn.(CloseWriter); ok {
+		return conn.CloseWrite()
+	}
+	return nil
+}
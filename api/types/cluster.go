@@ -0,0 +1,17 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package types
+
+// Cluster is one of the kubernetes clusters the environments are placed
+// in. The labels describe the capacity, e.g. the GPUs, and are matched
+// by the cluster selector of the environment.
+type Cluster struct {
+	Name   string            `json:"name" example:"gpu-a100"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type ClusterListResponse struct {
+	Items []Cluster `json:"items"`
+}
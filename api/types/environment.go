@@ -22,6 +22,13 @@ type EnvironmentSpec struct {
 	Env   []string          `json:"env,omitempty"`
 	Cmd   []string          `json:"cmd,omitempty"`
 	Ports []EnvironmentPort `json:"ports,omitempty"`
+	// SSHPolicy is the name of the server SSH policy which restricts the
+	// sessions, e.g. forwarding, in the environment.
+	SSHPolicy string `json:"ssh_policy,omitempty"`
+	// Cluster is the name of the cluster of the environment. The server
+	// chooses one of the clusters matching the selector if it is empty.
+	Cluster         string            `json:"cluster,omitempty"`
+	ClusterSelector map[string]string `json:"cluster_selector,omitempty"`
 	// TODO(gaocegege): Add volume specific spec.
 }
 
@@ -74,3 +81,28 @@ type EnvironmentGetRequest struct {
 type EnvironmentGetResponse struct {
 	Environment `json:",inline"`
 }
+
+type EnvironmentLogsRequest struct {
+	Name string `uri:"name" example:"pytorch-example"`
+	// Follow streams the logs until the environment stops.
+	Follow bool `form:"follow"`
+	// Tail is the number of the lines from the end, all the logs are
+	// returned if it is not positive.
+	Tail int64 `form:"tail"`
+}
+
+type EnvironmentExecRequest struct {
+	Name string `uri:"name" json:"-" example:"pytorch-example"`
+	// Cmd runs without the stdin and the TTY.
+	Cmd []string `json:"cmd" example:"nvidia-smi"`
+}
+
+type EnvironmentExecResponse struct {
+	ExitCode int    `json:"exit_code"`
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	// StdoutTruncated is true if the stdout is longer than the server
+	// keeps, and only the beginning of it is returned.
+	StdoutTruncated bool `json:"stdout_truncated,omitempty"`
+	StderrTruncated bool `json:"stderr_truncated,omitempty"`
+}
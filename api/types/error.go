@@ -0,0 +1,18 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package types
+
+// ErrorResponse is the body of all the failed API responses.
+type ErrorResponse struct {
+	// Code is the class of the error, see the Code* constants in errdefs.
+	Code    string `json:"code" example:"not_found"`
+	Message string `json:"message" example:"environment pytorch-example is not found"`
+	// Details are the optional key-value pairs to help debugging,
+	// e.g. the reason returned by Kubernetes.
+	Details map[string]string `json:"details,omitempty"`
+	// RequestID is the ID of the failed request, same as the
+	// X-Request-Id header.
+	RequestID string `json:"request_id,omitempty"`
+}
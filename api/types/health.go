@@ -0,0 +1,33 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package types
+
+const (
+	HealthStatusOK     = "ok"
+	HealthStatusFailed = "failed"
+)
+
+type HealthCheck struct {
+	Name    string `json:"name" example:"postgres"`
+	Status  string `json:"status" example:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+type HealthResponse struct {
+	Status string        `json:"status" example:"ok"`
+	Checks []HealthCheck `json:"checks"`
+	// Leader is the leader election status of the replica.
+	Leader *LeaderStatus `json:"leader,omitempty"`
+}
+
+type LeaderStatus struct {
+	// Enabled is false if the replica runs the background tasks
+	// without the election.
+	Enabled  bool   `json:"enabled"`
+	IsLeader bool   `json:"is_leader"`
+	Identity string `json:"identity" example:"envd-server-6d4b9c7f5-x2x7k_5f0c"`
+	// Leader is the identity of the current leader.
+	Leader string `json:"leader,omitempty"`
+}
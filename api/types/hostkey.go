@@ -0,0 +1,60 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package types
+
+const (
+	HostKeySourceFile   = "file"
+	HostKeySourceDir    = "dir"
+	HostKeySourceSecret = "secret"
+)
+
+// HostKey is a host key of the environments accepted by containerssh.
+type HostKey struct {
+	// Name is the file name, or the key in the secret.
+	Name        string `json:"name" example:"hostkey"`
+	Fingerprint string `json:"fingerprint" example:"SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8"`
+	// Source is file, dir or secret. Only the keys in the secret can be
+	// managed by the admin API.
+	Source string `json:"source" example:"secret"`
+	// Active is set on the key of the new environments.
+	Active bool `json:"active"`
+	// Environments is the number of the environments created with the key.
+	Environments int `json:"environments"`
+}
+
+type HostKeyListResponse struct {
+	Items []HostKey `json:"items"`
+	// UnknownEnvironments were created before the host keys are recorded,
+	// and are rolled as the ones with inactive keys.
+	UnknownEnvironments int `json:"unknown_environments"`
+}
+
+type HostKeyCreateResponse struct {
+	HostKey `json:",inline"`
+}
+
+type HostKeyActivateRequest struct {
+	Name string `uri:"name" example:"hostkey-1665820800"`
+}
+
+type HostKeyRemoveRequest struct {
+	Name string `uri:"name" example:"hostkey-1665820800"`
+	// Force removes the key even if it is used by the environments.
+	Force bool `form:"force"`
+}
+
+type HostKeyRollRequest struct {
+	// Limit is the maximum number of the environments to roll.
+	Limit int `form:"limit"`
+}
+
+type HostKeyRollResponse struct {
+	// Rolled are the environments recreated with the active key.
+	Rolled []string `json:"rolled"`
+	// Failed are the errors of the environments failed to roll.
+	Failed map[string]string `json:"failed,omitempty"`
+	// Remaining is the number of the environments left to roll.
+	Remaining int `json:"remaining"`
+}
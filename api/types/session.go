@@ -0,0 +1,64 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package types
+
+import "time"
+
+const (
+	// SSHSessionEventConnect is sent when the connection is authenticated.
+	// The session is recorded by the config webhook too.
+	SSHSessionEventConnect = "connect"
+	// SSHSessionEventActivity is sent periodically with the bytes
+	// transferred so far.
+	SSHSessionEventActivity   = "activity"
+	SSHSessionEventDisconnect = "disconnect"
+)
+
+// SSHSession is an SSH connection to an environment, proxied by
+// containerssh.
+type SSHSession struct {
+	ID            int64  `json:"id"`
+	ConnectionID  string `json:"connection_id"`
+	Owner         string `json:"owner"`
+	Environment   string `json:"environment" example:"pytorch-example"`
+	SourceAddress string `json:"source_address"`
+	// Active is true until the connection is closed.
+	Active         bool       `json:"active"`
+	StartedAt      time.Time  `json:"started_at"`
+	LastActivityAt time.Time  `json:"last_activity_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	// BytesIn and BytesOut are the bytes from and to the client.
+	BytesIn  int64 `json:"bytes_in"`
+	BytesOut int64 `json:"bytes_out"`
+}
+
+// SSHSessionEvent is sent by containerssh, or a hook next to it, to track
+// the sessions.
+type SSHSessionEvent struct {
+	Type         string `json:"type" example:"activity"`
+	ConnectionID string `json:"connectionId"`
+	// Username and RemoteAddress are required by the connect event.
+	Username      string `json:"username,omitempty"`
+	RemoteAddress string `json:"remoteAddress,omitempty"`
+	// BytesIn and BytesOut are the total bytes of the connection.
+	BytesIn  int64 `json:"bytesIn,omitempty"`
+	BytesOut int64 `json:"bytesOut,omitempty"`
+}
+
+type SSHSessionListRequest struct {
+	// Owner is only used by the admin server, the users list their own
+	// sessions.
+	Owner       string `form:"owner"`
+	Environment string `form:"environment"`
+	// Active lists the connected sessions only.
+	Active bool `form:"active"`
+	// Before is the ID to list the sessions before, used for pagination.
+	Before int64 `form:"before"`
+	Limit  int32 `form:"limit"`
+}
+
+type SSHSessionListResponse struct {
+	Items []SSHSession `json:"items"`
+}
@@ -0,0 +1,34 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package types
+
+const (
+	// APIVersion is the highest API version supported by the server and
+	// the client in this module. It is the prefix of the API routes.
+	APIVersion = "v1"
+	// MinAPIVersion is the lowest API version supported by the server and
+	// the client in this module.
+	MinAPIVersion = "v1"
+
+	// HeaderAPIVersion is set in all the responses with the highest API
+	// version supported by the server.
+	HeaderAPIVersion = "Api-Version"
+	// HeaderMinAPIVersion is set in all the responses with the lowest API
+	// version supported by the server.
+	HeaderMinAPIVersion = "Min-Api-Version"
+)
+
+type VersionResponse struct {
+	// Version of the server build.
+	Version   string `json:"version" example:"v0.0.9"`
+	GitCommit string `json:"git_commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty" example:"2022-11-01T00:00:00Z"`
+	GoVersion string `json:"go_version,omitempty" example:"go1.19.3"`
+	Platform  string `json:"platform,omitempty" example:"linux/amd64"`
+	// APIVersion is the highest API version supported by the server.
+	APIVersion string `json:"api_version" example:"v1"`
+	// MinAPIVersion is the lowest API version supported by the server.
+	MinAPIVersion string `json:"min_api_version" example:"v1"`
+}
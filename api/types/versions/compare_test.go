@@ -0,0 +1,27 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package versions
+
+import "testing"
+
+func TestCompare(t *testing.T) {
+	tcs := []struct {
+		v1       string
+		v2       string
+		expected int
+	}{
+		{v1: "v1", v2: "v1", expected: 0},
+		{v1: "v1", v2: "1", expected: 0},
+		{v1: "v1", v2: "v1.0", expected: 0},
+		{v1: "v1", v2: "v2", expected: -1},
+		{v1: "v2", v2: "v1.9", expected: 1},
+		{v1: "v1.10", v2: "v1.9", expected: 1},
+	}
+	for _, tc := range tcs {
+		if got := compare(tc.v1, tc.v2); got != tc.expected {
+			t.Errorf("Expected compare(%s, %s) to be %d, got %d", tc.v1, tc.v2, tc.expected, got)
+		}
+	}
+}
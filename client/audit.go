@@ -0,0 +1,42 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+// AuditLogList lists the audit logs, newest first. The client must be
+// created with the address of the admin server.
+func (cli *Client) AuditLogList(ctx context.Context, req types.AuditLogListRequest) (types.AuditLogListResponse, error) {
+	query := url.Values{}
+	if req.Actor != "" {
+		query.Set("actor", req.Actor)
+	}
+	if req.Action != "" {
+		query.Set("action", req.Action)
+	}
+	if req.Before != 0 {
+		query.Set("before", strconv.FormatInt(req.Before, 10))
+	}
+	if req.Limit != 0 {
+		query.Set("limit", strconv.Itoa(int(req.Limit)))
+	}
+	resp, err := cli.getUnversioned(ctx, "/audit", query)
+	defer ensureReaderClosed(resp)
+
+	if err != nil {
+		return types.AuditLogListResponse{}, err
+	}
+
+	var response types.AuditLogListResponse
+	err = json.NewDecoder(resp.body).Decode(&response)
+	return response, err
+}
@@ -10,9 +10,12 @@ import (
 	"net/url"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/docker/go-connections/sockets"
 	"github.com/pkg/errors"
+
+	"github.com/tensorchord/envd-server/api/types"
 )
 
 // Refer to github.com/docker/docker/client
@@ -50,6 +53,15 @@ type Client struct {
 
 	// negotiated indicates that API version negotiation took place
 	negotiated bool
+
+	// negotiateLock is used to single-flight the version negotiation
+	// process, and guards version and negotiated against the concurrent
+	// requests.
+	negotiateLock sync.Mutex
+
+	// retryPolicy is used to retry the idempotent requests, they are
+	// sent once if it is nil.
+	retryPolicy *RetryPolicy
 }
 
 // NewClientWithOpts initializes a new API client with a default HTTPClient, and
@@ -73,7 +85,7 @@ func NewClientWithOpts(ops ...Opt) (*Client, error) {
 	}
 	c := &Client{
 		host:    DefaultEnvdServerHost,
-		version: "v1",
+		version: types.APIVersion,
 		client:  client,
 		proto:   defaultProto,
 		addr:    defaultAddr,
@@ -183,8 +195,8 @@ func (cli *Client) Close() error {
 // It appends the query parameters to the path if they are not empty.
 func (cli *Client) getAPIPath(ctx context.Context, p string, query url.Values) string {
 	var apiPath string
-	if cli.version != "" {
-		v := strings.TrimPrefix(cli.version, "v")
+	if version := cli.checkVersion(ctx); version != "" {
+		v := strings.TrimPrefix(version, "v")
 		apiPath = path.Join(cli.basePath, "/v"+v, p)
 	} else {
 		apiPath = path.Join(cli.basePath, p)
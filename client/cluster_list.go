@@ -0,0 +1,28 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+// ClusterList lists the clusters the environments can be placed in.
+func (cli *Client) ClusterList(ctx context.Context, owner string) (types.ClusterListResponse, error) {
+	url := fmt.Sprintf("/users/%s/clusters", owner)
+	resp, err := cli.get(ctx, url, nil, nil)
+	defer ensureReaderClosed(resp)
+
+	if err != nil {
+		return types.ClusterListResponse{}, wrapResponseError(err, resp, "owner", owner)
+	}
+
+	var response types.ClusterListResponse
+	err = json.NewDecoder(resp.body).Decode(&response)
+	return response, err
+}
@@ -67,4 +67,9 @@ const (
 	// attacks unless custom verification is used. This should be used only for
 	// testing or in combination with VerifyConnection or VerifyPeerCertificate.
 	EnvTLSVerify = "ENVD_SERVER_TLS_VERIFY"
+
+	// EnvOverrideAPIVersion is the name of the environment variable that can
+	// be used to override the API version to use. Value should be
+	// formatted as MAJOR, for example, "v1".
+	EnvOverrideAPIVersion = "ENVD_SERVER_API_VERSION"
 )
@@ -0,0 +1,30 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+// EnvironmentExec runs the command in the environment, and returns the
+// output after it exits.
+func (cli *Client) EnvironmentExec(ctx context.Context, owner string,
+	req types.EnvironmentExecRequest) (types.EnvironmentExecResponse, error) {
+	urlString := fmt.Sprintf("/users/%s/environments/%s/exec", owner, req.Name)
+	resp, err := cli.post(ctx, urlString, nil, req, nil)
+	defer ensureReaderClosed(resp)
+
+	if err != nil {
+		return types.EnvironmentExecResponse{}, wrapResponseError(err, resp, "environment", req.Name)
+	}
+
+	var response types.EnvironmentExecResponse
+	err = json.NewDecoder(resp.body).Decode(&response)
+	return response, err
+}
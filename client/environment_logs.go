@@ -0,0 +1,35 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+// EnvironmentLogs returns the logs of the environment. The followed logs
+// are streamed until the context is done, the caller must close them.
+func (cli *Client) EnvironmentLogs(ctx context.Context, owner string,
+	req types.EnvironmentLogsRequest) (io.ReadCloser, error) {
+	query := url.Values{}
+	if req.Follow {
+		query.Set("follow", "true")
+	}
+	if req.Tail > 0 {
+		query.Set("tail", strconv.FormatInt(req.Tail, 10))
+	}
+	urlString := fmt.Sprintf("/users/%s/environments/%s/logs", owner, req.Name)
+	resp, err := cli.get(ctx, urlString, query, nil)
+	if err != nil {
+		ensureReaderClosed(resp)
+		return nil, wrapResponseError(err, resp, "environment", req.Name)
+	}
+	return resp.body, nil
+}
@@ -36,6 +36,35 @@ func ErrorConnectionFailed(host string) error {
 	return errConnectionFailed{host: host}
 }
 
+// errWithRequestID annotates the error with the ID of the failed request.
+type errWithRequestID struct {
+	error
+	requestID string
+}
+
+func (e errWithRequestID) Error() string {
+	return fmt.Sprintf("%s (request id: %s)", e.error.Error(), e.requestID)
+}
+
+func (e errWithRequestID) Cause() error {
+	return e.error
+}
+
+func (e errWithRequestID) Unwrap() error {
+	return e.error
+}
+
+// RequestIDFromError returns the ID of the failed request, which can be used
+// to find the server logs and audit logs. It is empty if the server does not
+// return one.
+func RequestIDFromError(err error) string {
+	var e errWithRequestID
+	if errors.As(err, &e) {
+		return e.requestID
+	}
+	return ""
+}
+
 // Deprecated: use the errdefs.NotFound() interface instead. Kept for backward compatibility
 type notFound interface {
 	error
@@ -0,0 +1,201 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+// Hijack sends the request with the Upgrade header, and returns the raw
+// connection after the server switches the protocol. It is used for the
+// bidirectional streams, e.g. the stdin and stdout of the exec sessions.
+func (cli *Client) Hijack(ctx context.Context, method, path string, query url.Values, body interface{}) (types.HijackedResponse, error) {
+	bodyEncoded, err := encodeData(body)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+	var headers headers
+	if body != nil {
+		headers = map[string][]string{"Content-Type": {"application/json"}}
+	}
+	req, err := cli.buildRequest(method, cli.getAPIPath(ctx, path, query), bodyEncoded, headers)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+	addContextHeaders(ctx, req.Header)
+
+	conn, reader, err := cli.setupHijackConn(ctx, req, "tcp")
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+	return types.HijackedResponse{Conn: conn, Reader: reader}, nil
+}
+
+func (cli *Client) setupHijackConn(ctx context.Context, req *http.Request, proto string) (net.Conn, *bufio.Reader, error) {
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", proto)
+
+	conn, err := cli.Dialer()(ctx)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "cannot connect to the envd server")
+	}
+	// When we set up a TCP connection for hijack, there could be long periods
+	// of inactivity (a long running command with no output) that in certain
+	// network setups may cause ECONNTIMEOUT, leaving the client in an unknown
+	// state. Setting TCP KeepAlive on the socket connection will prohibit
+	// ECONNTIMEOUT unless the socket connection truly is broken
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetKeepAlive(true)
+		_ = tcpConn.SetKeepAlivePeriod(30 * time.Second)
+	}
+
+	// The handshake is cancelled with the context, the stream is not.
+	stop := closeOnDone(ctx, conn)
+	reader, err := cli.handshakeHijack(conn, req)
+	if stop() {
+		conn.Close()
+		return nil, nil, errdefs.FromContext(ctx)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, reader, nil
+}
+
+func (cli *Client) handshakeHijack(conn net.Conn, req *http.Request) (*bufio.Reader, error) {
+	if err := req.Write(conn); err != nil {
+		return nil, errors.Wrap(err, "failed to send the hijack request")
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read the hijack response")
+	}
+	if resp.StatusCode == http.StatusSwitchingProtocols {
+		return reader, nil
+	}
+	defer resp.Body.Close()
+	serverResp := serverResponse{
+		body:       resp.Body,
+		header:     resp.Header,
+		statusCode: resp.StatusCode,
+		reqURL:     req.URL,
+	}
+	err = cli.checkResponseErr(serverResp)
+	if err == nil {
+		err = errors.Errorf("the server did not upgrade the connection, got %s", resp.Status)
+	}
+	return nil, errdefs.FromStatusCode(err, resp.StatusCode)
+}
+
+// closeOnDone closes the connection if the context is done before stop is
+// called. stop returns true if the connection is closed.
+func closeOnDone(ctx context.Context, conn net.Conn) (stop func() bool) {
+	done := make(chan struct{})
+	closed := make(chan bool, 1)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+			closed <- true
+		case <-done:
+			closed <- false
+		}
+	}()
+	return func() bool {
+		close(done)
+		return <-closed
+	}
+}
+
+// Dialer returns a dialer for a raw stream connection to the server, with
+// the dial and TLS options of the client.
+func (cli *Client) Dialer() func(context.Context) (net.Conn, error) {
+	return func(ctx context.Context) (net.Conn, error) {
+		network := "tcp"
+		if cli.proto == "unix" {
+			network = "unix"
+		}
+		var conn net.Conn
+		var err error
+		if transport, ok := cli.client.Transport.(*http.Transport); ok && transport.DialContext != nil {
+			conn, err = transport.DialContext(ctx, network, cli.addr)
+		} else {
+			conn, err = (&net.Dialer{}).DialContext(ctx, network, cli.addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig := resolveTLSConfig(cli.client.Transport)
+		if tlsConfig == nil || cli.scheme != "https" {
+			return conn, nil
+		}
+		tlsConfig = tlsConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			if host, _, err := net.SplitHostPort(cli.addr); err == nil {
+				tlsConfig.ServerName = host
+			}
+		}
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+}
+
+// HoldHijackedConnection copies the input to the hijacked connection and
+// the output of the connection to the output, until the output ends or the
+// context is done. The write side of the connection is closed when the
+// input ends, to signal the server.
+func HoldHijackedConnection(ctx context.Context, resp types.HijackedResponse, input io.Reader, output io.Writer) error {
+	outputDone := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(output, resp.Reader)
+		outputDone <- err
+	}()
+
+	inputDone := make(chan error, 1)
+	if input != nil {
+		go func() {
+			_, err := io.Copy(resp.Conn, input)
+			if closeErr := resp.CloseWrite(); err == nil {
+				err = closeErr
+			}
+			inputDone <- err
+		}()
+	}
+
+	for {
+		select {
+		case err := <-outputDone:
+			return err
+		case err := <-inputDone:
+			if err != nil {
+				return errors.Wrap(err, "failed to send the input")
+			}
+			// Wait for the rest of the output.
+			inputDone = nil
+		case <-ctx.Done():
+			resp.Close()
+			return errdefs.FromContext(ctx)
+		}
+	}
+}
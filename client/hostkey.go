@@ -0,0 +1,84 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+// The host key methods must be called by the client created with the
+// address of the admin server.
+
+// HostKeyList lists the host keys accepted by containerssh.
+func (cli *Client) HostKeyList(ctx context.Context) (types.HostKeyListResponse, error) {
+	resp, err := cli.getUnversioned(ctx, "/hostkeys", nil)
+	defer ensureReaderClosed(resp)
+
+	if err != nil {
+		return types.HostKeyListResponse{}, err
+	}
+
+	var response types.HostKeyListResponse
+	err = json.NewDecoder(resp.body).Decode(&response)
+	return response, err
+}
+
+// HostKeyCreate generates a host key, which is accepted but not used by
+// the new environments until it is activated.
+func (cli *Client) HostKeyCreate(ctx context.Context) (types.HostKeyCreateResponse, error) {
+	resp, err := cli.sendUnversioned(ctx, http.MethodPost, "/hostkeys", nil)
+	defer ensureReaderClosed(resp)
+
+	if err != nil {
+		return types.HostKeyCreateResponse{}, err
+	}
+
+	var response types.HostKeyCreateResponse
+	err = json.NewDecoder(resp.body).Decode(&response)
+	return response, err
+}
+
+// HostKeyActivate uses the host key in the new environments.
+func (cli *Client) HostKeyActivate(ctx context.Context, name string) error {
+	resp, err := cli.sendUnversioned(ctx, http.MethodPost, "/hostkeys/"+name+"/activate", nil)
+	defer ensureReaderClosed(resp)
+	return wrapResponseError(err, resp, "host key", name)
+}
+
+// HostKeyRemove retires the host key.
+func (cli *Client) HostKeyRemove(ctx context.Context, name string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+	resp, err := cli.sendUnversioned(ctx, http.MethodDelete, "/hostkeys/"+name, query)
+	defer ensureReaderClosed(resp)
+	return wrapResponseError(err, resp, "host key", name)
+}
+
+// HostKeyRoll recreates at most limit environments which do not use the
+// active host key.
+func (cli *Client) HostKeyRoll(ctx context.Context, limit int) (types.HostKeyRollResponse, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	resp, err := cli.sendUnversioned(ctx, http.MethodPost, "/hostkeys/roll", query)
+	defer ensureReaderClosed(resp)
+
+	if err != nil {
+		return types.HostKeyRollResponse{}, err
+	}
+
+	var response types.HostKeyRollResponse
+	err = json.NewDecoder(resp.body).Decode(&response)
+	return response, err
+}
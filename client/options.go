@@ -31,14 +31,14 @@ type Opt func(*Client) error
 //
 // ENVD_SERVER_TLS_VERIFY (EnvTLSVerify) to enable or disable TLS verification (off by
 // default).
+//
+// ENVD_SERVER_API_VERSION (EnvOverrideAPIVersion) to set the version of the API to
+// use, leave empty for latest.
 func FromEnv(c *Client) error {
-	// TODO(gaocegege): Support:
-	// ENVD_SERVER_API_VERSION (EnvOverrideAPIVersion) to set the version of the API to
-	// use, leave empty for latest.
-	//
 	ops := []Opt{
 		WithTLSClientConfigFromEnv(),
 		WithHostFromEnv(),
+		WithVersionFromEnv(),
 	}
 	for _, op := range ops {
 		if err := op(c); err != nil {
@@ -192,3 +192,24 @@ func WithVersion(version string) Opt {
 		return nil
 	}
 }
+
+// WithVersionFromEnv overrides the client version with the version specified in
+// the ENVD_SERVER_API_VERSION (EnvOverrideAPIVersion) environment variable.
+// If ENVD_SERVER_API_VERSION is not set, or set to an empty value, the version
+// is not modified.
+func WithVersionFromEnv() Opt {
+	return func(c *Client) error {
+		return WithVersion(os.Getenv(EnvOverrideAPIVersion))(c)
+	}
+}
+
+// WithAPIVersionNegotiation enables automatic API version negotiation for the client.
+// With this option enabled, the client automatically negotiates the API version
+// to use when making requests. API version negotiation is performed on the first
+// request; subsequent requests will not re-negotiate.
+func WithAPIVersionNegotiation() Opt {
+	return func(c *Client) error {
+		c.negotiateVersion = true
+		return nil
+	}
+}
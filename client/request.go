@@ -16,11 +16,22 @@ import (
 	"os"
 	"strings"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/errdefs"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
 )
 
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of the context with the request ID, which is
+// sent in the X-Request-Id header of the requests made with the context.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
 // serverResponse is a wrapper for http API responses.
 type serverResponse struct {
 	body       io.ReadCloser
@@ -121,7 +132,9 @@ func (cli *Client) sendRequest(ctx context.Context, method, path string, query u
 		return serverResponse{}, err
 	}
 
-	resp, err := cli.doRequest(ctx, req)
+	addContextHeaders(ctx, req.Header)
+
+	resp, err := cli.doRequestWithRetry(ctx, req)
 	switch {
 	case errors.Is(err, context.Canceled):
 		return serverResponse{}, errdefs.Cancelled(err)
@@ -186,6 +199,14 @@ func (cli *Client) checkResponseErr(serverResp serverResponse) error {
 		return nil
 	}
 
+	requestID := serverResp.header.Get(types.HeaderRequestID)
+	wrap := func(err error) error {
+		if requestID == "" {
+			return err
+		}
+		return errWithRequestID{error: err, requestID: requestID}
+	}
+
 	var body []byte
 	var err error
 	if serverResp.body != nil {
@@ -199,25 +220,37 @@ func (cli *Client) checkResponseErr(serverResp serverResponse) error {
 			return err
 		}
 		if bodyR.N == 0 {
-			return fmt.Errorf("request returned %s with a message (> %d bytes) for API route and version %s, check if the server supports the requested API version", http.StatusText(serverResp.statusCode), bodyMax, serverResp.reqURL)
+			return wrap(fmt.Errorf("request returned %s with a message (> %d bytes) for API route and version %s, check if the server supports the requested API version", http.StatusText(serverResp.statusCode), bodyMax, serverResp.reqURL))
 		}
 	}
 	if len(body) == 0 {
-		return fmt.Errorf("request returned %s for API route and version %s, check if the server supports the requested API version", http.StatusText(serverResp.statusCode), serverResp.reqURL)
+		return wrap(fmt.Errorf("request returned %s for API route and version %s, check if the server supports the requested API version", http.StatusText(serverResp.statusCode), serverResp.reqURL))
 	}
 
-	var errorMessage string
-	if cli.version == "" {
-		var errorResponse types.ErrorResponse
-		if err := json.Unmarshal(body, &errorResponse); err != nil {
-			return errors.Wrap(err, "Error reading JSON")
+	// Decode the typed error body, and keep the raw body if the server
+	// does not respond with one (e.g. a proxy in front of it).
+	var errorResponse types.ErrorResponse
+	if err := json.Unmarshal(body, &errorResponse); err == nil &&
+		(errorResponse.Code != "" || errorResponse.Message != "") {
+		if requestID == "" {
+			requestID = errorResponse.RequestID
 		}
-		errorMessage = strings.TrimSpace(errorResponse.Message)
-	} else {
-		errorMessage = strings.TrimSpace(string(body))
+		err := errors.Wrap(errors.New(strings.TrimSpace(errorResponse.Message)),
+			"Error response from envd server")
+		return errdefs.FromCode(wrap(err), errorResponse.Code)
 	}
 
-	return errors.Wrap(errors.New(errorMessage), "Error response from daemon")
+	errorMessage := strings.TrimSpace(string(body))
+	return wrap(errors.Wrap(errors.New(errorMessage), "Error response from envd server"))
+}
+
+// addContextHeaders propagates the trace context and the request ID of the
+// caller to the server.
+func addContextHeaders(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok && id != "" {
+		header.Set(types.HeaderRequestID, id)
+	}
 }
 
 func (cli *Client) addHeaders(req *http.Request, headers headers) *http.Request {
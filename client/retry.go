@@ -0,0 +1,185 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy configures the retries of the idempotent requests which fail
+// with a connection error, 429 Too Many Requests or 503 Service Unavailable.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts int
+	// InitialBackoff is the time to wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum time to wait before a retry. The request
+	// is not retried if the server asks to retry after a longer time.
+	MaxBackoff time.Duration
+	// Multiplier is the factor to increase the backoff after each retry.
+	Multiplier float64
+	// Jitter randomizes the backoff by up to the fraction of it, to avoid
+	// the clients retrying at the same time.
+	Jitter float64
+}
+
+// DefaultRetryPolicy returns the policy which retries twice within a few
+// seconds.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 200 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+		Multiplier:     2,
+		Jitter:         0.2,
+	}
+}
+
+// WithRetryPolicy retries the idempotent requests with the policy. The
+// requests are sent once if the option is not set.
+func WithRetryPolicy(policy RetryPolicy) Opt {
+	return func(c *Client) error {
+		if policy.MaxAttempts < 1 {
+			return errors.Errorf("max attempts %d must be positive", policy.MaxAttempts)
+		}
+		if policy.Multiplier < 1 {
+			policy.Multiplier = 1
+		}
+		if policy.Jitter < 0 || policy.Jitter > 1 {
+			return errors.Errorf("jitter %v is not in [0, 1]", policy.Jitter)
+		}
+		c.retryPolicy = &policy
+		return nil
+	}
+}
+
+// backoff returns the time to wait before the retry after the attempt.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d -= d * p.Jitter * rand.Float64()
+	return time.Duration(d)
+}
+
+// retryDelay returns the time to wait before retrying the failed attempt,
+// or false if it should not be retried.
+func (p RetryPolicy) retryDelay(req *http.Request, resp serverResponse, err error, attempt int) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts || !isIdempotent(req.Method) ||
+		(req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return 0, false
+	}
+	if err != nil {
+		// Do not retry when the caller gives up.
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, false
+		}
+		if !isRetryableError(err) {
+			return 0, false
+		}
+		return p.backoff(attempt), true
+	}
+	if resp.statusCode != http.StatusTooManyRequests &&
+		resp.statusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	delay := p.backoff(attempt)
+	if after, ok := parseRetryAfter(resp.header.Get("Retry-After"), time.Now()); ok {
+		if p.MaxBackoff > 0 && after > p.MaxBackoff {
+			return 0, false
+		}
+		if after > delay {
+			delay = after
+		}
+	}
+	return delay, true
+}
+
+// isRetryableError returns true if the request failed to reach the server,
+// e.g. the connection is refused, reset or closed before the response.
+// The other errors, e.g. the invalid certificates, fail again in the
+// retries.
+func isRetryableError(err error) bool {
+	if IsErrConnectionFailed(err) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// *url.Error is a net.Error whatever it wraps.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// doRequestWithRetry sends the request, and retries it with the retry
+// policy of the client.
+func (cli *Client) doRequestWithRetry(ctx context.Context, req *http.Request) (serverResponse, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := cli.doRequest(ctx, req)
+		if cli.retryPolicy == nil {
+			return resp, err
+		}
+		delay, ok := cli.retryPolicy.retryDelay(req, resp, err, attempt)
+		if !ok {
+			return resp, err
+		}
+		ensureReaderClosed(resp)
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return serverResponse{statusCode: -1, reqURL: req.URL}, err
+			}
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return serverResponse{statusCode: -1, reqURL: req.URL}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut,
+		http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter parses the Retry-After header, which is either the
+// seconds to wait or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
@@ -0,0 +1,230 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+func testRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     2 * time.Second,
+		Multiplier:     2,
+	}
+}
+
+func newTestClient(t *testing.T, url string, opts ...Opt) *Client {
+	t.Helper()
+	opts = append([]Opt{WithHost("tcp://" + strings.TrimPrefix(url, "http://"))}, opts...)
+	cli, err := NewClientWithOpts(opts...)
+	if err != nil {
+		t.Fatalf("Expected no error creating the client, got %v", err)
+	}
+	return cli
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tcs := []struct {
+		// responses are the status codes of the attempts, 0 closes
+		// the connection without a response.
+		responses        []int
+		retryAfter       string
+		remove           bool
+		expectedAttempts int32
+		expectedErr      func(error) bool
+	}{
+		{
+			responses:        []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK},
+			expectedAttempts: 3,
+		},
+		{
+			responses:        []int{0, http.StatusOK},
+			expectedAttempts: 2,
+		},
+		{
+			responses:        []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+			expectedAttempts: 3,
+			expectedErr:      errdefs.IsUnavailable,
+		},
+		{
+			responses:        []int{http.StatusInternalServerError, http.StatusOK},
+			expectedAttempts: 1,
+			expectedErr:      errdefs.IsSystem,
+		},
+		{
+			// The server asks to retry later than the max backoff.
+			responses:        []int{http.StatusTooManyRequests, http.StatusOK},
+			retryAfter:       "60",
+			expectedAttempts: 1,
+			expectedErr:      errdefs.IsResourceExhausted,
+		},
+		{
+			responses:        []int{http.StatusServiceUnavailable, http.StatusOK},
+			remove:           true,
+			expectedAttempts: 2,
+		},
+	}
+	for i, tc := range tcs {
+		var attempts int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&attempts, 1)
+			code := tc.responses[n-1]
+			switch code {
+			case 0:
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+			case http.StatusOK:
+				_ = json.NewEncoder(w).Encode(types.EnvironmentListResponse{})
+			default:
+				if tc.retryAfter != "" {
+					w.Header().Set("Retry-After", tc.retryAfter)
+				}
+				w.WriteHeader(code)
+				_ = json.NewEncoder(w).Encode(types.ErrorResponse{Message: http.StatusText(code)})
+			}
+		}))
+		cli := newTestClient(t, srv.URL, WithRetryPolicy(testRetryPolicy()))
+
+		var err error
+		if tc.remove {
+			err = cli.EnvironmentRemove(context.Background(), "alice", "env")
+		} else {
+			_, err = cli.EnvironmentList(context.Background(), "alice")
+		}
+		srv.Close()
+
+		if got := atomic.LoadInt32(&attempts); got != tc.expectedAttempts {
+			t.Errorf("Expected %d attempts in case %d, got %d", tc.expectedAttempts, i, got)
+		}
+		if tc.expectedErr == nil && err != nil {
+			t.Errorf("Expected no error in case %d, got %v", i, err)
+		}
+		if tc.expectedErr != nil && !tc.expectedErr(err) {
+			t.Errorf("Expected the error class in case %d, got %v", i, err)
+		}
+	}
+}
+
+func TestRetryNonIdempotent(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	cli := newTestClient(t, srv.URL, WithRetryPolicy(testRetryPolicy()))
+
+	_, err := cli.EnvironmentCreate(context.Background(), "alice", types.EnvironmentCreateRequest{})
+	if !errdefs.IsUnavailable(err) {
+		t.Errorf("Expected the unavailable error, got %v", err)
+	}
+	if got := atomic.LoadInt32(&attempts); got != 1 {
+		t.Errorf("Expected the POST request to be sent once, got %d attempts", got)
+	}
+}
+
+func TestRetryTransportError(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/v1/users/alice/environments", nil)
+	tcs := []struct {
+		err      error
+		expected bool
+	}{
+		{err: ErrorConnectionFailed("tcp://localhost:8080"), expected: true},
+		{
+			err: errors.Wrap(&url.Error{Op: "Get", URL: "http://localhost:8080",
+				Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}, "error during connect"),
+			expected: true,
+		},
+		{
+			err: errors.Wrap(&url.Error{Op: "Get", URL: "http://localhost:8080", Err: io.EOF},
+				"error during connect"),
+			expected: true,
+		},
+		{
+			// The certificate error fails again in the retries.
+			err: errors.Wrap(&url.Error{Op: "Get", URL: "https://localhost:8080",
+				Err: x509.UnknownAuthorityError{}}, "error during connect"),
+			expected: false,
+		},
+		{err: errors.New("malformed HTTP response"), expected: false},
+		{err: context.Canceled, expected: false},
+	}
+	for _, tc := range tcs {
+		if _, got := testRetryPolicy().retryDelay(req, serverResponse{}, tc.err, 1); got != tc.expected {
+			t.Errorf("Expected retry %v for %v, got %v", tc.expected, tc.err, got)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var attempts int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(types.EnvironmentListResponse{})
+	}))
+	defer srv.Close()
+	cli := newTestClient(t, srv.URL, WithRetryPolicy(testRetryPolicy()))
+
+	start := time.Now()
+	if _, err := cli.EnvironmentList(context.Background(), "alice"); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected to wait for Retry-After, retried after %s", elapsed)
+	}
+
+	// The caller cancels the request while waiting for the retry.
+	atomic.StoreInt32(&attempts, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := cli.EnvironmentList(ctx, "alice"); !errdefs.IsDeadline(err) {
+		t.Errorf("Expected the deadline error, got %v", err)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+	tcs := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{value: "", ok: false},
+		{value: "3", expected: 3 * time.Second, ok: true},
+		{value: "-1", ok: false},
+		{value: "Tue, 01 Nov 2022 00:00:05 GMT", expected: 5 * time.Second, ok: true},
+		{value: "Mon, 31 Oct 2022 00:00:00 GMT", expected: 0, ok: true},
+		{value: "soon", ok: false},
+	}
+	for _, tc := range tcs {
+		got, ok := parseRetryAfter(tc.value, now)
+		if ok != tc.ok || got != tc.expected {
+			t.Errorf("Expected %s, %v for %q, got %s, %v", tc.expected, tc.ok, tc.value, got, ok)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+// SessionList lists the SSH sessions of the owner, newest first.
+func (cli *Client) SessionList(ctx context.Context, owner string,
+	req types.SSHSessionListRequest) (types.SSHSessionListResponse, error) {
+	urlString := fmt.Sprintf("/users/%s/sessions", owner)
+	resp, err := cli.get(ctx, urlString, sessionListQuery(req), nil)
+	defer ensureReaderClosed(resp)
+
+	if err != nil {
+		return types.SSHSessionListResponse{}, wrapResponseError(err, resp, "owner", owner)
+	}
+
+	var response types.SSHSessionListResponse
+	err = json.NewDecoder(resp.body).Decode(&response)
+	return response, err
+}
+
+// SessionListAll lists the SSH sessions of all the users. The client must
+// be created with the address of the admin server.
+func (cli *Client) SessionListAll(ctx context.Context,
+	req types.SSHSessionListRequest) (types.SSHSessionListResponse, error) {
+	resp, err := cli.getUnversioned(ctx, "/sessions", sessionListQuery(req))
+	defer ensureReaderClosed(resp)
+
+	if err != nil {
+		return types.SSHSessionListResponse{}, err
+	}
+
+	var response types.SSHSessionListResponse
+	err = json.NewDecoder(resp.body).Decode(&response)
+	return response, err
+}
+
+func sessionListQuery(req types.SSHSessionListRequest) url.Values {
+	query := url.Values{}
+	if req.Owner != "" {
+		query.Set("owner", req.Owner)
+	}
+	if req.Environment != "" {
+		query.Set("environment", req.Environment)
+	}
+	if req.Active {
+		query.Set("active", "true")
+	}
+	if req.Before != 0 {
+		query.Set("before", strconv.FormatInt(req.Before, 10))
+	}
+	if req.Limit != 0 {
+		query.Set("limit", strconv.Itoa(int(req.Limit)))
+	}
+	return query
+}
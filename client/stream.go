@@ -0,0 +1,133 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+// maxEventSize is the maximum size of a line in the server-sent events.
+const maxEventSize = 1 << 20
+
+// Stream is a long-lived response of the server, e.g. the logs or the
+// events of the environments. The messages are either server-sent events
+// or newline-delimited JSON, depending on the content type. The stream is
+// ended by the timeout of the HTTP client too, use the context to cancel
+// it instead.
+type Stream struct {
+	body io.ReadCloser
+
+	// scanner is used for the server-sent events, and decoder for JSON.
+	scanner *bufio.Scanner
+	decoder *json.Decoder
+	event   string
+	id      string
+}
+
+// Stream sends a GET request to the API path, and returns the stream of
+// the response. The caller must close it.
+func (cli *Client) Stream(ctx context.Context, path string, query url.Values) (*Stream, error) {
+	headers := map[string][]string{
+		"Accept": {types.MediaTypeEventStream + ", " + types.MediaTypeNDJSON},
+	}
+	resp, err := cli.get(ctx, path, query, headers)
+	if err != nil {
+		ensureReaderClosed(resp)
+		return nil, err
+	}
+	return newStream(resp.body, resp.header.Get("Content-Type")), nil
+}
+
+func newStream(body io.ReadCloser, contentType string) *Stream {
+	s := &Stream{body: body}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == types.MediaTypeEventStream {
+		s.scanner = bufio.NewScanner(body)
+		s.scanner.Buffer(make([]byte, 4096), maxEventSize)
+	} else {
+		s.decoder = json.NewDecoder(body)
+	}
+	return s
+}
+
+// Next decodes the next message into v. It returns io.EOF when the stream
+// ends.
+func (s *Stream) Next(v interface{}) error {
+	if s.decoder != nil {
+		return s.decoder.Decode(v)
+	}
+	data, err := s.nextEvent()
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(json.Unmarshal(data, v), "failed to decode the event data")
+}
+
+// nextEvent reads the fields of the next server-sent event, and returns
+// the data.
+func (s *Stream) nextEvent() ([]byte, error) {
+	var data bytes.Buffer
+	hasData := false
+	s.event = ""
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if line == "" {
+			if hasData {
+				return data.Bytes(), nil
+			}
+			// Ignore the events without data, e.g. the keepalive.
+			s.event = ""
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			s.event = value
+		case "id":
+			s.id = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		}
+	}
+	if err := s.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Event returns the type of the last server-sent event. It is empty for
+// the JSON streams.
+func (s *Stream) Event() string {
+	return s.event
+}
+
+// LastEventID returns the ID of the last server-sent event, which can be
+// used to resume the stream.
+func (s *Stream) LastEventID() string {
+	return s.id
+}
+
+// Close closes the stream.
+func (s *Stream) Close() error {
+	return s.body.Close()
+}
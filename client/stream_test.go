@@ -0,0 +1,162 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+type testEvent struct {
+	Name  string `json:"name"`
+	Phase string `json:"phase"`
+}
+
+func TestStream(t *testing.T) {
+	tcs := []struct {
+		contentType    string
+		body           string
+		expected       []testEvent
+		expectedEvents []string
+	}{
+		{
+			contentType: types.MediaTypeNDJSON,
+			body:        "{\"name\":\"a\",\"phase\":\"Pending\"}\n{\"name\":\"a\",\"phase\":\"Running\"}\n",
+			expected:    []testEvent{{"a", "Pending"}, {"a", "Running"}},
+		},
+		{
+			contentType: types.MediaTypeEventStream + "; charset=utf-8",
+			body: ": keepalive\n\n" +
+				"event: added\nid: 1\ndata: {\"name\":\"a\",\ndata: \"phase\":\"Pending\"}\n\n" +
+				"event: modified\nid: 2\ndata: {\"name\":\"a\",\"phase\":\"Running\"}\n\n",
+			expected:       []testEvent{{"a", "Pending"}, {"a", "Running"}},
+			expectedEvents: []string{"added", "modified"},
+		},
+	}
+	for _, tc := range tcs {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tc.contentType)
+			// Send the messages in chunks.
+			for _, line := range strings.SplitAfter(tc.body, "\n") {
+				fmt.Fprint(w, line)
+				w.(http.Flusher).Flush()
+			}
+		}))
+		cli := newTestClient(t, srv.URL)
+
+		s, err := cli.Stream(context.Background(), "/users/alice/environments/watch", nil)
+		if err != nil {
+			t.Fatalf("Expected no error opening the stream, got %v", err)
+		}
+		for i, expected := range tc.expected {
+			var got testEvent
+			if err := s.Next(&got); err != nil {
+				t.Fatalf("Expected message %d of %s, got %v", i, tc.contentType, err)
+			}
+			if got != expected {
+				t.Errorf("Expected %+v, got %+v", expected, got)
+			}
+			if tc.expectedEvents != nil && s.Event() != tc.expectedEvents[i] {
+				t.Errorf("Expected event %s, got %s", tc.expectedEvents[i], s.Event())
+			}
+		}
+		var got testEvent
+		if err := s.Next(&got); err != io.EOF {
+			t.Errorf("Expected EOF at the end of %s, got %v", tc.contentType, err)
+		}
+		s.Close()
+		srv.Close()
+	}
+}
+
+func TestHijack(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "tcp" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(types.ErrorResponse{
+				Code: errdefs.CodeInvalidParameter, Message: "upgrade required"})
+			return
+		}
+		var req map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req["cmd"] != "cat" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "HTTP/1.1 101 UPGRADED\r\nContent-Type: "+types.MediaTypeRawStream+
+			"\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		// Echo the input in upper case until the client closes the input.
+		data, _ := io.ReadAll(buf)
+		_, _ = conn.Write(bytes.ToUpper(data))
+	}))
+	defer srv.Close()
+	cli := newTestClient(t, srv.URL)
+
+	resp, err := cli.Hijack(context.Background(), http.MethodPost,
+		"/users/alice/environments/a/exec", nil, map[string]string{"cmd": "cat"})
+	if err != nil {
+		t.Fatalf("Expected no error hijacking the connection, got %v", err)
+	}
+	defer resp.Close()
+	var output bytes.Buffer
+	if err := HoldHijackedConnection(context.Background(), resp,
+		strings.NewReader("hello envd"), &output); err != nil {
+		t.Errorf("Expected no error holding the connection, got %v", err)
+	}
+	if output.String() != "HELLO ENVD" {
+		t.Errorf("Expected output HELLO ENVD, got %q", output.String())
+	}
+
+	// The server does not upgrade the connection.
+	req, _ := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if _, _, err := cli.setupHijackConn(context.Background(), req, "h2c"); !errdefs.IsInvalidParameter(err) {
+		t.Errorf("Expected the invalid parameter error, got %v", err)
+	}
+}
+
+func TestDialWebSocket(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(websocket.Handler(func(ws *websocket.Conn) {
+		path = ws.Request().URL.Path
+		_, _ = io.Copy(ws, ws)
+	}))
+	defer srv.Close()
+	cli := newTestClient(t, srv.URL)
+
+	ws, err := cli.DialWebSocket(context.Background(), "/users/alice/environments/a/attach", nil)
+	if err != nil {
+		t.Fatalf("Expected no error dialing the websocket, got %v", err)
+	}
+	defer ws.Close()
+	if err := websocket.Message.Send(ws, "ping"); err != nil {
+		t.Fatalf("Expected no error sending the message, got %v", err)
+	}
+	var got string
+	if err := websocket.Message.Receive(ws, &got); err != nil {
+		t.Fatalf("Expected no error receiving the message, got %v", err)
+	}
+	if got != "ping" {
+		t.Errorf("Expected the echo ping, got %s", got)
+	}
+	if path != "/v1/users/alice/environments/a/attach" {
+		t.Errorf("Expected the versioned path, got %s", path)
+	}
+}
@@ -0,0 +1,127 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/api/types/versions"
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+// ServerVersion returns the version of the server and the API versions it
+// supports. The request is sent without the API version prefix.
+func (cli *Client) ServerVersion(ctx context.Context) (types.VersionResponse, error) {
+	resp, err := cli.getUnversioned(ctx, "/version", nil)
+	defer ensureReaderClosed(resp)
+
+	var v types.VersionResponse
+	if err != nil {
+		return v, err
+	}
+	err = json.NewDecoder(resp.body).Decode(&v)
+	return v, err
+}
+
+// getUnversioned sends a GET request to the path without the API version
+// prefix, e.g. the version and the admin endpoints.
+func (cli *Client) getUnversioned(ctx context.Context, p string, query url.Values) (serverResponse, error) {
+	return cli.sendUnversioned(ctx, http.MethodGet, p, query)
+}
+
+// sendUnversioned sends a request without body to the path without the
+// API version prefix.
+func (cli *Client) sendUnversioned(ctx context.Context, method, p string, query url.Values) (serverResponse, error) {
+	apiPath := (&url.URL{Path: path.Join(cli.basePath, p), RawQuery: query.Encode()}).String()
+	req, err := cli.buildRequest(method, apiPath, nil, nil)
+	if err != nil {
+		return serverResponse{}, err
+	}
+	addContextHeaders(ctx, req.Header)
+	resp, err := cli.doRequestWithRetry(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+	return resp, errdefs.FromStatusCode(cli.checkResponseErr(resp), resp.statusCode)
+}
+
+// ClientVersion returns the API version used by this client.
+func (cli *Client) ClientVersion() string {
+	cli.negotiateLock.Lock()
+	defer cli.negotiateLock.Unlock()
+	return cli.version
+}
+
+// checkVersion negotiates the API version on the first request if it is
+// enabled, and returns the version to use. The concurrent requests wait
+// for the negotiation instead of sending the version requests again.
+func (cli *Client) checkVersion(ctx context.Context) string {
+	cli.negotiateLock.Lock()
+	defer cli.negotiateLock.Unlock()
+	if cli.negotiateVersion && !cli.negotiated && !cli.manualOverride {
+		v, err := cli.ServerVersion(ctx)
+		// Negotiate again in the next request if it fails.
+		if err == nil || errdefs.IsNotFound(err) {
+			cli.version = negotiatedVersion(v)
+			cli.negotiated = true
+		}
+	}
+	return cli.version
+}
+
+// NegotiateAPIVersion queries the API version of the server, and updates the
+// version of the client to the highest one supported by both of them. It is
+// a no-op if the version is set by WithVersion.
+func (cli *Client) NegotiateAPIVersion(ctx context.Context) {
+	if cli.manualOverride {
+		return
+	}
+	v, err := cli.ServerVersion(ctx)
+	if err != nil && !errdefs.IsNotFound(err) {
+		// Negotiate again in the next request.
+		return
+	}
+	cli.NegotiateAPIVersionPing(v)
+}
+
+// NegotiateAPIVersionPing updates the version of the client with the version
+// response of the server, see NegotiateAPIVersion.
+func (cli *Client) NegotiateAPIVersionPing(v types.VersionResponse) {
+	if cli.manualOverride {
+		return
+	}
+	cli.negotiateLock.Lock()
+	defer cli.negotiateLock.Unlock()
+	cli.version = negotiatedVersion(v)
+	cli.negotiated = true
+}
+
+// negotiatedVersion returns the highest version supported by both the client
+// and the server. The servers without the version endpoint only support the
+// first API version. If there is none, the highest version of the client is
+// used and the server rejects the requests with the supported versions.
+func negotiatedVersion(v types.VersionResponse) string {
+	serverMax, serverMin := v.APIVersion, v.MinAPIVersion
+	if serverMax == "" {
+		serverMax = "v1"
+	}
+	if serverMin == "" {
+		serverMin = serverMax
+	}
+	version := types.APIVersion
+	if versions.LessThan(serverMax, version) {
+		version = serverMax
+	}
+	if versions.LessThan(version, types.MinAPIVersion) ||
+		versions.LessThan(version, serverMin) {
+		return types.APIVersion
+	}
+	return version
+}
@@ -0,0 +1,147 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+func TestNegotiatedVersion(t *testing.T) {
+	tcs := []struct {
+		server   types.VersionResponse
+		expected string
+	}{
+		{
+			server:   types.VersionResponse{},
+			expected: "v1",
+		},
+		{
+			server:   types.VersionResponse{APIVersion: "v1", MinAPIVersion: "v1"},
+			expected: "v1",
+		},
+		{
+			// The newer server supports the version of the client.
+			server:   types.VersionResponse{APIVersion: "v3", MinAPIVersion: "v1"},
+			expected: types.APIVersion,
+		},
+		{
+			// There is no common version, the server rejects the requests.
+			server:   types.VersionResponse{APIVersion: "v3", MinAPIVersion: "v2"},
+			expected: types.APIVersion,
+		},
+	}
+	for _, tc := range tcs {
+		if got := negotiatedVersion(tc.server); got != tc.expected {
+			t.Errorf("Expected version %s for %+v, got %s", tc.expected, tc.server, got)
+		}
+	}
+}
+
+func TestAPIVersionNegotiation(t *testing.T) {
+	var versionCalls int
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			versionCalls++
+			_ = json.NewEncoder(w).Encode(types.VersionResponse{
+				APIVersion: "v1", MinAPIVersion: "v1"})
+			return
+		}
+		paths = append(paths, r.URL.Path)
+		_ = json.NewEncoder(w).Encode(types.EnvironmentListResponse{})
+	}))
+	defer srv.Close()
+
+	tcs := []struct {
+		opts          []Opt
+		expectedCalls int
+		expectedPath  string
+	}{
+		{
+			opts:          []Opt{WithAPIVersionNegotiation()},
+			expectedCalls: 1,
+			expectedPath:  "/v1/users/alice/environments",
+		},
+		{
+			// The version set by the user is not negotiated.
+			opts:          []Opt{WithAPIVersionNegotiation(), WithVersion("v2")},
+			expectedCalls: 0,
+			expectedPath:  "/v2/users/alice/environments",
+		},
+		{
+			opts:          nil,
+			expectedCalls: 0,
+			expectedPath:  "/v1/users/alice/environments",
+		},
+	}
+	for _, tc := range tcs {
+		versionCalls, paths = 0, nil
+		opts := append([]Opt{WithHost("tcp://" + strings.TrimPrefix(srv.URL, "http://"))}, tc.opts...)
+		cli, err := NewClientWithOpts(opts...)
+		if err != nil {
+			t.Fatalf("Expected no error creating the client, got %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := cli.EnvironmentList(context.Background(), "alice"); err != nil {
+				t.Errorf("Expected no error listing the environments, got %v", err)
+			}
+		}
+		if versionCalls != tc.expectedCalls {
+			t.Errorf("Expected %d version calls, got %d", tc.expectedCalls, versionCalls)
+		}
+		for _, p := range paths {
+			if p != tc.expectedPath {
+				t.Errorf("Expected path %s, got %s", tc.expectedPath, p)
+			}
+		}
+	}
+}
+
+func TestAPIVersionNegotiationConcurrent(t *testing.T) {
+	var versionCalls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/version" {
+			atomic.AddInt32(&versionCalls, 1)
+			_ = json.NewEncoder(w).Encode(types.VersionResponse{
+				APIVersion: "v1", MinAPIVersion: "v1"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(types.EnvironmentListResponse{})
+	}))
+	defer srv.Close()
+
+	cli, err := NewClientWithOpts(WithHost("tcp://"+strings.TrimPrefix(srv.URL, "http://")),
+		WithAPIVersionNegotiation())
+	if err != nil {
+		t.Fatalf("Expected no error creating the client, got %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cli.EnvironmentList(context.Background(), "alice"); err != nil {
+				t.Errorf("Expected no error listing the environments, got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	// The concurrent requests wait for the first negotiation.
+	if got := atomic.LoadInt32(&versionCalls); got != 1 {
+		t.Errorf("Expected 1 version call, got %d", got)
+	}
+	if got := cli.ClientVersion(); got != "v1" {
+		t.Errorf("Expected version v1, got %s", got)
+	}
+}
@@ -0,0 +1,57 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/websocket"
+
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+// DialWebSocket opens a WebSocket connection to the API path, with the
+// dial and TLS options of the client. The context is only used for the
+// handshake, the caller must close the connection.
+func (cli *Client) DialWebSocket(ctx context.Context, path string, query url.Values) (*websocket.Conn, error) {
+	host := cli.addr
+	if cli.proto == "unix" || cli.proto == "npipe" {
+		host = "envd"
+	}
+	scheme, originScheme := "ws", "http"
+	if cli.scheme == "https" {
+		scheme, originScheme = "wss", "https"
+	}
+	config, err := websocket.NewConfig(
+		scheme+"://"+host+cli.getAPIPath(ctx, path, query),
+		originScheme+"://"+host)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the websocket config")
+	}
+	config.Header = http.Header{}
+	for k, v := range cli.customHTTPHeaders {
+		config.Header.Set(k, v)
+	}
+	addContextHeaders(ctx, config.Header)
+
+	conn, err := cli.Dialer()(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot connect to the envd server")
+	}
+	stop := closeOnDone(ctx, conn)
+	ws, err := websocket.NewClient(config, conn)
+	if stop() {
+		conn.Close()
+		return nil, errdefs.FromContext(ctx)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "websocket handshake failed")
+	}
+	return ws, nil
+}
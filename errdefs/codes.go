@@ -0,0 +1,95 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package errdefs
+
+// Codes of the error classes, which are returned in the API error responses.
+const (
+	CodeNotFound          = "not_found"
+	CodeInvalidParameter  = "invalid_parameter"
+	CodeConflict          = "conflict"
+	CodeUnauthorized      = "unauthorized"
+	CodeUnavailable       = "unavailable"
+	CodeForbidden         = "forbidden"
+	CodeSystem            = "system"
+	CodeNotModified       = "not_modified"
+	CodeNotImplemented    = "not_implemented"
+	CodeCancelled         = "cancelled"
+	CodeDeadline          = "deadline_exceeded"
+	CodeDataLoss          = "data_loss"
+	CodeResourceExhausted = "resource_exhausted"
+	CodeUnknown           = "unknown"
+)
+
+// Code returns the code of the error class, or CodeUnknown if the error
+// does not implement any of the classes.
+func Code(err error) string {
+	switch {
+	case IsNotFound(err):
+		return CodeNotFound
+	case IsInvalidParameter(err):
+		return CodeInvalidParameter
+	case IsConflict(err):
+		return CodeConflict
+	case IsUnauthorized(err):
+		return CodeUnauthorized
+	case IsUnavailable(err):
+		return CodeUnavailable
+	case IsForbidden(err):
+		return CodeForbidden
+	case IsSystem(err):
+		return CodeSystem
+	case IsNotModified(err):
+		return CodeNotModified
+	case IsNotImplemented(err):
+		return CodeNotImplemented
+	case IsCancelled(err):
+		return CodeCancelled
+	case IsDeadline(err):
+		return CodeDeadline
+	case IsDataLoss(err):
+		return CodeDataLoss
+	case IsResourceExhausted(err):
+		return CodeResourceExhausted
+	default:
+		return CodeUnknown
+	}
+}
+
+// FromCode creates an errdef error of the class with the given code. The
+// error is returned as is if the code is not known.
+func FromCode(err error, code string) error {
+	switch code {
+	case CodeNotFound:
+		return NotFound(err)
+	case CodeInvalidParameter:
+		return InvalidParameter(err)
+	case CodeConflict:
+		return Conflict(err)
+	case CodeUnauthorized:
+		return Unauthorized(err)
+	case CodeUnavailable:
+		return Unavailable(err)
+	case CodeForbidden:
+		return Forbidden(err)
+	case CodeSystem:
+		return System(err)
+	case CodeNotModified:
+		return NotModified(err)
+	case CodeNotImplemented:
+		return NotImplemented(err)
+	case CodeCancelled:
+		return Cancelled(err)
+	case CodeDeadline:
+		return Deadline(err)
+	case CodeDataLoss:
+		return DataLoss(err)
+	case CodeResourceExhausted:
+		return ResourceExhausted(err)
+	case CodeUnknown:
+		return Unknown(err)
+	default:
+		return err
+	}
+}
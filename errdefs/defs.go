@@ -71,3 +71,9 @@ type ErrDeadline interface {
 type ErrDataLoss interface {
 	DataLoss()
 }
+
+// ErrResourceExhausted signals that a limit of the caller was reached, e.g.
+// the rate limit. The caller may retry the action later.
+type ErrResourceExhausted interface {
+	ResourceExhausted()
+}
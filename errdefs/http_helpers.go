@@ -2,7 +2,7 @@
 // License, v. 2.0. If a copy of the MPL was not distributed with this
 // file, You can obtain one at https://mozilla.org/MPL/2.0/.
 
-package errdefs // import "github.com/docker/docker/errdefs"
+package errdefs
 
 import (
 	"net/http"
@@ -32,6 +32,8 @@ func FromStatusCode(err error, statusCode int) error {
 		err = NotModified(err)
 	case http.StatusNotImplemented:
 		err = NotImplemented(err)
+	case http.StatusTooManyRequests:
+		err = ResourceExhausted(err)
 	case http.StatusInternalServerError:
 		if !IsSystem(err) && !IsUnknown(err) && !IsDataLoss(err) && !IsDeadline(err) && !IsCancelled(err) {
 			err = System(err)
@@ -55,3 +57,31 @@ func FromStatusCode(err error, statusCode int) error {
 	}
 	return err
 }
+
+// ToStatusCode returns the HTTP status code for the class of the error.
+func ToStatusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case IsNotFound(err):
+		return http.StatusNotFound
+	case IsInvalidParameter(err):
+		return http.StatusBadRequest
+	case IsConflict(err):
+		return http.StatusConflict
+	case IsUnauthorized(err):
+		return http.StatusUnauthorized
+	case IsUnavailable(err):
+		return http.StatusServiceUnavailable
+	case IsForbidden(err):
+		return http.StatusForbidden
+	case IsNotModified(err):
+		return http.StatusNotModified
+	case IsNotImplemented(err):
+		return http.StatusNotImplemented
+	case IsResourceExhausted(err):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,152 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cockroachdb/errors"
+	"github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/server"
+)
+
+// loadConfig loads the config file, and overrides the values with the
+// flags and environment variables which are set explicitly.
+func loadConfig(clicontext *cli.Context) (config.Config, error) {
+	cfg, err := config.Load(clicontext.Path("config"))
+	if err != nil {
+		return cfg, err
+	}
+
+	if clicontext.IsSet("debug") {
+		cfg.Log.Debug = clicontext.Bool("debug")
+	}
+	if clicontext.IsSet("log-format") {
+		cfg.Log.Format = clicontext.String("log-format")
+	}
+	if clicontext.IsSet("kubeconfig") {
+		cfg.Kubernetes.KubeConfig = clicontext.Path("kubeconfig")
+	}
+	if clicontext.IsSet("hostkey") {
+		cfg.HostKeyPath = clicontext.Path("hostkey")
+	}
+	if clicontext.IsSet("dburl") {
+		cfg.Database.URL = clicontext.String("dburl")
+	}
+	if clicontext.IsSet("db-backend") {
+		cfg.Database.Backend = clicontext.String("db-backend")
+	}
+	if clicontext.IsSet("db-path") {
+		cfg.Database.Path = clicontext.Path("db-path")
+	}
+	if clicontext.IsSet("addr") {
+		cfg.Addrs = clicontext.StringSlice("addr")
+	}
+	if clicontext.IsSet("tls-cert") {
+		cfg.TLS.CertFile = clicontext.Path("tls-cert")
+	}
+	if clicontext.IsSet("tls-key") {
+		cfg.TLS.KeyFile = clicontext.Path("tls-key")
+	}
+	if clicontext.IsSet("tls-client-ca") {
+		cfg.TLS.ClientCAFile = clicontext.Path("tls-client-ca")
+	}
+	if clicontext.IsSet("tls-client-auth") {
+		cfg.TLS.ClientAuth = clicontext.String("tls-client-auth")
+	}
+	if clicontext.IsSet("admin-addr") {
+		cfg.AdminAddr = clicontext.String("admin-addr")
+	}
+	if clicontext.IsSet("admin-token-file") {
+		cfg.AdminTokenFile = clicontext.Path("admin-token-file")
+	}
+	if clicontext.IsSet("trusted-proxy") {
+		cfg.TrustedProxies = clicontext.StringSlice("trusted-proxy")
+	}
+	if clicontext.IsSet("otlp-endpoint") {
+		cfg.Tracing.OTLPEndpoint = clicontext.String("otlp-endpoint")
+	}
+	if clicontext.IsSet("otlp-insecure") {
+		cfg.Tracing.OTLPInsecure = clicontext.Bool("otlp-insecure")
+	}
+	if clicontext.IsSet("trace-sample-ratio") {
+		cfg.Tracing.SampleRatio = clicontext.Float64("trace-sample-ratio")
+	}
+	if clicontext.IsSet("leader-elect") {
+		cfg.LeaderElection.Enabled = clicontext.Bool("leader-elect")
+	}
+	if clicontext.IsSet("leader-elect-namespace") {
+		cfg.LeaderElection.Namespace = clicontext.String("leader-elect-namespace")
+	}
+	if clicontext.IsSet("ssh-backend") {
+		cfg.SSH.Backend = clicontext.String("ssh-backend")
+	}
+	if clicontext.IsSet("runtime") {
+		cfg.Runtime.Backend = clicontext.String("runtime")
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, errors.Wrap(err, "invalid config")
+	}
+	return cfg, nil
+}
+
+func applyLogConfig(cfg config.LogConfig) error {
+	switch cfg.Format {
+	case config.LogFormatJSON:
+		logrus.SetFormatter(&logrus.JSONFormatter{})
+	case config.LogFormatText:
+		logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
+	default:
+		return errors.Newf("unknown log format %s", cfg.Format)
+	}
+	if cfg.Debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	} else {
+		logrus.SetLevel(logrus.InfoLevel)
+	}
+	return nil
+}
+
+// reloadOnSignal reloads the config on SIGHUP, and applies the settings
+// which can be changed at runtime. The invalid config is ignored.
+func reloadOnSignal(ctx context.Context, clicontext *cli.Context,
+	cfg config.Config, s *server.Server) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigCh:
+		}
+
+		next, err := loadConfig(clicontext)
+		if err != nil {
+			logrus.WithError(err).Error("failed to reload the config, keep the current one")
+			continue
+		}
+		applied, ignored := cfg.Reload(next)
+		if len(ignored) > 0 {
+			logrus.WithField("settings", ignored).
+				Warn("the settings cannot be changed without restarting the server")
+		}
+		if err := applyLogConfig(applied.Log); err != nil {
+			logrus.WithError(err).Error("failed to apply the log config")
+			continue
+		}
+		s.SetEnvironmentConfig(applied.Environment)
+		cfg = applied
+		logrus.Info("config reloaded")
+	}
+}
@@ -0,0 +1,426 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLoad(t *testing.T) {
+	tcs := []struct {
+		content     string
+		expectedErr bool
+		expected    func(*Config)
+	}{
+		{
+			content: `
+addrs: [":9090", "unix:///var/run/envd-server.sock"]
+timeouts:
+  shutdown: 1m
+log:
+  format: json
+environment:
+  namespace: envd
+  sshPort: 22
+`,
+			expectedErr: false,
+			expected: func(c *Config) {
+				c.Addrs = []string{":9090", "unix:///var/run/envd-server.sock"}
+				c.Timeouts.Shutdown = metav1.Duration{Duration: time.Minute}
+				c.Log.Format = LogFormatJSON
+				c.Environment.Namespace = "envd"
+				c.Environment.SSHPort = 22
+			},
+		},
+		{
+			content:     ``,
+			expectedErr: false,
+			expected:    func(c *Config) {},
+		},
+		{
+			content:     `unknown: true`,
+			expectedErr: true,
+		},
+	}
+	for _, tc := range tcs {
+		path := filepath.Join(t.TempDir(), "config.yaml")
+		if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(path)
+		if tc.expectedErr {
+			if err == nil {
+				t.Errorf("Expected error for %q", tc.content)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected no error for %q, got %v", tc.content, err)
+			continue
+		}
+		expected := Default()
+		tc.expected(&expected)
+		if !reflect.DeepEqual(cfg, expected) {
+			t.Errorf("Expected %+v, got %+v", expected, cfg)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tcs := []struct {
+		modify      func(*Config)
+		expectedErr bool
+	}{
+		{
+			modify:      func(c *Config) {},
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.Addrs = []string{"udp://:8080"} },
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.AdminAddr = ":8081" },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.AdminAddr = ":8081"
+				c.AdminTokenFile = "/etc/envd-server/admin-token"
+			},
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.AdminAddr = "unix:///var/run/envd-server-admin.sock" },
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.TrustedProxies = []string{"10.0.0.1", "10.1.0.0/16"} },
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.TrustedProxies = []string{"proxy.local"} },
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.Log.Format = "xml" },
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.Environment.SSHPort = 70000 },
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.Environment.HostKeyPath = "hostkey" },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.Runtime.Backend = RuntimeBackendDocker
+				c.Runtime.Docker.HostKeyFile = "/etc/envd-server/hostkey"
+				c.Runtime.Docker.AuthorizedKeysFile = "/etc/envd-server/publickey"
+			},
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.Runtime.Backend = RuntimeBackendDocker },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.Runtime.Backend = RuntimeBackendDocker
+				c.Runtime.Docker.HostKeyFile = "/etc/envd-server/hostkey"
+				c.Runtime.Docker.AuthorizedKeysFile = "/etc/envd-server/publickey"
+				c.SSH.Backend = SSHBackendKubernetes
+			},
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.Runtime.Backend = "podman" },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.Database.Backend = DatabaseBackendSQLite
+				c.Database.Path = "/var/lib/envd-server/envd-server.db"
+			},
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.Database.Backend = DatabaseBackendSQLite },
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.Database.Backend = "mysql" },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.Registry.Mirrors = map[string][]string{"docker.io": {"mirror.gcr.io"}}
+				c.Registry.Insecure = []string{"localhost:5000"}
+				c.Registry.LocalDir = "/var/lib/envd-server/images"
+			},
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.Registry.Mirrors = map[string][]string{"docker.io": {""}} },
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.Registry.LocalDir = "images" },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.Kubernetes.Clusters = []ClusterConfig{
+					{Name: "a", Context: "a"},
+					{Name: "b", Context: "b", Labels: map[string]string{"gpu": "a100"}, MaxEnvironments: 10},
+				}
+			},
+			expectedErr: false,
+		},
+		{
+			modify: func(c *Config) {
+				c.Kubernetes.Clusters = []ClusterConfig{{Name: "a"}, {Name: "a"}}
+			},
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.Kubernetes.Clusters = []ClusterConfig{{Context: "a"}}
+			},
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.Kubernetes.Clusters = []ClusterConfig{{Name: "a", MaxEnvironments: -1}}
+			},
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.Runtime.Backend = RuntimeBackendDocker
+				c.Runtime.Docker.HostKeyFile = "/etc/envd-server/hostkey"
+				c.Runtime.Docker.AuthorizedKeysFile = "/etc/envd-server/publickey"
+				c.Kubernetes.Clusters = []ClusterConfig{{Name: "a"}}
+			},
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.HostKeys.ReloadInterval.Duration = 0 },
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.Tracing.SampleRatio = 2 },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.LeaderElection.Enabled = true
+			},
+			expectedErr: false,
+		},
+		{
+			modify: func(c *Config) {
+				c.LeaderElection.Enabled = true
+				c.LeaderElection.RenewDeadline = c.LeaderElection.LeaseDuration
+			},
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.RateLimit.Read = RateLimit{} },
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.RateLimit.Write.Burst = 0 },
+			expectedErr: true,
+		},
+		{
+			modify:      func(c *Config) { c.SSH.Backend = SSHBackendKubernetes },
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.SSH.Backend = "docker" },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.SSH.Username.Formats = []string{"env.owner", "env@owner"}
+				c.SSH.Username.DefaultEnvironment = "dev"
+			},
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.SSH.Username.Formats = []string{"owner:env"} },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.SSH.Backend = SSHBackendKubernetes
+				c.SSH.Kubernetes.IdleCommand = nil
+			},
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.SSH.Backend = SSHBackendKubernetes
+				c.SSH.Kubernetes.Mode = SSHKubernetesModeSession
+				c.SSH.Kubernetes.IdleCommand = nil
+			},
+			expectedErr: false,
+		},
+		{
+			modify:      func(c *Config) { c.SSH.Security.Default.X11Forwarding = "filter" },
+			expectedErr: true,
+		},
+		{
+			modify: func(c *Config) {
+				c.SSH.Security.Policies = map[string]SSHSecurityPolicy{
+					"locked": {Env: SSHPolicyFilter, AllowedEnv: []string{"LANG"}, MaxSessions: 1},
+				}
+			},
+			expectedErr: false,
+		},
+		{
+			modify: func(c *Config) {
+				c.SSH.Security.Users = map[string]SSHSecurityPolicy{
+					"alice": {Env: SSHPolicyEnable, AllowedEnv: []string{"LANG"}},
+				}
+			},
+			expectedErr: true,
+		},
+	}
+	for i, tc := range tcs {
+		cfg := Default()
+		tc.modify(&cfg)
+		err := cfg.Validate()
+		if tc.expectedErr != (err != nil) {
+			t.Errorf("Expected error %v in case %d, got %v", tc.expectedErr, i, err)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	current := Default()
+	next := Default()
+	next.Addrs = []string{":9090"}
+	next.Log.Debug = true
+	next.Environment.Namespace = "envd"
+	next.Environment.GitImage = "bitnami/git"
+
+	applied, ignored := current.Reload(next)
+	if !reflect.DeepEqual(applied.Addrs, current.Addrs) {
+		t.Errorf("Expected addrs %v, got %v", current.Addrs, applied.Addrs)
+	}
+	if !applied.Log.Debug {
+		t.Errorf("Expected the log config to be reloaded")
+	}
+	if applied.Environment.GitImage != "bitnami/git" {
+		t.Errorf("Expected git image bitnami/git, got %s", applied.Environment.GitImage)
+	}
+	if applied.Environment.Namespace != current.Environment.Namespace {
+		t.Errorf("Expected namespace %s, got %s",
+			current.Environment.Namespace, applied.Environment.Namespace)
+	}
+	expectedIgnored := []string{"addrs", "environment.namespace"}
+	if !reflect.DeepEqual(ignored, expectedIgnored) {
+		t.Errorf("Expected ignored %v, got %v", expectedIgnored, ignored)
+	}
+}
+
+func TestSSHSecurityPolicy(t *testing.T) {
+	sec := SSHSecurityConfig{
+		Default: SSHSecurityPolicy{
+			Forwarding:        SSHPolicyEnable,
+			ReverseForwarding: SSHPolicyEnable,
+			Env:               SSHPolicyFilter,
+			AllowedEnv:        []string{"LANG", "TERM"},
+		},
+		Users: map[string]SSHSecurityPolicy{
+			"alice": {X11Forwarding: SSHPolicyEnable, MaxSessions: 4},
+		},
+		Policies: map[string]SSHSecurityPolicy{
+			"locked": {
+				Forwarding:        SSHPolicyDisable,
+				ReverseForwarding: SSHPolicyDisable,
+				X11Forwarding:     SSHPolicyDisable,
+				SFTP:              SSHPolicyDisable,
+				Env:               SSHPolicyFilter,
+				AllowedEnv:        []string{"TERM", "TZ"},
+				MaxSessions:       1,
+			},
+			// It cannot loosen the policy.
+			"open": {Forwarding: SSHPolicyEnable, Env: SSHPolicyEnable, MaxSessions: 10},
+		},
+	}
+
+	tcs := []struct {
+		owner       string
+		policy      string
+		expected    SSHSecurityPolicy
+		expectedErr bool
+	}{
+		{
+			owner:    "bob",
+			expected: sec.Default,
+		},
+		{
+			owner: "alice",
+			expected: SSHSecurityPolicy{
+				Forwarding:        SSHPolicyEnable,
+				ReverseForwarding: SSHPolicyEnable,
+				X11Forwarding:     SSHPolicyEnable,
+				Env:               SSHPolicyFilter,
+				AllowedEnv:        []string{"LANG", "TERM"},
+				MaxSessions:       4,
+			},
+		},
+		{
+			owner:  "alice",
+			policy: "locked",
+			expected: SSHSecurityPolicy{
+				Forwarding:        SSHPolicyDisable,
+				ReverseForwarding: SSHPolicyDisable,
+				X11Forwarding:     SSHPolicyDisable,
+				SFTP:              SSHPolicyDisable,
+				Env:               SSHPolicyFilter,
+				AllowedEnv:        []string{"TERM"},
+				MaxSessions:       1,
+			},
+		},
+		{
+			owner:  "bob",
+			policy: "open",
+			expected: SSHSecurityPolicy{
+				Forwarding:        SSHPolicyEnable,
+				ReverseForwarding: SSHPolicyEnable,
+				Env:               SSHPolicyFilter,
+				AllowedEnv:        []string{"LANG", "TERM"},
+				MaxSessions:       10,
+			},
+		},
+		{
+			owner:       "bob",
+			policy:      "unknown",
+			expectedErr: true,
+		},
+	}
+	for i, tc := range tcs {
+		p, err := sec.Policy(tc.owner, tc.policy)
+		if tc.expectedErr != (err != nil) {
+			t.Errorf("Expected error %v in case %d, got %v", tc.expectedErr, i, err)
+			continue
+		}
+		if !tc.expectedErr && !reflect.DeepEqual(p, tc.expected) {
+			t.Errorf("Expected policy %+v in case %d, got %+v", tc.expected, i, p)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package config
+
+import (
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	SSHPolicyEnable  = "enable"
+	SSHPolicyFilter  = "filter"
+	SSHPolicyDisable = "disable"
+)
+
+// SSHSecurityConfig is the security settings of the SSH sessions returned
+// to containerssh. The policy of a session is the default one, overridden
+// by the one of the owner, and then restricted by the one named in the
+// spec of the environment.
+type SSHSecurityConfig struct {
+	Default SSHSecurityPolicy `json:"default"`
+	// Users overrides the default policy of the identity tokens.
+	Users map[string]SSHSecurityPolicy `json:"users"`
+	// Policies are the named policies which the environments opt in with
+	// the ssh_policy in the spec. They can only restrict the sessions,
+	// since the environments are created by the users.
+	Policies map[string]SSHSecurityPolicy `json:"policies"`
+}
+
+// SSHSecurityPolicy is the security policy of the sessions. The empty
+// fields are inherited, and the containerssh defaults are used at last.
+type SSHSecurityPolicy struct {
+	// Forwarding is enable or disable, for the TCP and the unix socket
+	// forwarding.
+	Forwarding string `json:"forwarding"`
+	// ReverseForwarding is enable or disable, for listening on TCP ports
+	// and unix sockets in the environment.
+	ReverseForwarding string `json:"reverseForwarding"`
+	X11Forwarding     string `json:"x11Forwarding"`
+	// SFTP is enable or disable. The other subsystems follow it since the
+	// environments only have sftp.
+	SFTP string `json:"sftp"`
+	// Env is enable, disable, or filter to pass through only AllowedEnv
+	// from the clients.
+	Env        string   `json:"env"`
+	AllowedEnv []string `json:"allowedEnv"`
+	// MaxSessions is the maximum number of the sessions in a connection.
+	MaxSessions int `json:"maxSessions"`
+}
+
+func (c SSHSecurityConfig) Validate() error {
+	if err := c.Default.Validate(); err != nil {
+		return errors.Wrap(err, "invalid default policy")
+	}
+	for owner, p := range c.Users {
+		if err := p.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid policy of user %s", owner)
+		}
+	}
+	for name, p := range c.Policies {
+		if name == "" {
+			return errors.New("policy name is required")
+		}
+		if err := p.Validate(); err != nil {
+			return errors.Wrapf(err, "invalid policy %s", name)
+		}
+	}
+	return nil
+}
+
+// Policy returns the policy of the owner in the environment with the
+// named policy, which may be empty.
+func (c SSHSecurityConfig) Policy(owner, name string) (SSHSecurityPolicy, error) {
+	p := c.Default.Override(c.Users[owner])
+	if name == "" {
+		return p, nil
+	}
+	restriction, ok := c.Policies[name]
+	if !ok {
+		return SSHSecurityPolicy{}, errors.Newf("unknown ssh policy %s", name)
+	}
+	return p.Restrict(restriction), nil
+}
+
+func (p SSHSecurityPolicy) Validate() error {
+	for field, mode := range map[string]string{
+		"forwarding":        p.Forwarding,
+		"reverseForwarding": p.ReverseForwarding,
+		"x11Forwarding":     p.X11Forwarding,
+		"sftp":              p.SFTP,
+	} {
+		if mode != "" && mode != SSHPolicyEnable && mode != SSHPolicyDisable {
+			return errors.Newf("%s must be %s or %s, got %s",
+				field, SSHPolicyEnable, SSHPolicyDisable, mode)
+		}
+	}
+	switch p.Env {
+	case "", SSHPolicyEnable, SSHPolicyDisable:
+		if len(p.AllowedEnv) != 0 {
+			return errors.Newf("allowedEnv requires env %s", SSHPolicyFilter)
+		}
+	case SSHPolicyFilter:
+	default:
+		return errors.Newf("unknown env mode %s", p.Env)
+	}
+	if p.MaxSessions < 0 {
+		return errors.New("maxSessions must not be negative")
+	}
+	return nil
+}
+
+// Override returns the policy with the non-empty fields of o.
+func (p SSHSecurityPolicy) Override(o SSHSecurityPolicy) SSHSecurityPolicy {
+	override := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	override(&p.Forwarding, o.Forwarding)
+	override(&p.ReverseForwarding, o.ReverseForwarding)
+	override(&p.X11Forwarding, o.X11Forwarding)
+	override(&p.SFTP, o.SFTP)
+	if o.Env != "" {
+		p.Env, p.AllowedEnv = o.Env, o.AllowedEnv
+	}
+	if o.MaxSessions != 0 {
+		p.MaxSessions = o.MaxSessions
+	}
+	return p
+}
+
+// Restrict returns the stricter policy of p and o in every field.
+func (p SSHSecurityPolicy) Restrict(o SSHSecurityPolicy) SSHSecurityPolicy {
+	restrict := func(dst *string, src string) {
+		if src == SSHPolicyDisable {
+			*dst = SSHPolicyDisable
+		}
+	}
+	restrict(&p.Forwarding, o.Forwarding)
+	restrict(&p.ReverseForwarding, o.ReverseForwarding)
+	restrict(&p.X11Forwarding, o.X11Forwarding)
+	restrict(&p.SFTP, o.SFTP)
+	switch {
+	case p.Env == SSHPolicyDisable:
+	case o.Env == SSHPolicyDisable:
+		p.Env, p.AllowedEnv = SSHPolicyDisable, nil
+	case p.Env == SSHPolicyFilter && o.Env == SSHPolicyFilter:
+		allowed := map[string]bool{}
+		for _, name := range o.AllowedEnv {
+			allowed[name] = true
+		}
+		var both []string
+		for _, name := range p.AllowedEnv {
+			if allowed[name] {
+				both = append(both, name)
+			}
+		}
+		p.AllowedEnv = both
+	case o.Env == SSHPolicyFilter:
+		p.Env, p.AllowedEnv = SSHPolicyFilter, o.AllowedEnv
+	}
+	if o.MaxSessions > 0 && (p.MaxSessions == 0 || o.MaxSessions < p.MaxSessions) {
+		p.MaxSessions = o.MaxSessions
+	}
+	return p
+}
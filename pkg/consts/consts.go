@@ -11,6 +11,18 @@ const (
 	PodLabelEnvironmentName   = EnvdLabelPrefix + "environment-name"
 	PodLabelJupyterAddr       = EnvdLabelPrefix + "jupyter.address"
 	PodLabelRStudioServerAddr = EnvdLabelPrefix + "rstudio.server.address"
+	// PodLabelSessionOwner is set on the ephemeral pods of the SSH
+	// sessions, which are not environments.
+	PodLabelSessionOwner = EnvdLabelPrefix + "session.owner"
+	// PodAnnotationSSHPolicy is the name of the SSH policy of the
+	// environment.
+	PodAnnotationSSHPolicy = EnvdLabelPrefix + "ssh.policy"
+	// PodAnnotationHostKey is the fingerprint of the host key mounted in
+	// the environment.
+	PodAnnotationHostKey = EnvdLabelPrefix + "hostkey.fingerprint"
+	// PodAnnotationCluster is the name of the cluster the environment is
+	// placed in.
+	PodAnnotationCluster = EnvdLabelPrefix + "cluster"
 
 	ImageLabelContainerName = EnvdLabelPrefix + "container.name"
 	ImageLabelPorts         = EnvdLabelPrefix + "ports"
@@ -0,0 +1,94 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"github.com/sirupsen/logrus"
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd-server/client"
+	"github.com/tensorchord/envd-server/pkg/version"
+)
+
+type EnvdServerCtlApp struct {
+	*cli.App
+}
+
+// New creates the admin CLI of envd-server, which manages the servers with
+// the client package.
+func New() EnvdServerCtlApp {
+	internalApp := cli.NewApp()
+	internalApp.EnableBashCompletion = true
+	internalApp.Name = "envd-server-ctl"
+	internalApp.Usage = "Admin CLI for envd-server"
+	internalApp.HideVersion = true
+	internalApp.Version = version.GetVersion().String()
+	internalApp.Flags = []cli.Flag{
+		&cli.PathFlag{
+			Name:    "config",
+			Usage:   "path of the context config file",
+			Value:   defaultConfigPath(),
+			EnvVars: []string{"ENVD_SERVER_CTL_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    "context",
+			Usage:   "name of the context to use, the current one by default",
+			EnvVars: []string{"ENVD_SERVER_CTL_CONTEXT"},
+		},
+		&cli.StringFlag{
+			Name:    "host",
+			Usage:   "address of the API server, overrides the context",
+			Value:   client.DefaultEnvdServerHost,
+			EnvVars: []string{client.EnvOverrideHost},
+		},
+		&cli.StringFlag{
+			Name:  "admin-host",
+			Usage: "address of the admin server, overrides the context",
+			Value: "http://127.0.0.1:8081",
+		},
+		&cli.StringFlag{
+			Name:    "admin-token",
+			Usage:   "bearer token of the admin server, overrides the context",
+			EnvVars: []string{"ENVD_SERVER_ADMIN_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "identity-token",
+			Usage:   "identity token of the user to act as, overrides the context",
+			EnvVars: []string{"ENVD_SERVER_IDENTITY_TOKEN"},
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "output format, one of table, json and yaml",
+			Value:   outputTable,
+		},
+		&cli.BoolFlag{
+			Name:  "debug",
+			Usage: "enable debug output in logs",
+		},
+	}
+	internalApp.Before = func(clicontext *cli.Context) error {
+		if clicontext.Bool("debug") {
+			logrus.SetLevel(logrus.DebugLevel)
+		}
+		return validateOutput(clicontext.String("output"))
+	}
+	internalApp.Commands = []*cli.Command{
+		contextCommand,
+		userCommand,
+		environmentCommand,
+		clusterCommand,
+		imageCommand,
+		auditCommand,
+		sessionCommand,
+		hostKeyCommand,
+		versionCommand,
+		completionCommand,
+	}
+
+	return EnvdServerCtlApp{
+		App: internalApp,
+	}
+}
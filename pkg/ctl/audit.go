@@ -0,0 +1,57 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"strconv"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+var auditCommand = &cli.Command{
+	Name:  "audit",
+	Usage: "Inspect the audit logs on the admin server",
+	Subcommands: []*cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "List the audit logs, newest first",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "actor", Usage: "identity token of the actor"},
+				&cli.StringFlag{Name: "action", Usage: "action, e.g. environment.create"},
+				&cli.Int64Flag{Name: "before", Usage: "list the logs before the ID"},
+				&cli.IntFlag{Name: "limit", Usage: "maximum number of the logs", Value: 50},
+			},
+			Action: auditList,
+		},
+	},
+}
+
+func auditList(clicontext *cli.Context) error {
+	c, err := adminClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.AuditLogList(clicontext.Context, types.AuditLogListRequest{
+		Actor:  clicontext.String("actor"),
+		Action: clicontext.String("action"),
+		Before: clicontext.Int64("before"),
+		Limit:  int32(clicontext.Int("limit")),
+	})
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(resp.Items))
+	for _, l := range resp.Items {
+		rows = append(rows, []string{strconv.FormatInt(l.ID, 10),
+			l.CreatedAt.UTC().Format(time.RFC3339), l.Actor, l.Action,
+			l.Target, l.Outcome, l.SourceAddress})
+	}
+	return newPrinter(clicontext).print(resp.Items,
+		[]string{"id", "time", "actor", "action", "target", "outcome", "source"}, rows)
+}
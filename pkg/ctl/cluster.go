@@ -0,0 +1,46 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"sort"
+	"strings"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+var clusterCommand = &cli.Command{
+	Name:  "cluster",
+	Usage: "Inspect the clusters of the environments",
+	Subcommands: []*cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "List the clusters the environments can be placed in",
+			Action:  clusterList,
+		},
+	},
+}
+
+func clusterList(clicontext *cli.Context) error {
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.ClusterList(clicontext.Context, owner)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(resp.Items))
+	for _, cluster := range resp.Items {
+		labels := make([]string, 0, len(cluster.Labels))
+		for k, v := range cluster.Labels {
+			labels = append(labels, k+"="+v)
+		}
+		sort.Strings(labels)
+		rows = append(rows, []string{cluster.Name, strings.Join(labels, ",")})
+	}
+	return newPrinter(clicontext).print(resp.Items, []string{"name", "labels"}, rows)
+}
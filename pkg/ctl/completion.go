@@ -0,0 +1,79 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"fmt"
+
+	"github.com/cockroachdb/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+// The completion scripts of urfave/cli, which call the CLI with
+// --generate-bash-completion.
+const (
+	bashCompletion = `_envd_server_ctl_bash_autocomplete() {
+  if [[ "${COMP_WORDS[0]}" != "source" ]]; then
+    local cur opts base
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    if [[ "$cur" == "-"* ]]; then
+      opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} ${cur} --generate-bash-completion )
+    else
+      opts=$( ${COMP_WORDS[@]:0:$COMP_CWORD} --generate-bash-completion )
+    fi
+    COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+    return 0
+  fi
+}
+
+complete -o bashdefault -o default -o nospace -F _envd_server_ctl_bash_autocomplete %s
+`
+	zshCompletion = `#compdef %[1]s
+
+_envd_server_ctl_zsh_autocomplete() {
+  local -a opts
+  local cur
+  cur=${words[-1]}
+  if [[ "$cur" == "-"* ]]; then
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} ${cur} --generate-bash-completion)}")
+  else
+    opts=("${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion)}")
+  fi
+
+  if [[ "${opts[1]}" != "" ]]; then
+    _describe 'values' opts
+  else
+    _files
+  fi
+}
+
+compdef _envd_server_ctl_zsh_autocomplete %[1]s
+`
+)
+
+var completionCommand = &cli.Command{
+	Name:  "completion",
+	Usage: "Print the shell completion script",
+	Description: `Load the completion in the current shell:
+
+   source <(envd-server-ctl completion bash)
+   source <(envd-server-ctl completion zsh)`,
+	ArgsUsage: "bash|zsh",
+	Action:    printCompletion,
+}
+
+func printCompletion(clicontext *cli.Context) error {
+	name := clicontext.App.Name
+	switch shell := clicontext.Args().First(); shell {
+	case "bash":
+		fmt.Fprintf(clicontext.App.Writer, bashCompletion, name)
+	case "zsh":
+		fmt.Fprintf(clicontext.App.Writer, zshCompletion, name)
+	default:
+		return errors.Newf("unsupported shell %q, must be one of bash and zsh", shell)
+	}
+	return nil
+}
@@ -0,0 +1,366 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/cockroachdb/errors"
+	cli "github.com/urfave/cli/v2"
+	"sigs.k8s.io/yaml"
+
+	"github.com/tensorchord/envd-server/client"
+)
+
+// ContextConfig is the configuration file of the contexts, which holds the
+// hosts and the credentials of the servers.
+type ContextConfig struct {
+	// Current is the name of the context in use.
+	Current  string    `json:"current"`
+	Contexts []Context `json:"contexts"`
+}
+
+// Context is a server to manage.
+type Context struct {
+	Name string `json:"name"`
+	// Host is the address of the API server, e.g. tcp://localhost:8080.
+	Host string `json:"host"`
+	// AdminHost is the address of the admin server, which serves the
+	// audit logs, e.g. tcp://localhost:8081.
+	AdminHost string `json:"adminHost,omitempty"`
+	// AdminToken is the bearer token of the admin server.
+	AdminToken string `json:"adminToken,omitempty"`
+	// IdentityToken is the user to act as.
+	IdentityToken string `json:"identityToken,omitempty"`
+	// TLS is used if the server serves the API over TLS.
+	TLS *ContextTLS `json:"tls,omitempty"`
+	// AdminTLS is used if the admin server is behind a TLS proxy, the
+	// admin server itself serves plain HTTP.
+	AdminTLS *ContextTLS `json:"adminTLS,omitempty"`
+}
+
+type ContextTLS struct {
+	CACert string `json:"caCert"`
+	Cert   string `json:"cert,omitempty"`
+	Key    string `json:"key,omitempty"`
+}
+
+// defaultConfigPath returns the path of the context config file in the
+// user config directory.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "envd-server", "ctl.yaml")
+}
+
+// LoadContextConfig reads the context config file. An empty config is
+// returned if the file does not exist.
+func LoadContextConfig(path string) (ContextConfig, error) {
+	var cfg ContextConfig
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, errors.Wrapf(err, "failed to read the context config %s", path)
+	}
+	if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+		return cfg, errors.Wrapf(err, "failed to parse the context config %s", path)
+	}
+	return cfg, nil
+}
+
+// Save writes the context config file, which is only readable by the user
+// since it holds the credentials.
+func (c ContextConfig) Save(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.Wrapf(err, "failed to create the directory of %s", path)
+	}
+	return errors.Wrapf(os.WriteFile(path, data, 0600),
+		"failed to write the context config %s", path)
+}
+
+// Get returns the context with the name.
+func (c ContextConfig) Get(name string) (Context, bool) {
+	for _, ctx := range c.Contexts {
+		if ctx.Name == name {
+			return ctx, true
+		}
+	}
+	return Context{}, false
+}
+
+// Set adds or replaces the context with the same name.
+func (c *ContextConfig) Set(ctx Context) {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == ctx.Name {
+			c.Contexts[i] = ctx
+			return
+		}
+	}
+	c.Contexts = append(c.Contexts, ctx)
+}
+
+// Remove removes the context, and returns false if it does not exist.
+func (c *ContextConfig) Remove(name string) bool {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			c.Contexts = append(c.Contexts[:i], c.Contexts[i+1:]...)
+			if c.Current == name {
+				c.Current = ""
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// currentContext returns the context selected by the flags, or the current
+// one in the config file. The host and the identity token flags override
+// the values in it.
+func currentContext(clicontext *cli.Context) (Context, error) {
+	cfg, err := LoadContextConfig(clicontext.Path("config"))
+	if err != nil {
+		return Context{}, err
+	}
+	name := clicontext.String("context")
+	if name == "" {
+		name = cfg.Current
+	}
+	var ctx Context
+	if name != "" {
+		var ok bool
+		if ctx, ok = cfg.Get(name); !ok {
+			return ctx, errors.Newf("context %s does not exist", name)
+		}
+	}
+	if clicontext.IsSet("host") || ctx.Host == "" {
+		ctx.Host = clicontext.String("host")
+	}
+	if clicontext.IsSet("admin-host") || ctx.AdminHost == "" {
+		ctx.AdminHost = clicontext.String("admin-host")
+	}
+	if clicontext.IsSet("admin-token") {
+		ctx.AdminToken = clicontext.String("admin-token")
+	}
+	if clicontext.IsSet("identity-token") {
+		ctx.IdentityToken = clicontext.String("identity-token")
+	}
+	return ctx, nil
+}
+
+// newClient creates the client of the host with the TLS settings, which
+// are nil if the host is plain HTTP.
+func newClient(host string, tlsConfig *ContextTLS, extra ...client.Opt) (*client.Client, error) {
+	opts := []client.Opt{
+		client.WithHost(host),
+		client.WithAPIVersionNegotiation(),
+		client.WithRetryPolicy(client.DefaultRetryPolicy()),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, client.WithTLSClientConfig(tlsConfig.CACert, tlsConfig.Cert, tlsConfig.Key))
+	}
+	return client.NewClientWithOpts(append(opts, extra...)...)
+}
+
+// apiClient returns the client of the API server in the current context.
+func apiClient(clicontext *cli.Context) (*client.Client, Context, error) {
+	ctx, err := currentContext(clicontext)
+	if err != nil {
+		return nil, ctx, err
+	}
+	c, err := newClient(ctx.Host, ctx.TLS)
+	return c, ctx, err
+}
+
+// adminClient returns the client of the admin server in the current
+// context.
+func adminClient(clicontext *cli.Context) (*client.Client, error) {
+	ctx, err := currentContext(clicontext)
+	if err != nil {
+		return nil, err
+	}
+	var opts []client.Opt
+	if ctx.AdminToken != "" {
+		opts = append(opts, client.WithHTTPHeaders(map[string]string{
+			"Authorization": "Bearer " + ctx.AdminToken,
+		}))
+	}
+	return newClient(ctx.AdminHost, ctx.AdminTLS, opts...)
+}
+
+// userClient returns the client of the API server and the identity token
+// of the user to act as.
+func userClient(clicontext *cli.Context) (*client.Client, string, error) {
+	c, ctx, err := apiClient(clicontext)
+	if err != nil {
+		return nil, "", err
+	}
+	if ctx.IdentityToken == "" {
+		return nil, "", errors.New("identity token is required, set it with --identity-token or in the context")
+	}
+	return c, ctx.IdentityToken, nil
+}
+
+var contextCommand = &cli.Command{
+	Name:  "context",
+	Usage: "Manage the servers to connect to",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "create",
+			Usage: "Create or update a context",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "name", Usage: "name of the context", Required: true},
+				&cli.StringFlag{Name: "host", Usage: "address of the API server", Value: client.DefaultEnvdServerHost},
+				&cli.StringFlag{Name: "admin-host", Usage: "address of the admin server"},
+				&cli.StringFlag{Name: "admin-token", Usage: "bearer token of the admin server"},
+				&cli.StringFlag{Name: "identity-token", Usage: "identity token of the user to act as"},
+				&cli.PathFlag{Name: "tls-ca", Usage: "CA to verify the server certificate"},
+				&cli.PathFlag{Name: "tls-cert", Usage: "client certificate"},
+				&cli.PathFlag{Name: "tls-key", Usage: "client key"},
+				&cli.PathFlag{Name: "admin-tls-ca", Usage: "CA to verify the certificate of the admin server"},
+				&cli.PathFlag{Name: "admin-tls-cert", Usage: "client certificate of the admin server"},
+				&cli.PathFlag{Name: "admin-tls-key", Usage: "client key of the admin server"},
+				&cli.BoolFlag{Name: "use", Usage: "use the context"},
+			},
+			Action: contextCreate,
+		},
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "List the contexts",
+			Action:  contextList,
+		},
+		{
+			Name:      "use",
+			Usage:     "Use the context",
+			ArgsUsage: "NAME",
+			Action:    contextUse,
+		},
+		{
+			Name:      "rm",
+			Aliases:   []string{"remove"},
+			Usage:     "Remove the context",
+			ArgsUsage: "NAME",
+			Action:    contextRemove,
+		},
+	},
+}
+
+func contextCreate(clicontext *cli.Context) error {
+	path := clicontext.Path("config")
+	cfg, err := LoadContextConfig(path)
+	if err != nil {
+		return err
+	}
+	ctx := Context{
+		Name:          clicontext.String("name"),
+		Host:          clicontext.String("host"),
+		AdminHost:     clicontext.String("admin-host"),
+		AdminToken:    clicontext.String("admin-token"),
+		IdentityToken: clicontext.String("identity-token"),
+	}
+	if _, err := client.ParseHostURL(ctx.Host); err != nil {
+		return err
+	}
+	ctx.TLS = contextTLS(clicontext, "tls-")
+	ctx.AdminTLS = contextTLS(clicontext, "admin-tls-")
+	cfg.Set(ctx)
+	if clicontext.Bool("use") || cfg.Current == "" {
+		cfg.Current = ctx.Name
+	}
+	return cfg.Save(path)
+}
+
+// contextTLS returns the TLS settings of the flags with the prefix, or nil
+// if the CA is not set.
+func contextTLS(clicontext *cli.Context, prefix string) *ContextTLS {
+	ca := clicontext.Path(prefix + "ca")
+	if ca == "" {
+		return nil
+	}
+	return &ContextTLS{
+		CACert: ca,
+		Cert:   clicontext.Path(prefix + "cert"),
+		Key:    clicontext.Path(prefix + "key"),
+	}
+}
+
+// contextView is the context printed by context ls, which tells if the
+// tokens are set instead of printing them.
+type contextView struct {
+	Name             string      `json:"name"`
+	Current          bool        `json:"current"`
+	Host             string      `json:"host"`
+	AdminHost        string      `json:"adminHost,omitempty"`
+	HasAdminToken    bool        `json:"hasAdminToken"`
+	HasIdentityToken bool        `json:"hasIdentityToken"`
+	TLS              *ContextTLS `json:"tls,omitempty"`
+	AdminTLS         *ContextTLS `json:"adminTLS,omitempty"`
+}
+
+func contextList(clicontext *cli.Context) error {
+	cfg, err := LoadContextConfig(clicontext.Path("config"))
+	if err != nil {
+		return err
+	}
+	views := make([]contextView, 0, len(cfg.Contexts))
+	rows := make([][]string, 0, len(cfg.Contexts))
+	for _, ctx := range cfg.Contexts {
+		view := contextView{
+			Name:             ctx.Name,
+			Current:          ctx.Name == cfg.Current,
+			Host:             ctx.Host,
+			AdminHost:        ctx.AdminHost,
+			HasAdminToken:    ctx.AdminToken != "",
+			HasIdentityToken: ctx.IdentityToken != "",
+			TLS:              ctx.TLS,
+			AdminTLS:         ctx.AdminTLS,
+		}
+		views = append(views, view)
+		current := ""
+		if view.Current {
+			current = "*"
+		}
+		rows = append(rows, []string{current, ctx.Name, ctx.Host, ctx.AdminHost,
+			boolString(ctx.TLS != nil), boolString(ctx.AdminTLS != nil)})
+	}
+	return newPrinter(clicontext).print(views,
+		[]string{"current", "name", "host", "admin host", "tls", "admin tls"}, rows)
+}
+
+func contextUse(clicontext *cli.Context) error {
+	name := clicontext.Args().First()
+	path := clicontext.Path("config")
+	cfg, err := LoadContextConfig(path)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Get(name); !ok {
+		return errors.Newf("context %s does not exist", name)
+	}
+	cfg.Current = name
+	return cfg.Save(path)
+}
+
+func contextRemove(clicontext *cli.Context) error {
+	name := clicontext.Args().First()
+	path := clicontext.Path("config")
+	cfg, err := LoadContextConfig(path)
+	if err != nil {
+		return err
+	}
+	if !cfg.Remove(name) {
+		return errors.Newf("context %s does not exist", name)
+	}
+	return cfg.Save(path)
+}
@@ -0,0 +1,190 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+func TestContextConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "envd-server", "ctl.yaml")
+	cfg, err := LoadContextConfig(path)
+	if err != nil || len(cfg.Contexts) != 0 {
+		t.Fatalf("Expected an empty config if the file does not exist, got %+v, %v", cfg, err)
+	}
+
+	cfg.Set(Context{Name: "dev", Host: "http://localhost:8080", IdentityToken: "alice"})
+	cfg.Set(Context{Name: "prod", Host: "https://envd.example.com",
+		TLS:      &ContextTLS{CACert: "/etc/envd/ca.pem"},
+		AdminTLS: &ContextTLS{CACert: "/etc/envd/admin-ca.pem"}})
+	cfg.Set(Context{Name: "dev", Host: "http://localhost:9090", IdentityToken: "alice"})
+	cfg.Current = "prod"
+	if err := cfg.Save(path); err != nil {
+		t.Fatalf("Expected no error saving the config, got %v", err)
+	}
+	loaded, err := LoadContextConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no error loading the config, got %v", err)
+	}
+	dev, ok := loaded.Get("dev")
+	if !ok || dev.Host != "http://localhost:9090" || len(loaded.Contexts) != 2 {
+		t.Errorf("Expected the replaced dev context, got %+v", loaded.Contexts)
+	}
+	if prod, _ := loaded.Get("prod"); prod.TLS == nil || prod.TLS.CACert != "/etc/envd/ca.pem" {
+		t.Errorf("Expected the TLS config of prod, got %+v", prod.TLS)
+	}
+	if prod, _ := loaded.Get("prod"); prod.AdminTLS == nil || prod.AdminTLS.CACert != "/etc/envd/admin-ca.pem" {
+		t.Errorf("Expected the admin TLS config of prod, got %+v", prod.AdminTLS)
+	}
+	if !loaded.Remove("prod") || loaded.Current != "" || loaded.Remove("prod") {
+		t.Errorf("Expected prod to be removed once and unset as current, got %+v", loaded)
+	}
+}
+
+func TestContextListRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctl.yaml")
+	cfg := ContextConfig{Current: "dev", Contexts: []Context{{Name: "dev",
+		Host: "http://localhost:8080", AdminToken: "admin-secret", IdentityToken: "alice-secret"}}}
+	if err := cfg.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		output   string
+		expected []string
+	}{
+		{output: "table", expected: []string{"dev", "http://localhost:8080"}},
+		{output: "json", expected: []string{`"hasAdminToken": true`, `"hasIdentityToken": true`}},
+		{output: "yaml", expected: []string{"hasAdminToken: true", "current: true"}},
+	}
+	for _, tc := range tcs {
+		app := New()
+		var out bytes.Buffer
+		app.Writer = &out
+		if err := app.Run([]string{"envd-server-ctl", "--config", path, "-o", tc.output,
+			"context", "ls"}); err != nil {
+			t.Errorf("Expected no error listing in %s, got %v", tc.output, err)
+			continue
+		}
+		for _, s := range tc.expected {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("Expected %q in the %s output, got %s", s, tc.output, out.String())
+			}
+		}
+		if strings.Contains(out.String(), "secret") {
+			t.Errorf("Expected the tokens redacted in the %s output, got %s", tc.output, out.String())
+		}
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	tcs := []struct {
+		specs    []string
+		expected []types.EnvironmentPort
+		err      bool
+	}{
+		{
+			specs:    []string{"jupyter:8888", "ssh:2222"},
+			expected: []types.EnvironmentPort{{Name: "jupyter", Port: 8888}, {Name: "ssh", Port: 2222}},
+		},
+		{specs: []string{"8888"}, err: true},
+		{specs: []string{":8888"}, err: true},
+		{specs: []string{"jupyter:70000"}, err: true},
+	}
+	for _, tc := range tcs {
+		ports, err := parsePorts(tc.specs)
+		if (err != nil) != tc.err {
+			t.Errorf("Expected error %v for %v, got %v", tc.err, tc.specs, err)
+			continue
+		}
+		if len(ports) != len(tc.expected) {
+			t.Errorf("Expected %v for %v, got %v", tc.expected, tc.specs, ports)
+			continue
+		}
+		for i := range ports {
+			if ports[i] != tc.expected[i] {
+				t.Errorf("Expected %v for %v, got %v", tc.expected, tc.specs, ports)
+			}
+		}
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	tcs := []struct {
+		specs    []string
+		expected map[string]string
+		err      bool
+	}{
+		{specs: nil, expected: nil},
+		{specs: []string{"gpu=a100", "zone="}, expected: map[string]string{"gpu": "a100", "zone": ""}},
+		{specs: []string{"gpu"}, err: true},
+		{specs: []string{"=a100"}, err: true},
+	}
+	for _, tc := range tcs {
+		selector, err := parseSelector(tc.specs)
+		if (err != nil) != tc.err {
+			t.Errorf("Expected error %v for %v, got %v", tc.err, tc.specs, err)
+			continue
+		}
+		if !reflect.DeepEqual(selector, tc.expected) {
+			t.Errorf("Expected %v for %v, got %v", tc.expected, tc.specs, selector)
+		}
+	}
+}
+
+func TestEnvironmentList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/users/alice/environments" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(types.EnvironmentListResponse{
+			Items: []types.Environment{{
+				ObjectMeta: types.ObjectMeta{Name: "mnist"},
+				Spec: types.EnvironmentSpec{Image: "pytorch:dev",
+					Ports: []types.EnvironmentPort{{Name: "jupyter", Port: 8888}}},
+				Status: types.EnvironmentStatus{Phase: "Running"},
+			}},
+		})
+	}))
+	defer srv.Close()
+
+	tcs := []struct {
+		output   string
+		expected []string
+	}{
+		{output: "table", expected: []string{"NAME", "mnist", "pytorch:dev", "Running", "jupyter:8888"}},
+		{output: "json", expected: []string{`"name": "mnist"`, `"phase": "Running"`}},
+		{output: "yaml", expected: []string{"- name: mnist", "phase: Running"}},
+	}
+	for _, tc := range tcs {
+		app := New()
+		var out bytes.Buffer
+		app.Writer = &out
+		err := app.Run([]string{"envd-server-ctl",
+			"--config", filepath.Join(t.TempDir(), "ctl.yaml"),
+			"--host", srv.URL, "--identity-token", "alice", "-o", tc.output,
+			"environment", "ls"})
+		if err != nil {
+			t.Errorf("Expected no error listing in %s, got %v", tc.output, err)
+			continue
+		}
+		for _, s := range tc.expected {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("Expected %q in the %s output, got %s", s, tc.output, out.String())
+			}
+		}
+	}
+}
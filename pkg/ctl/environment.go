@@ -0,0 +1,255 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+var environmentCommand = &cli.Command{
+	Name:    "environment",
+	Aliases: []string{"env"},
+	Usage:   "Manage the environments of the user",
+	Subcommands: []*cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "List the environments",
+			Action:  environmentList,
+		},
+		{
+			Name:      "get",
+			Usage:     "Get the environment",
+			ArgsUsage: "NAME",
+			Action:    environmentGet,
+		},
+		{
+			Name:  "create",
+			Usage: "Create an environment",
+			Flags: []cli.Flag{
+				&cli.StringFlag{Name: "name", Usage: "name of the environment", Required: true},
+				&cli.StringFlag{Name: "image", Usage: "image of the environment", Required: true},
+				&cli.StringSliceFlag{Name: "env", Usage: "environment variables, e.g. KEY=VALUE"},
+				&cli.StringSliceFlag{Name: "port", Usage: "ports to expose, e.g. jupyter:8888"},
+				&cli.StringFlag{Name: "cluster", Usage: "name of the cluster, chosen by the server if empty"},
+				&cli.StringSliceFlag{Name: "cluster-selector", Usage: "labels of the cluster, e.g. gpu=a100"},
+			},
+			Action: environmentCreate,
+		},
+		{
+			Name:      "rm",
+			Aliases:   []string{"remove"},
+			Usage:     "Remove the environments",
+			ArgsUsage: "NAME...",
+			Action:    environmentRemove,
+		},
+		{
+			Name:      "logs",
+			Usage:     "Print the logs of the environment",
+			ArgsUsage: "NAME",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "follow", Aliases: []string{"f"}, Usage: "stream the logs"},
+				&cli.Int64Flag{Name: "tail", Usage: "number of the lines from the end, all the lines if not positive"},
+			},
+			Action: environmentLogs,
+		},
+		{
+			Name:      "exec",
+			Usage:     "Run the command in the environment",
+			ArgsUsage: "NAME -- COMMAND [ARG...]",
+			Action:    environmentExec,
+		},
+	},
+}
+
+func environmentRows(envs []types.Environment) [][]string {
+	rows := make([][]string, 0, len(envs))
+	for _, env := range envs {
+		ports := make([]string, 0, len(env.Spec.Ports))
+		for _, p := range env.Spec.Ports {
+			ports = append(ports, fmt.Sprintf("%s:%d", p.Name, p.Port))
+		}
+		rows = append(rows, []string{env.Name, env.Spec.Image,
+			env.Status.Phase, strings.Join(ports, ",")})
+	}
+	return rows
+}
+
+var environmentHeader = []string{"name", "image", "phase", "ports"}
+
+func environmentList(clicontext *cli.Context) error {
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.EnvironmentList(clicontext.Context, owner)
+	if err != nil {
+		return err
+	}
+	return newPrinter(clicontext).print(resp.Items,
+		environmentHeader, environmentRows(resp.Items))
+}
+
+func environmentGet(clicontext *cli.Context) error {
+	if clicontext.NArg() != 1 {
+		return errors.New("the name of the environment is required")
+	}
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.EnvironmentGet(clicontext.Context, owner, clicontext.Args().First())
+	if err != nil {
+		return err
+	}
+	return newPrinter(clicontext).print(resp.Environment,
+		environmentHeader, environmentRows([]types.Environment{resp.Environment}))
+}
+
+func environmentCreate(clicontext *cli.Context) error {
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	ports, err := parsePorts(clicontext.StringSlice("port"))
+	if err != nil {
+		return err
+	}
+	selector, err := parseSelector(clicontext.StringSlice("cluster-selector"))
+	if err != nil {
+		return err
+	}
+	req := types.EnvironmentCreateRequest{
+		Environment: types.Environment{
+			ObjectMeta: types.ObjectMeta{Name: clicontext.String("name")},
+			Spec: types.EnvironmentSpec{
+				Owner: owner,
+				Image: clicontext.String("image"),
+				Env:   clicontext.StringSlice("env"),
+				Ports: ports,
+
+				Cluster:         clicontext.String("cluster"),
+				ClusterSelector: selector,
+			},
+		},
+	}
+	resp, err := c.EnvironmentCreate(clicontext.Context, owner, req)
+	if err != nil {
+		return err
+	}
+	for _, w := range resp.Warnings {
+		fmt.Fprintln(clicontext.App.ErrWriter, "warning:", w)
+	}
+	return newPrinter(clicontext).print(resp.Created,
+		environmentHeader, environmentRows([]types.Environment{resp.Created}))
+}
+
+func environmentRemove(clicontext *cli.Context) error {
+	if clicontext.NArg() == 0 {
+		return errors.New("the names of the environments are required")
+	}
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	for _, name := range clicontext.Args().Slice() {
+		if err := c.EnvironmentRemove(clicontext.Context, owner, name); err != nil {
+			return err
+		}
+		fmt.Fprintln(clicontext.App.Writer, name)
+	}
+	return nil
+}
+
+func environmentLogs(clicontext *cli.Context) error {
+	if clicontext.NArg() != 1 {
+		return errors.New("the name of the environment is required")
+	}
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	logs, err := c.EnvironmentLogs(clicontext.Context, owner, types.EnvironmentLogsRequest{
+		Name:   clicontext.Args().First(),
+		Follow: clicontext.Bool("follow"),
+		Tail:   clicontext.Int64("tail"),
+	})
+	if err != nil {
+		return err
+	}
+	defer logs.Close()
+	_, err = io.Copy(clicontext.App.Writer, logs)
+	return err
+}
+
+// environmentExec prints the output of the command, and exits with the
+// exit code of it.
+func environmentExec(clicontext *cli.Context) error {
+	if clicontext.NArg() < 2 {
+		return errors.New("the name of the environment and the command are required")
+	}
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	args := clicontext.Args().Slice()
+	resp, err := c.EnvironmentExec(clicontext.Context, owner, types.EnvironmentExecRequest{
+		Name: args[0],
+		Cmd:  args[1:],
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(clicontext.App.Writer, resp.Stdout)
+	fmt.Fprint(clicontext.App.ErrWriter, resp.Stderr)
+	if resp.StdoutTruncated || resp.StderrTruncated {
+		fmt.Fprintln(clicontext.App.ErrWriter, "the output is truncated by the server")
+	}
+	if resp.ExitCode != 0 {
+		return cli.Exit("", resp.ExitCode)
+	}
+	return nil
+}
+
+// parsePorts parses the ports in the format NAME:PORT.
+func parsePorts(specs []string) ([]types.EnvironmentPort, error) {
+	ports := make([]types.EnvironmentPort, 0, len(specs))
+	for _, spec := range specs {
+		name, port, ok := strings.Cut(spec, ":")
+		if !ok || name == "" {
+			return nil, errors.Newf("invalid port %s, must be NAME:PORT", spec)
+		}
+		p, err := strconv.ParseInt(port, 10, 32)
+		if err != nil || p <= 0 || p > 65535 {
+			return nil, errors.Newf("invalid port %s, must be NAME:PORT", spec)
+		}
+		ports = append(ports, types.EnvironmentPort{Name: name, Port: int32(p)})
+	}
+	return ports, nil
+}
+
+// parseSelector parses the labels in the format KEY=VALUE.
+func parseSelector(specs []string) (map[string]string, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	selector := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		k, v, ok := strings.Cut(spec, "=")
+		if !ok || k == "" {
+			return nil, errors.Newf("invalid selector %s, must be KEY=VALUE", spec)
+		}
+		selector[k] = v
+	}
+	return selector, nil
+}
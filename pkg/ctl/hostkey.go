@@ -0,0 +1,142 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	cli "github.com/urfave/cli/v2"
+)
+
+var hostKeyCommand = &cli.Command{
+	Name:  "hostkey",
+	Usage: "Rotate the host keys of the environments on the admin server",
+	Subcommands: []*cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "List the accepted host keys",
+			Action:  hostKeyList,
+		},
+		{
+			Name:   "create",
+			Usage:  "Generate a host key, which is accepted but not used by the new environments",
+			Action: hostKeyCreate,
+		},
+		{
+			Name:      "activate",
+			Usage:     "Use the host key in the new environments",
+			ArgsUsage: "NAME",
+			Action:    hostKeyActivate,
+		},
+		{
+			Name:  "roll",
+			Usage: "Recreate the environments which do not use the active host key",
+			Flags: []cli.Flag{
+				&cli.IntFlag{Name: "limit", Usage: "maximum number of the environments to recreate", Value: 10},
+			},
+			Action: hostKeyRoll,
+		},
+		{
+			Name:      "rm",
+			Aliases:   []string{"remove"},
+			Usage:     "Retire the host key",
+			ArgsUsage: "NAME",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "force", Usage: "remove the key even if it is used by the environments"},
+			},
+			Action: hostKeyRemove,
+		},
+	},
+}
+
+func hostKeyList(clicontext *cli.Context) error {
+	c, err := adminClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HostKeyList(clicontext.Context)
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(resp.Items)+1)
+	for _, k := range resp.Items {
+		rows = append(rows, []string{k.Name, k.Source, k.Fingerprint,
+			boolString(k.Active), strconv.Itoa(k.Environments)})
+	}
+	if resp.UnknownEnvironments != 0 {
+		rows = append(rows, []string{"<unknown>", "", "", "", strconv.Itoa(resp.UnknownEnvironments)})
+	}
+	return newPrinter(clicontext).print(resp,
+		[]string{"name", "source", "fingerprint", "active", "environments"}, rows)
+}
+
+func hostKeyCreate(clicontext *cli.Context) error {
+	c, err := adminClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HostKeyCreate(clicontext.Context)
+	if err != nil {
+		return err
+	}
+	return newPrinter(clicontext).print(resp, []string{"name", "fingerprint"},
+		[][]string{{resp.Name, resp.Fingerprint}})
+}
+
+func hostKeyActivate(clicontext *cli.Context) error {
+	if clicontext.NArg() != 1 {
+		return errors.New("the name of the host key is required")
+	}
+	c, err := adminClient(clicontext)
+	if err != nil {
+		return err
+	}
+	return c.HostKeyActivate(clicontext.Context, clicontext.Args().First())
+}
+
+func hostKeyRoll(clicontext *cli.Context) error {
+	c, err := adminClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HostKeyRoll(clicontext.Context, clicontext.Int("limit"))
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(resp.Rolled)+len(resp.Failed))
+	for _, name := range resp.Rolled {
+		rows = append(rows, []string{name, "rolled"})
+	}
+	failed := make([]string, 0, len(resp.Failed))
+	for name := range resp.Failed {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	for _, name := range failed {
+		rows = append(rows, []string{name, resp.Failed[name]})
+	}
+	if err := newPrinter(clicontext).print(resp, []string{"environment", "result"}, rows); err != nil {
+		return err
+	}
+	if resp.Remaining != 0 && clicontext.String("output") == outputTable {
+		fmt.Fprintf(clicontext.App.Writer, "%d environments remaining\n", resp.Remaining)
+	}
+	return nil
+}
+
+func hostKeyRemove(clicontext *cli.Context) error {
+	if clicontext.NArg() != 1 {
+		return errors.New("the name of the host key is required")
+	}
+	c, err := adminClient(clicontext)
+	if err != nil {
+		return err
+	}
+	return c.HostKeyRemove(clicontext.Context, clicontext.Args().First(), clicontext.Bool("force"))
+}
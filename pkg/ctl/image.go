@@ -0,0 +1,70 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"github.com/cockroachdb/errors"
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+var imageCommand = &cli.Command{
+	Name:  "image",
+	Usage: "Inspect the images of the user",
+	Subcommands: []*cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "List the images",
+			Action:  imageList,
+		},
+		{
+			Name:      "get",
+			Usage:     "Get the image",
+			ArgsUsage: "NAME",
+			Action:    imageGet,
+		},
+	},
+}
+
+var imageHeader = []string{"name", "digest", "created", "size"}
+
+func imageRows(images []types.ImageMeta) [][]string {
+	rows := make([][]string, 0, len(images))
+	for _, img := range images {
+		rows = append(rows, []string{img.Name, img.Digest,
+			unixTime(img.Created), byteSize(img.Size)})
+	}
+	return rows
+}
+
+func imageList(clicontext *cli.Context) error {
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.ImageList(clicontext.Context, owner)
+	if err != nil {
+		return err
+	}
+	return newPrinter(clicontext).print(resp.Items, imageHeader, imageRows(resp.Items))
+}
+
+func imageGet(clicontext *cli.Context) error {
+	if clicontext.NArg() != 1 {
+		return errors.New("the name of the image is required")
+	}
+	c, owner, err := userClient(clicontext)
+	if err != nil {
+		return err
+	}
+	resp, err := c.ImageGet(clicontext.Context, owner, clicontext.Args().First())
+	if err != nil {
+		return err
+	}
+	return newPrinter(clicontext).print(resp.ImageMeta,
+		imageHeader, imageRows([]types.ImageMeta{resp.ImageMeta}))
+}
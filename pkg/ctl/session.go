@@ -0,0 +1,76 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"strconv"
+	"time"
+
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+var sessionCommand = &cli.Command{
+	Name:  "session",
+	Usage: "Inspect the SSH sessions",
+	Subcommands: []*cli.Command{
+		{
+			Name:    "ls",
+			Aliases: []string{"list"},
+			Usage:   "List the SSH sessions, newest first",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{Name: "all", Usage: "list the sessions of all the users on the admin server"},
+				&cli.StringFlag{Name: "owner", Usage: "identity token of the owner, used with --all"},
+				&cli.StringFlag{Name: "environment", Usage: "name of the environment"},
+				&cli.BoolFlag{Name: "active", Usage: "list the connected sessions only"},
+				&cli.Int64Flag{Name: "before", Usage: "list the sessions before the ID"},
+				&cli.IntFlag{Name: "limit", Usage: "maximum number of the sessions", Value: 50},
+			},
+			Action: sessionList,
+		},
+	},
+}
+
+func sessionList(clicontext *cli.Context) error {
+	req := types.SSHSessionListRequest{
+		Owner:       clicontext.String("owner"),
+		Environment: clicontext.String("environment"),
+		Active:      clicontext.Bool("active"),
+		Before:      clicontext.Int64("before"),
+		Limit:       int32(clicontext.Int("limit")),
+	}
+	var resp types.SSHSessionListResponse
+	if clicontext.Bool("all") {
+		c, err := adminClient(clicontext)
+		if err != nil {
+			return err
+		}
+		if resp, err = c.SessionListAll(clicontext.Context, req); err != nil {
+			return err
+		}
+	} else {
+		c, owner, err := userClient(clicontext)
+		if err != nil {
+			return err
+		}
+		if resp, err = c.SessionList(clicontext.Context, owner, req); err != nil {
+			return err
+		}
+	}
+
+	rows := make([][]string, 0, len(resp.Items))
+	for _, ss := range resp.Items {
+		ended := ""
+		if ss.EndedAt != nil {
+			ended = ss.EndedAt.UTC().Format(time.RFC3339)
+		}
+		rows = append(rows, []string{strconv.FormatInt(ss.ID, 10), ss.Owner,
+			ss.Environment, ss.SourceAddress, ss.StartedAt.UTC().Format(time.RFC3339),
+			ended, byteSize(ss.BytesIn), byteSize(ss.BytesOut)})
+	}
+	return newPrinter(clicontext).print(resp.Items,
+		[]string{"id", "owner", "environment", "source", "started", "ended", "in", "out"}, rows)
+}
@@ -0,0 +1,57 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	"os"
+
+	"github.com/cockroachdb/errors"
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+var userCommand = &cli.Command{
+	Name:  "user",
+	Usage: "Manage the users and their SSH keys",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "register",
+			Usage: "Register the user, or replace the SSH public key of the user",
+			Flags: []cli.Flag{
+				&cli.PathFlag{
+					Name:     "public-key",
+					Usage:    "path of the SSH public key of the user",
+					Required: true,
+				},
+			},
+			Action: userRegister,
+		},
+	},
+}
+
+func userRegister(clicontext *cli.Context) error {
+	c, ctx, err := apiClient(clicontext)
+	if err != nil {
+		return err
+	}
+	if ctx.IdentityToken == "" {
+		return errors.New("identity token is required, set it with --identity-token or in the context")
+	}
+	key, err := os.ReadFile(clicontext.Path("public-key"))
+	if err != nil {
+		return errors.Wrap(err, "failed to read the public key")
+	}
+	resp, err := c.Auth(clicontext.Context, types.AuthRequest{
+		IdentityToken: ctx.IdentityToken,
+		PublicKey:     string(key),
+	})
+	if err != nil {
+		return err
+	}
+	return newPrinter(clicontext).print(resp,
+		[]string{"identity token", "status"},
+		[][]string{{resp.IdentityToken, resp.Status}})
+}
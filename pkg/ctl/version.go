@@ -0,0 +1,44 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package ctl
+
+import (
+	cli "github.com/urfave/cli/v2"
+
+	"github.com/tensorchord/envd-server/pkg/version"
+)
+
+var versionCommand = &cli.Command{
+	Name:   "version",
+	Usage:  "Print the versions of the CLI and the server",
+	Action: printVersion,
+}
+
+type versionOutput struct {
+	Client string `json:"client"`
+	Server string `json:"server,omitempty"`
+	// APIVersion is the negotiated API version.
+	APIVersion string `json:"apiVersion"`
+}
+
+func printVersion(clicontext *cli.Context) error {
+	c, _, err := apiClient(clicontext)
+	if err != nil {
+		return err
+	}
+	v, err := c.ServerVersion(clicontext.Context)
+	if err != nil {
+		return err
+	}
+	c.NegotiateAPIVersionPing(v)
+	out := versionOutput{
+		Client:     version.GetVersion().String(),
+		Server:     v.Version,
+		APIVersion: c.ClientVersion(),
+	}
+	return newPrinter(clicontext).print(out,
+		[]string{"client", "server", "api version"},
+		[][]string{{out.Client, out.Server, out.APIVersion}})
+}
@@ -78,6 +78,24 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/types.AuthResponse"
                         }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
                     }
                 }
             }
@@ -147,6 +165,39 @@ const docTemplate = `{
                 }
             }
         },
+        "/users/{identity_token}/clusters": {
+            "get": {
+                "description": "List the clusters the environments can be placed in, it is empty if there is only one.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "cluster"
+                ],
+                "summary": "List the clusters.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "\"a332139d39b89a241400013700e665a3\"",
+                        "description": "identity token",
+                        "name": "identity_token",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.ClusterListResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/users/{identity_token}/environments": {
             "get": {
                 "description": "List the environment.",
@@ -176,6 +227,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/types.EnvironmentListResponse"
                         }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
                     }
                 }
             },
@@ -216,6 +273,12 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/types.EnvironmentCreateResponse"
                         }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
                     }
                 }
             }
@@ -257,6 +320,18 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/types.EnvironmentGetResponse"
                         }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
                     }
                 }
             },
@@ -300,6 +375,136 @@ const docTemplate = `{
                 }
             }
         },
+        "/users/{identity_token}/environments/{name}/exec": {
+            "post": {
+                "description": "Run the command without the stdin and the TTY, and return the output after it exits. The first 1 MiB of the stdout and the stderr each is returned.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "environment"
+                ],
+                "summary": "Run the command in the environment.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "\"a332139d39b89a241400013700e665a3\"",
+                        "description": "identity token",
+                        "name": "identity_token",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "example": "\"pytorch-example\"",
+                        "description": "environment name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "command",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/types.EnvironmentExecRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.EnvironmentExecResponse"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "501": {
+                        "description": "Not Implemented",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{identity_token}/environments/{name}/logs": {
+            "get": {
+                "description": "Get the logs of the environment, which are streamed if follow is set.",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "environment"
+                ],
+                "summary": "Get the logs of the environment.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "\"a332139d39b89a241400013700e665a3\"",
+                        "description": "identity token",
+                        "name": "identity_token",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "example": "\"pytorch-example\"",
+                        "description": "environment name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "stream the logs until the environment stops",
+                        "name": "follow",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "number of the lines from the end",
+                        "name": "tail",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Unauthorized",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
         "/users/{identity_token}/images": {
             "get": {
                 "description": "List the images.",
@@ -378,6 +583,95 @@ const docTemplate = `{
                         "schema": {
                             "$ref": "#/definitions/types.ImageGetResponse"
                         }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/users/{identity_token}/sessions": {
+            "get": {
+                "description": "List the SSH sessions of the user, newest first.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "session"
+                ],
+                "summary": "List the SSH sessions.",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "example": "\"a332139d39b89a241400013700e665a3\"",
+                        "description": "identity token",
+                        "name": "identity_token",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "environment name",
+                        "name": "environment",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "only the connected sessions",
+                        "name": "active",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "list the sessions before the ID",
+                        "name": "before",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "maximum number of the sessions",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.SSHSessionListResponse"
+                        }
+                    },
+                    "429": {
+                        "description": "Too Many Requests",
+                        "schema": {
+                            "$ref": "#/definitions/types.ErrorResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/version": {
+            "get": {
+                "description": "Get the version of the server and the supported API versions.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "root"
+                ],
+                "summary": "Show the version of the server.",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/types.VersionResponse"
+                        }
                     }
                 }
             }
@@ -584,6 +878,32 @@ const docTemplate = `{
                 }
             }
         },
+        "types.Cluster": {
+            "type": "object",
+            "properties": {
+                "labels": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "name": {
+                    "type": "string",
+                    "example": "gpu-a100"
+                }
+            }
+        },
+        "types.ClusterListResponse": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.Cluster"
+                    }
+                }
+            }
+        },
         "types.Environment": {
             "type": "object",
             "properties": {
@@ -639,6 +959,42 @@ const docTemplate = `{
                 }
             }
         },
+        "types.EnvironmentExecRequest": {
+            "type": "object",
+            "properties": {
+                "cmd": {
+                    "description": "Cmd runs without the stdin and the TTY.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    },
+                    "example": [
+                        "nvidia-smi"
+                    ]
+                }
+            }
+        },
+        "types.EnvironmentExecResponse": {
+            "type": "object",
+            "properties": {
+                "exit_code": {
+                    "type": "integer"
+                },
+                "stderr": {
+                    "type": "string"
+                },
+                "stderr_truncated": {
+                    "type": "boolean"
+                },
+                "stdout": {
+                    "type": "string"
+                },
+                "stdout_truncated": {
+                    "description": "StdoutTruncated is true if the stdout is longer than the server\nkeeps, and only the beginning of it is returned.",
+                    "type": "boolean"
+                }
+            }
+        },
         "types.EnvironmentGetResponse": {
             "type": "object",
             "properties": {
@@ -687,6 +1043,16 @@ const docTemplate = `{
         "types.EnvironmentSpec": {
             "type": "object",
             "properties": {
+                "cluster": {
+                    "description": "Cluster is the name of the cluster of the environment. The server\nchooses one of the clusters matching the selector if it is empty.",
+                    "type": "string"
+                },
+                "cluster_selector": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
                 "cmd": {
                     "type": "array",
                     "items": {
@@ -710,6 +1076,10 @@ const docTemplate = `{
                     "items": {
                         "$ref": "#/definitions/types.EnvironmentPort"
                     }
+                },
+                "ssh_policy": {
+                    "description": "SSHPolicy is the name of the server SSH policy which restricts the\nsessions, e.g. forwarding, in the environment.",
+                    "type": "string"
                 }
             }
         },
@@ -727,6 +1097,31 @@ const docTemplate = `{
                 }
             }
         },
+        "types.ErrorResponse": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Code is the class of the error, see the Code* constants in errdefs.",
+                    "type": "string",
+                    "example": "not_found"
+                },
+                "details": {
+                    "description": "Details are the optional key-value pairs to help debugging,\ne.g. the reason returned by Kubernetes.",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "message": {
+                    "type": "string",
+                    "example": "environment pytorch-example is not found"
+                },
+                "request_id": {
+                    "description": "RequestID is the ID of the failed request, same as the\nX-Request-Id header.",
+                    "type": "string"
+                }
+            }
+        },
         "types.ImageGetResponse": {
             "type": "object",
             "properties": {
@@ -785,6 +1180,119 @@ const docTemplate = `{
                     "type": "integer"
                 }
             }
+        },
+        "types.SSHSession": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "description": "Active is true until the connection is closed.",
+                    "type": "boolean"
+                },
+                "bytes_in": {
+                    "description": "BytesIn and BytesOut are the bytes from and to the client.",
+                    "type": "integer"
+                },
+                "bytes_out": {
+                    "type": "integer"
+                },
+                "connection_id": {
+                    "type": "string"
+                },
+                "ended_at": {
+                    "type": "string"
+                },
+                "environment": {
+                    "type": "string",
+                    "example": "pytorch-example"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_activity_at": {
+                    "type": "string"
+                },
+                "owner": {
+                    "type": "string"
+                },
+                "source_address": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.SSHSessionEvent": {
+            "type": "object",
+            "properties": {
+                "bytesIn": {
+                    "description": "BytesIn and BytesOut are the total bytes of the connection.",
+                    "type": "integer"
+                },
+                "bytesOut": {
+                    "type": "integer"
+                },
+                "connectionId": {
+                    "type": "string"
+                },
+                "remoteAddress": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string",
+                    "example": "activity"
+                },
+                "username": {
+                    "description": "Username and RemoteAddress are required by the connect event.",
+                    "type": "string"
+                }
+            }
+        },
+        "types.SSHSessionListResponse": {
+            "type": "object",
+            "properties": {
+                "items": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.SSHSession"
+                    }
+                }
+            }
+        },
+        "types.VersionResponse": {
+            "type": "object",
+            "properties": {
+                "api_version": {
+                    "description": "APIVersion is the highest API version supported by the server.",
+                    "type": "string",
+                    "example": "v1"
+                },
+                "build_date": {
+                    "type": "string",
+                    "example": "2022-11-01T00:00:00Z"
+                },
+                "git_commit": {
+                    "type": "string"
+                },
+                "go_version": {
+                    "type": "string",
+                    "example": "go1.19.3"
+                },
+                "min_api_version": {
+                    "description": "MinAPIVersion is the lowest API version supported by the server.",
+                    "type": "string",
+                    "example": "v1"
+                },
+                "platform": {
+                    "type": "string",
+                    "example": "linux/amd64"
+                },
+                "version": {
+                    "description": "Version of the server build.",
+                    "type": "string",
+                    "example": "v0.0.9"
+                }
+            }
         }
     }
 }`
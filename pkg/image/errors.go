@@ -0,0 +1,43 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package image
+
+import (
+	"io/fs"
+
+	"github.com/cockroachdb/errors"
+	"github.com/containers/image/v5/docker"
+	"github.com/docker/distribution/registry/api/errcode"
+
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+// classifyError converts the registry errors to the errdefs classes, so that
+// the server can respond with the matching status code.
+func classifyError(err error) error {
+	if err == nil || errdefs.Code(err) != errdefs.CodeUnknown {
+		return err
+	}
+
+	var unauthorized docker.ErrUnauthorizedForCredentials
+	var coder errcode.ErrorCoder
+	var errs errcode.Errors
+	switch {
+	case errors.As(err, &unauthorized):
+		return errdefs.Unauthorized(err)
+	case errors.Is(err, fs.ErrNotExist):
+		// The local images are missing.
+		return errdefs.NotFound(err)
+	case errors.Is(err, docker.ErrTooManyRequests):
+		return errdefs.Unavailable(err)
+	case errors.As(err, &errs) && len(errs) > 0:
+		if c, ok := errs[0].(errcode.ErrorCoder); ok {
+			return errdefs.FromStatusCode(err, c.ErrorCode().Descriptor().HTTPStatusCode)
+		}
+	case errors.As(err, &coder):
+		return errdefs.FromStatusCode(err, coder.ErrorCode().Descriptor().HTTPStatusCode)
+	}
+	return errdefs.System(err)
+}
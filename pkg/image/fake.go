@@ -0,0 +1,48 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package image
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+// Fake is the fetcher of the images pushed to it, for the tests.
+type Fake struct {
+	mu     sync.Mutex
+	images map[string]types.ImageMeta
+}
+
+func NewFake(images ...types.ImageMeta) *Fake {
+	f := &Fake{images: make(map[string]types.ImageMeta)}
+	for _, meta := range images {
+		f.Push(meta)
+	}
+	return f
+}
+
+// Push adds the image, or replaces the one with the same name.
+func (f *Fake) Push(meta types.ImageMeta) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.images[meta.Name] = meta
+}
+
+// FetchMetadata returns the metadata of the image, or the not found error
+// as the registries.
+func (f *Fake) FetchMetadata(_ context.Context, imageName string) (types.ImageMeta, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	meta, ok := f.images[imageName]
+	if !ok {
+		return types.ImageMeta{}, errdefs.NotFound(errors.Newf("image %s not found", imageName))
+	}
+	return meta, nil
+}
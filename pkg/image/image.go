@@ -6,39 +6,106 @@ package image
 
 import (
 	"context"
-	"fmt"
+	"strings"
+	"time"
 
-	"github.com/containers/image/v5/docker"
+	"github.com/cockroachdb/errors"
 	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/manifest"
 	containertypes "github.com/containers/image/v5/types"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/metrics"
+	"github.com/tensorchord/envd-server/pkg/tracing"
 )
 
-// TODO(gaocegege): Support image registry auth.
-func FetchMetadata(ctx context.Context, imageName string) (
+const (
+	// TransportOCILayout and TransportDockerArchive are the prefixes of
+	// the local images, e.g. oci:mnist:dev.
+	TransportOCILayout     = "oci"
+	TransportDockerArchive = "docker-archive"
+)
+
+// Fetcher fetches the metadata of the images of the environments.
+type Fetcher interface {
+	FetchMetadata(ctx context.Context, imageName string) (types.ImageMeta, error)
+}
+
+// New returns the fetcher of the images in the registries, and of the
+// oci: and docker-archive: images under the local dir if it is set.
+func New(cfg config.RegistryConfig) Fetcher {
+	t := transports{remote: NewRemote(cfg.Mirrors, cfg.Insecure)}
+	if cfg.LocalDir != "" {
+		t.ociLayout = NewOCILayout(cfg.LocalDir)
+		t.dockerArchive = NewDockerArchive(cfg.LocalDir)
+	}
+	return t
+}
+
+// transports selects the fetcher by the transport prefix of the image.
+type transports struct {
+	remote Fetcher
+	// ociLayout and dockerArchive are nil if the local images are
+	// disabled.
+	ociLayout     Fetcher
+	dockerArchive Fetcher
+}
+
+func (t transports) FetchMetadata(ctx context.Context, imageName string) (
 	meta types.ImageMeta, err error) {
-	ref, err := docker.ParseReference(fmt.Sprintf("//%s", imageName))
-	if err != nil {
-		return
+	ctx, span := tracing.Tracer().Start(ctx, "image.FetchMetadata")
+	span.SetAttributes(attribute.String("image.name", imageName))
+	defer func(start time.Time) {
+		err = classifyError(err)
+		metrics.ImageMetadataFetchDuration.WithLabelValues(metrics.Result(err)).
+			Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+	}(time.Now())
+
+	var fetcher Fetcher
+	switch transport, _, _ := strings.Cut(imageName, ":"); transport {
+	case TransportOCILayout:
+		fetcher = t.ociLayout
+	case TransportDockerArchive:
+		fetcher = t.dockerArchive
+	default:
+		return t.remote.FetchMetadata(ctx, imageName)
 	}
-	sys := &containertypes.SystemContext{}
+	if fetcher == nil {
+		return meta, errdefs.InvalidParameter(errors.Newf(
+			"the local images are disabled, failed to fetch %s", imageName))
+	}
+	return fetcher.FetchMetadata(ctx, imageName)
+}
+
+// fetch reads the metadata of the image in the source of the reference.
+func fetch(ctx context.Context, sys *containertypes.SystemContext,
+	ref containertypes.ImageReference, imageName string) (types.ImageMeta, error) {
 	src, err := ref.NewImageSource(ctx, sys)
 	if err != nil {
-		return
+		return types.ImageMeta{}, classifyError(err)
+	}
+	defer src.Close()
+	blob, _, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return types.ImageMeta{}, classifyError(err)
 	}
-	digest, err := docker.GetDigest(ctx, sys, ref)
+	digest, err := manifest.Digest(blob)
 	if err != nil {
-		return
+		return types.ImageMeta{}, errors.Wrap(err, "failed to digest the manifest")
 	}
-	image, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, &digest))
+	// The instance of the platform is chosen if it is a manifest list.
+	img, err := image.FromUnparsedImage(ctx, sys, image.UnparsedInstance(src, nil))
 	if err != nil {
-		return
+		return types.ImageMeta{}, classifyError(err)
 	}
-	inspect, err := image.Inspect(ctx)
+	inspect, err := img.Inspect(ctx)
 	if err != nil {
-		return
+		return types.ImageMeta{}, classifyError(err)
 	}
 
 	// correct the image size
@@ -47,14 +114,17 @@ func FetchMetadata(ctx context.Context, imageName string) (
 		size += layer.Size
 	}
 
-	meta = types.ImageMeta{
+	var created int64
+	if inspect.Created != nil {
+		created = inspect.Created.Unix()
+	}
+	meta := types.ImageMeta{
 		Name:    imageName,
-		Created: inspect.Created.Unix(),
+		Created: created,
 		Digest:  string(digest),
 		Labels:  inspect.Labels,
 		Size:    size,
 	}
 	logrus.WithField("image meta", meta).Debug("get image meta before creating env")
-	src.Close()
 	return meta, nil
 }
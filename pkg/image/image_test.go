@@ -0,0 +1,298 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+)
+
+var testLabels = map[string]string{"ai.tensorchord.envd.ports": "[]"}
+
+// testImage is an image of one empty layer with the test labels.
+type testImage struct {
+	config, manifest, layer []byte
+}
+
+func newTestImage(t *testing.T) testImage {
+	var layer bytes.Buffer
+	if err := tar.NewWriter(&layer).Close(); err != nil {
+		t.Fatal(err)
+	}
+	img := testImage{layer: layer.Bytes()}
+	img.config = []byte(fmt.Sprintf(`{"created": "2022-10-15T08:00:00Z",
+"architecture": "amd64", "os": "linux",
+"config": {"Labels": {"ai.tensorchord.envd.ports": "[]"}},
+"rootfs": {"type": "layers", "diff_ids": [%q]}}`, digestOf(img.layer)))
+	img.manifest = []byte(fmt.Sprintf(`{"schemaVersion": 2,
+"mediaType": "application/vnd.oci.image.manifest.v1+json",
+"config": {"mediaType": "application/vnd.oci.image.config.v1+json", "digest": %q, "size": %d},
+"layers": [{"mediaType": "application/vnd.oci.image.layer.v1.tar", "digest": %q, "size": %d}]}`,
+		digestOf(img.config), len(img.config), digestOf(img.layer), len(img.layer)))
+	return img
+}
+
+func digestOf(data []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+}
+
+// writeOCILayout writes the image with the tag in the layout of the dir,
+// and the name in the containerd annotation if it is not empty.
+func (img testImage) writeOCILayout(t *testing.T, dir, tag, name string) {
+	blobs := filepath.Join(dir, "blobs", "sha256")
+	if err := os.MkdirAll(blobs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	annotations := map[string]string{"org.opencontainers.image.ref.name": tag}
+	if name != "" {
+		annotations["io.containerd.image.name"] = name
+	}
+	data, _ := json.Marshal(annotations)
+	index := fmt.Sprintf(`{"schemaVersion": 2, "manifests": [{
+"mediaType": "application/vnd.oci.image.manifest.v1+json", "digest": %q, "size": %d,
+"annotations": %s}]}`,
+		digestOf(img.manifest), len(img.manifest), data)
+	files := map[string][]byte{
+		filepath.Join(dir, "oci-layout"): []byte(`{"imageLayoutVersion": "1.0.0"}`),
+		filepath.Join(dir, "index.json"): []byte(index),
+	}
+	for _, blob := range [][]byte{img.config, img.manifest, img.layer} {
+		files[filepath.Join(blobs, strings.TrimPrefix(digestOf(blob), "sha256:"))] = blob
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeDockerArchive writes the image tagged as the reference in the
+// tarball of docker save.
+func (img testImage) writeDockerArchive(t *testing.T, path, ref string) {
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	manifest := fmt.Sprintf(`[{"Config": "config.json", "RepoTags": [%q], "Layers": ["layer.tar"]}]`, ref)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "manifest.json", data: []byte(manifest)},
+		{name: "config.json", data: img.config},
+		{name: "layer.tar", data: img.layer},
+	} {
+		if err := w.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serveRegistry serves the image as mnist:dev in the registry API over
+// plain HTTP.
+func (img testImage) serveRegistry() *httptest.Server {
+	blobs := map[string][]byte{
+		digestOf(img.config): img.config,
+		digestOf(img.layer):  img.layer,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/library/mnist/manifests/dev":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			w.Header().Set("Docker-Content-Digest", digestOf(img.manifest))
+			w.Write(img.manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/library/mnist/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(r.URL.Path, "/v2/library/mnist/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write(blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestLocal(t *testing.T) {
+	img := newTestImage(t)
+	dir := t.TempDir()
+	img.writeOCILayout(t, filepath.Join(dir, "mnist"), "dev", "mnist:dev")
+	img.writeOCILayout(t, filepath.Join(dir, "bert"), "ghcr.io/envd/bert:dev", "")
+	img.writeOCILayout(t, filepath.Join(dir, "gpt"), "dev", "")
+	img.writeDockerArchive(t, filepath.Join(dir, "mnist.tar"), "mnist:dev")
+	fetcher := New(config.RegistryConfig{LocalDir: dir})
+
+	// The name is the reference to run the image by.
+	tcs := []struct {
+		image          string
+		expectedName   string
+		expectedDigest string
+		expectedErr    func(error) bool
+	}{
+		{image: "oci:mnist:dev", expectedName: "docker.io/library/mnist:dev", expectedDigest: digestOf(img.manifest)},
+		{image: "oci:mnist", expectedName: "docker.io/library/mnist:dev"},
+		{image: "oci:bert:ghcr.io/envd/bert:dev", expectedName: "ghcr.io/envd/bert:dev"},
+		{image: "oci:gpt:dev", expectedErr: errdefs.IsInvalidParameter},
+		{image: "oci:mnist:latest", expectedErr: func(err error) bool { return err != nil }},
+		{image: "oci:llama:dev", expectedErr: errdefs.IsNotFound},
+		{image: "oci:../mnist:dev", expectedErr: errdefs.IsInvalidParameter},
+		{image: "oci:/etc:dev", expectedErr: errdefs.IsInvalidParameter},
+		{image: "docker-archive:mnist.tar", expectedName: "docker.io/library/mnist:dev"},
+		{image: "docker-archive:mnist.tar:mnist:dev", expectedName: "docker.io/library/mnist:dev"},
+		{image: "docker-archive:bert.tar", expectedErr: errdefs.IsNotFound},
+	}
+	for _, tc := range tcs {
+		meta, err := fetcher.FetchMetadata(context.Background(), tc.image)
+		if tc.expectedErr != nil {
+			if !tc.expectedErr(err) {
+				t.Errorf("Expected the error of %s, got %v", tc.image, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Expected the metadata of %s, got %v", tc.image, err)
+			continue
+		}
+		if meta.Name != tc.expectedName || !reflect.DeepEqual(meta.Labels, testLabels) ||
+			meta.Created != 1665820800 || meta.Size != int64(len(img.layer)) {
+			t.Errorf("Expected the metadata of %s, got %+v", tc.image, meta)
+		}
+		if tc.expectedDigest != "" && meta.Digest != tc.expectedDigest {
+			t.Errorf("Expected digest %s of %s, got %s", tc.expectedDigest, tc.image, meta.Digest)
+		}
+	}
+
+	// The local images are disabled without the dir.
+	_, err := New(config.RegistryConfig{}).FetchMetadata(context.Background(), "oci:mnist:dev")
+	if !errdefs.IsInvalidParameter(err) {
+		t.Errorf("Expected the local images disabled, got %v", err)
+	}
+}
+
+func TestRemote(t *testing.T) {
+	img := newTestImage(t)
+	srv := img.serveRegistry()
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	tcs := []struct {
+		cfg         config.RegistryConfig
+		image       string
+		expectedErr bool
+	}{
+		{
+			cfg:   config.RegistryConfig{Insecure: []string{host}},
+			image: host + "/library/mnist:dev",
+		},
+		{
+			// The registry is not reached over plain HTTP.
+			cfg:         config.RegistryConfig{},
+			image:       host + "/library/mnist:dev",
+			expectedErr: true,
+		},
+		{
+			cfg: config.RegistryConfig{
+				Mirrors:  map[string][]string{"docker.io": {"mirror.invalid", host}},
+				Insecure: []string{host},
+			},
+			image: "mnist:dev",
+		},
+	}
+	for i, tc := range tcs {
+		meta, err := New(tc.cfg).FetchMetadata(context.Background(), tc.image)
+		if tc.expectedErr != (err != nil) {
+			t.Errorf("Expected error %v in case %d, got %v", tc.expectedErr, i, err)
+			continue
+		}
+		if tc.expectedErr {
+			continue
+		}
+		if meta.Name != tc.image || meta.Digest != digestOf(img.manifest) ||
+			!reflect.DeepEqual(meta.Labels, testLabels) {
+			t.Errorf("Expected the metadata of %s in case %d, got %+v", tc.image, i, meta)
+		}
+	}
+}
+
+func TestMirrorNames(t *testing.T) {
+	r := NewRemote(map[string][]string{
+		"docker.io":  {"mirror.gcr.io", "registry.local:5000/docker"},
+		"quay.io":    {"quay.local"},
+		"ghcr.io":    {"INVALID"},
+		"example.io": nil,
+	}, nil)
+
+	tcs := []struct {
+		image    string
+		expected []string
+	}{
+		{
+			image:    "mnist",
+			expected: []string{"mirror.gcr.io/library/mnist:latest", "registry.local:5000/docker/library/mnist:latest"},
+		},
+		{
+			image: "tensorchord/mnist@sha256:" + strings.Repeat("a", 64),
+			expected: []string{
+				"mirror.gcr.io/tensorchord/mnist@sha256:" + strings.Repeat("a", 64),
+				"registry.local:5000/docker/tensorchord/mnist@sha256:" + strings.Repeat("a", 64),
+			},
+		},
+		{image: "quay.io/envd/mnist:dev", expected: []string{"quay.local/envd/mnist:dev"}},
+		{image: "ghcr.io/envd/mnist:dev", expected: nil},
+		{image: "example.io/mnist:dev", expected: nil},
+	}
+	for _, tc := range tcs {
+		named, err := reference.ParseNormalizedNamed(tc.image)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, n := range r.mirrorNames(reference.TagNameOnly(named)) {
+			names = append(names, n.String())
+		}
+		if !reflect.DeepEqual(names, tc.expected) {
+			t.Errorf("Expected the mirrors %v of %s, got %v", tc.expected, tc.image, names)
+		}
+	}
+}
+
+func TestFake(t *testing.T) {
+	f := NewFake(types.ImageMeta{Name: "mnist:dev", Labels: testLabels})
+	var fetcher Fetcher = f
+	if meta, err := fetcher.FetchMetadata(context.Background(), "mnist:dev"); err != nil ||
+		!reflect.DeepEqual(meta.Labels, testLabels) {
+		t.Errorf("Expected the pushed image, got %+v, %v", meta, err)
+	}
+	if _, err := fetcher.FetchMetadata(context.Background(), "bert:dev"); !errdefs.IsNotFound(err) {
+		t.Errorf("Expected the not found error, got %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/containers/image/v5/docker/archive"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/oci/layout"
+	containertypes "github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+// annotationImageName is the name of the image in the index of the OCI
+// layout, written by containerd and buildkit.
+const annotationImageName = "io.containerd.image.name"
+
+// The runtimes cannot pull the local images, so the name of the metadata
+// is the reference the image is recorded with, e.g. by docker save, which
+// must be loaded on the nodes or in the docker daemon.
+
+// OCILayout fetches the oci:<path>[:<tag>] images, in the OCI layout
+// directories of the paths under the dir.
+type OCILayout struct {
+	dir string
+}
+
+func NewOCILayout(dir string) *OCILayout {
+	return &OCILayout{dir: dir}
+}
+
+func (l *OCILayout) FetchMetadata(ctx context.Context, imageName string) (types.ImageMeta, error) {
+	path, tag, err := localPath(l.dir, TransportOCILayout, imageName)
+	if err != nil {
+		return types.ImageMeta{}, err
+	}
+	ref, err := layout.NewReference(path, tag)
+	if err != nil {
+		return types.ImageMeta{}, errdefs.InvalidParameter(err)
+	}
+	meta, err := fetch(ctx, &containertypes.SystemContext{}, ref, imageName)
+	if err != nil {
+		return meta, err
+	}
+	if meta.Name, err = ociImageName(path, tag); err != nil {
+		return types.ImageMeta{}, errors.Wrapf(err, "failed to get the name of image %s", imageName)
+	}
+	return meta, nil
+}
+
+// ociImageName returns the name of the image with the tag in the index of
+// the layout, which is the containerd annotation, or the reference name if
+// it is a full reference instead of a tag.
+func ociImageName(path, tag string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(path, "index.json"))
+	if err != nil {
+		return "", err
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(data, &index); err != nil {
+		return "", errors.Wrap(err, "failed to decode the index")
+	}
+	for _, d := range index.Manifests {
+		refName := d.Annotations[imgspecv1.AnnotationRefName]
+		if tag != "" && refName != tag || tag == "" && len(index.Manifests) != 1 {
+			continue
+		}
+		if name := d.Annotations[annotationImageName]; name != "" {
+			named, err := reference.ParseNormalizedNamed(name)
+			if err != nil {
+				return "", errdefs.InvalidParameter(errors.Wrapf(err, "invalid image name %s", name))
+			}
+			return named.String(), nil
+		}
+		if named, err := reference.ParseNamed(refName); err == nil {
+			return named.String(), nil
+		}
+	}
+	return "", errdefs.InvalidParameter(errors.Newf(
+		"the index does not have the %s annotation or a full %s",
+		annotationImageName, imgspecv1.AnnotationRefName))
+}
+
+// DockerArchive fetches the docker-archive:<path>[:<reference>] images,
+// in the tarballs of docker save under the dir.
+type DockerArchive struct {
+	dir string
+}
+
+func NewDockerArchive(dir string) *DockerArchive {
+	return &DockerArchive{dir: dir}
+}
+
+func (a *DockerArchive) FetchMetadata(ctx context.Context, imageName string) (types.ImageMeta, error) {
+	path, ref, err := localPath(a.dir, TransportDockerArchive, imageName)
+	if err != nil {
+		return types.ImageMeta{}, err
+	}
+	if ref != "" {
+		path += ":" + ref
+	}
+	archiveRef, err := archive.ParseReference(path)
+	if err != nil {
+		return types.ImageMeta{}, errdefs.InvalidParameter(err)
+	}
+	sys := &containertypes.SystemContext{}
+	meta, err := fetch(ctx, sys, archiveRef, imageName)
+	if err != nil {
+		return meta, err
+	}
+	if meta.Name, err = archiveImageName(sys, archiveRef); err != nil {
+		return types.ImageMeta{}, errors.Wrapf(err, "failed to get the name of image %s", imageName)
+	}
+	return meta, nil
+}
+
+// archiveImageName returns the first repo tag of the image in the
+// tarball.
+func archiveImageName(sys *containertypes.SystemContext, ref containertypes.ImageReference) (string, error) {
+	reader, readerRef, err := archive.NewReaderForReference(sys, ref)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+	tags, err := reader.ManifestTagsForReference(readerRef)
+	if err != nil {
+		return "", err
+	}
+	if len(tags) == 0 {
+		return "", errdefs.InvalidParameter(errors.New("the image is saved without the repo tags"))
+	}
+	named, err := reference.ParseNormalizedNamed(tags[0])
+	if err != nil {
+		return "", errdefs.InvalidParameter(errors.Wrapf(err, "invalid repo tag %s", tags[0]))
+	}
+	return named.String(), nil
+}
+
+// localPath returns the path under the dir and the reference in it, of
+// the image with the transport prefix. The paths out of the dir are
+// rejected.
+func localPath(dir, transport, imageName string) (string, string, error) {
+	name := strings.TrimPrefix(imageName, transport+":")
+	path, ref, _ := strings.Cut(name, ":")
+	clean := filepath.Clean(path)
+	if path == "" || filepath.IsAbs(clean) ||
+		clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", "", errdefs.InvalidParameter(errors.Newf(
+			"image %s must be a relative path in the local dir", imageName))
+	}
+	return filepath.Join(dir, clean), ref, nil
+}
@@ -0,0 +1,91 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package image
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	containertypes "github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+)
+
+// Remote fetches the images in the registries, from the mirrors first.
+// TODO(gaocegege): Support image registry auth.
+type Remote struct {
+	mirrors  map[string][]string
+	insecure map[string]bool
+}
+
+// NewRemote returns the fetcher of the registries. The mirrors are keyed by
+// the registries, and the insecure registries are accessed without
+// verifying the certificates, or with plain HTTP.
+func NewRemote(mirrors map[string][]string, insecure []string) *Remote {
+	r := &Remote{mirrors: mirrors, insecure: make(map[string]bool)}
+	for _, registry := range insecure {
+		r.insecure[registry] = true
+	}
+	return r
+}
+
+func (r *Remote) FetchMetadata(ctx context.Context, imageName string) (types.ImageMeta, error) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return types.ImageMeta{}, errdefs.InvalidParameter(err)
+	}
+	named = reference.TagNameOnly(named)
+	for _, mirror := range r.mirrorNames(named) {
+		meta, err := r.fetch(ctx, mirror, imageName)
+		if err == nil {
+			return meta, nil
+		}
+		logrus.WithError(err).WithField("mirror", mirror.String()).
+			Warnf("failed to fetch image %s from the mirror", imageName)
+	}
+	return r.fetch(ctx, named, imageName)
+}
+
+// mirrorNames returns the names of the image in the mirrors of the
+// registry.
+func (r *Remote) mirrorNames(named reference.Named) []reference.Named {
+	var names []reference.Named
+	for _, mirror := range r.mirrors[reference.Domain(named)] {
+		name := mirror + "/" + reference.Path(named)
+		if tagged, ok := named.(reference.Tagged); ok {
+			name += ":" + tagged.Tag()
+		}
+		if digested, ok := named.(reference.Digested); ok {
+			name += "@" + digested.Digest().String()
+		}
+		m, err := reference.ParseNormalizedNamed(name)
+		if err != nil {
+			logrus.WithError(err).Warnf("invalid mirror %s", mirror)
+			continue
+		}
+		names = append(names, m)
+	}
+	return names
+}
+
+func (r *Remote) fetch(ctx context.Context, named reference.Named, imageName string) (types.ImageMeta, error) {
+	ref, err := docker.NewReference(named)
+	if err != nil {
+		return types.ImageMeta{}, errdefs.InvalidParameter(err)
+	}
+	sys := &containertypes.SystemContext{}
+	if r.insecure[reference.Domain(named)] {
+		sys.DockerInsecureSkipTLSVerify = containertypes.OptionalBoolTrue
+	}
+	meta, err := fetch(ctx, sys, ref, imageName)
+	if err != nil {
+		return meta, errors.Wrapf(err, "failed to fetch %s", named)
+	}
+	return meta, nil
+}
@@ -0,0 +1,241 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package leader runs the background tasks on one of the replicas only,
+// which is elected with a Kubernetes Lease.
+package leader
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/tensorchord/envd-server/pkg/metrics"
+)
+
+type Opt struct {
+	// Enabled is false if there is only one replica, then the tasks
+	// run without the election.
+	Enabled       bool
+	Namespace     string
+	LeaseName     string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+// Task is the background work which must run on one replica only,
+// e.g. reapers and reconcilers. It should return when the context is done.
+type Task struct {
+	Name string
+	Run  func(ctx context.Context)
+}
+
+// Elector runs the registered tasks while it is the leader.
+type Elector struct {
+	client   kubernetes.Interface
+	opt      Opt
+	identity string
+
+	mu     sync.RWMutex
+	tasks  []Task
+	leader string
+
+	isLeader int32
+	watchDog *leaderelection.HealthzAdaptor
+}
+
+// New creates the elector. The identity is the pod name if the POD_NAME
+// environment variable is set, or the hostname, with a random suffix.
+func New(client kubernetes.Interface, opt Opt) *Elector {
+	name := os.Getenv("POD_NAME")
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	return &Elector{
+		client:   client,
+		opt:      opt,
+		identity: name + "_" + uuid.NewString(),
+		// Fail the health check if the leader cannot renew the lease
+		// for a while after it expires.
+		watchDog: leaderelection.NewLeaderHealthzAdaptor(opt.LeaseDuration),
+	}
+}
+
+// Register adds the task. It must be called before Run.
+func (e *Elector) Register(name string, run func(ctx context.Context)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tasks = append(e.tasks, Task{Name: name, Run: run})
+}
+
+// Run takes part in the election until the context is done, and runs the
+// tasks whenever it becomes the leader. It returns after the tasks stop.
+func (e *Elector) Run(ctx context.Context) {
+	if !e.opt.Enabled {
+		// The replica is the leader until it stops, even if the tasks
+		// return earlier.
+		e.setLeader(e.identity)
+		e.runTasks(ctx)
+		<-ctx.Done()
+		e.setNotLeader()
+		return
+	}
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      e.opt.LeaseName,
+			Namespace: e.opt.Namespace,
+		},
+		Client: e.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: e.identity,
+		},
+	}
+	logger := logrus.WithFields(logrus.Fields{
+		"identity": e.identity,
+		"lease":    e.opt.Namespace + "/" + e.opt.LeaseName,
+	})
+	// Join the election again after losing the leadership, since the
+	// replica keeps serving the requests.
+	for ctx.Err() == nil {
+		r := &round{}
+		le, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			Name:            e.opt.LeaseName,
+			LeaseDuration:   e.opt.LeaseDuration,
+			RenewDeadline:   e.opt.RenewDeadline,
+			RetryPeriod:     e.opt.RetryPeriod,
+			ReleaseOnCancel: true,
+			WatchDog:        e.watchDog,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					if !r.start() {
+						return
+					}
+					defer r.wg.Done()
+					logger.Info("started leading")
+					metrics.LeaderTransitions.Inc()
+					e.runTasks(ctx)
+				},
+				OnStoppedLeading: func() {
+					if atomic.LoadInt32(&e.isLeader) == 1 {
+						logger.Info("stopped leading")
+					}
+					e.setNotLeader()
+				},
+				OnNewLeader: func(identity string) {
+					logger.WithField("leader", identity).Info("new leader elected")
+					e.setLeader(identity)
+				},
+			},
+		})
+		if err != nil {
+			logger.WithError(err).Error("invalid leader election config")
+			return
+		}
+		le.Run(ctx)
+		// OnStartedLeading is called in a goroutine, which may still
+		// be running the tasks after Run returns.
+		r.stop()
+		e.setNotLeader()
+	}
+}
+
+// round is one term of the election. The tasks must not start after
+// the term ends.
+type round struct {
+	mu      sync.Mutex
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+func (r *round) start() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return false
+	}
+	r.wg.Add(1)
+	return true
+}
+
+// stop waits for the tasks started in the term.
+func (r *round) stop() {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+	r.wg.Wait()
+}
+
+func (e *Elector) setNotLeader() {
+	atomic.StoreInt32(&e.isLeader, 0)
+	metrics.IsLeader.Set(0)
+}
+
+// runTasks runs the tasks and waits for them to return.
+func (e *Elector) runTasks(ctx context.Context) {
+	atomic.StoreInt32(&e.isLeader, 1)
+	metrics.IsLeader.Set(1)
+
+	e.mu.RLock()
+	tasks := e.tasks
+	e.mu.RUnlock()
+	var wg sync.WaitGroup
+	for _, t := range tasks {
+		wg.Add(1)
+		go func(t Task) {
+			defer wg.Done()
+			logrus.WithField("task", t.Name).Debug("starting the leader task")
+			t.Run(ctx)
+			logrus.WithField("task", t.Name).Debug("leader task stopped")
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (e *Elector) setLeader(identity string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leader = identity
+}
+
+// IsLeader returns true if the tasks are running on this replica.
+func (e *Elector) IsLeader() bool {
+	return atomic.LoadInt32(&e.isLeader) == 1
+}
+
+// Leader returns the identity of the last observed leader.
+func (e *Elector) Leader() string {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.leader
+}
+
+func (e *Elector) Identity() string {
+	return e.identity
+}
+
+func (e *Elector) Enabled() bool {
+	return e.opt.Enabled
+}
+
+// Check returns an error if this replica is the leader but fails to
+// renew the lease.
+func (e *Elector) Check() error {
+	if !e.opt.Enabled {
+		return nil
+	}
+	return e.watchDog.Check(&http.Request{})
+}
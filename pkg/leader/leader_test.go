@@ -0,0 +1,146 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package leader
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func testOpt() Opt {
+	return Opt{
+		Enabled:       true,
+		Namespace:     "default",
+		LeaseName:     "envd-server",
+		LeaseDuration: time.Second,
+		RenewDeadline: 500 * time.Millisecond,
+		RetryPeriod:   100 * time.Millisecond,
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool, msg string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %s", msg)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestElectorDisabled(t *testing.T) {
+	e := New(fake.NewSimpleClientset(), Opt{})
+	var running int32
+	e.Register("test", func(ctx context.Context) {
+		atomic.StoreInt32(&running, 1)
+		<-ctx.Done()
+		atomic.StoreInt32(&running, 0)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	waitFor(t, func() bool { return atomic.LoadInt32(&running) == 1 }, "the task to run")
+	if !e.IsLeader() || e.Leader() != e.Identity() {
+		t.Errorf("Expected the replica to be the leader without the election")
+	}
+	if err := e.Check(); err != nil {
+		t.Errorf("Expected no health check error, got %v", err)
+	}
+	cancel()
+	<-done
+	if atomic.LoadInt32(&running) != 0 {
+		t.Errorf("Expected the task to stop when Run returns")
+	}
+}
+
+func TestElectorDisabledTaskReturned(t *testing.T) {
+	e := New(fake.NewSimpleClientset(), Opt{})
+	var ran int32
+	e.Register("once", func(context.Context) { atomic.StoreInt32(&ran, 1) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		e.Run(ctx)
+		close(done)
+	}()
+	waitFor(t, func() bool { return atomic.LoadInt32(&ran) == 1 }, "the task to run")
+	time.Sleep(100 * time.Millisecond)
+	if !e.IsLeader() {
+		t.Errorf("Expected the replica to be the leader until Run returns")
+	}
+	cancel()
+	<-done
+	if e.IsLeader() {
+		t.Errorf("Expected the replica not to be the leader after Run returns")
+	}
+}
+
+func TestElectorFailover(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	var running [2]int32
+	var electors [2]*Elector
+	var cancels [2]context.CancelFunc
+	var dones [2]chan struct{}
+	for i := range electors {
+		i := i
+		electors[i] = New(client, testOpt())
+		electors[i].Register("test", func(ctx context.Context) {
+			atomic.AddInt32(&running[i], 1)
+			<-ctx.Done()
+			atomic.AddInt32(&running[i], -1)
+		})
+		var ctx context.Context
+		ctx, cancels[i] = context.WithCancel(context.Background())
+		dones[i] = make(chan struct{})
+		go func() {
+			electors[i].Run(ctx)
+			close(dones[i])
+		}()
+	}
+	defer func() {
+		for i := range cancels {
+			cancels[i]()
+			<-dones[i]
+		}
+	}()
+
+	waitFor(t, func() bool {
+		return electors[0].IsLeader() || electors[1].IsLeader()
+	}, "one of the replicas to be the leader")
+	first := 0
+	if electors[1].IsLeader() {
+		first = 1
+	}
+	second := 1 - first
+	waitFor(t, func() bool { return atomic.LoadInt32(&running[first]) == 1 },
+		"the task to run on the leader")
+	waitFor(t, func() bool { return electors[second].Leader() == electors[first].Identity() },
+		"the other replica to observe the leader")
+	if electors[second].IsLeader() || atomic.LoadInt32(&running[second]) != 0 {
+		t.Errorf("Expected the task not to run on the other replica")
+	}
+
+	// The lease is released on cancel, then the other replica takes over.
+	cancels[first]()
+	<-dones[first]
+	if atomic.LoadInt32(&running[first]) != 0 {
+		t.Errorf("Expected the task to stop on the old leader")
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&running[second]) == 1 },
+		"the task to run on the new leader")
+	if !electors[second].IsLeader() {
+		t.Errorf("Expected the other replica to be the leader")
+	}
+}
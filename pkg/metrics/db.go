@@ -0,0 +1,45 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/util"
+)
+
+// InstrumentedDB wraps a query.DBTX and records the latency of every query.
+type InstrumentedDB struct {
+	db query.DBTX
+}
+
+func NewInstrumentedDB(db query.DBTX) *InstrumentedDB {
+	return &InstrumentedDB{db: db}
+}
+
+func (i *InstrumentedDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	defer observeQuery(sql, time.Now())
+	return i.db.Exec(ctx, sql, args...)
+}
+
+func (i *InstrumentedDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	defer observeQuery(sql, time.Now())
+	return i.db.Query(ctx, sql, args...)
+}
+
+func (i *InstrumentedDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	defer observeQuery(sql, time.Now())
+	return i.db.QueryRow(ctx, sql, args...)
+}
+
+func observeQuery(sql string, start time.Time) {
+	DBQueryDuration.WithLabelValues(util.QueryName(sql)).
+		Observe(time.Since(start).Seconds())
+}
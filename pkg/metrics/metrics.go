@@ -0,0 +1,141 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "envd_server"
+
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+	ResultError   = "error"
+)
+
+var (
+	HTTPRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "Total number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "code"})
+
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of HTTP requests by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	HTTPRateLimitedTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "rate_limited_total",
+		Help:      "Total number of HTTP requests rejected by the rate limits, by route class.",
+	}, []string{"class"})
+
+	EnvironmentCreateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "environment",
+		Name:      "create_duration_seconds",
+		Help:      "Time spent creating an environment, by result.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"result"})
+
+	EnvironmentCreateFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "environment",
+		Name:      "create_failures_total",
+		Help:      "Total number of failed environment creations, by reason.",
+	}, []string{"reason"})
+
+	EnvironmentRemoveDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "environment",
+		Name:      "remove_duration_seconds",
+		Help:      "Time spent removing an environment, by result.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"result"})
+
+	EnvironmentRemoveFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "environment",
+		Name:      "remove_failures_total",
+		Help:      "Total number of failed environment removals, by reason.",
+	}, []string{"reason"})
+
+	ImageMetadataFetchDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "image",
+		Name:      "metadata_fetch_duration_seconds",
+		Help:      "Latency of fetching the image metadata from the registry, by result.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 12),
+	}, []string{"result"})
+
+	DBQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "db",
+		Name:      "query_duration_seconds",
+		Help:      "Latency of database queries, by query name.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"query"})
+
+	SSHAuthTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ssh",
+		Name:      "auth_total",
+		Help:      "Total number of containerssh webhook authentications, by result.",
+	}, []string{"result"})
+
+	SSHSessionEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "ssh",
+		Name:      "session_events_total",
+		Help:      "Total number of the SSH session events, by type.",
+	}, []string{"type"})
+
+	IsLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "leader_election",
+		Name:      "is_leader",
+		Help:      "Whether this replica is the leader running the background tasks.",
+	})
+
+	LeaderTransitions = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "leader_election",
+		Name:      "transitions_total",
+		Help:      "Total number of times this replica became the leader.",
+	})
+)
+
+// Result returns the result label value for the given error.
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+func init() {
+	prometheus.MustRegister(
+		HTTPRequestsTotal,
+		HTTPRequestDuration,
+		HTTPRateLimitedTotal,
+		EnvironmentCreateDuration,
+		EnvironmentCreateFailures,
+		EnvironmentRemoveDuration,
+		EnvironmentRemoveFailures,
+		ImageMetadataFetchDuration,
+		DBQueryDuration,
+		SSHAuthTotal,
+		SSHSessionEventsTotal,
+		IsLeader,
+		LeaderTransitions,
+	)
+}
@@ -5,9 +5,25 @@
 package query
 
 import (
+	"database/sql"
+	"time"
+
 	"github.com/jackc/pgtype"
 )
 
+type AuditLog struct {
+	ID            int64     `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	RequestID     string    `json:"request_id"`
+	Actor         string    `json:"actor"`
+	Action        string    `json:"action"`
+	TargetType    string    `json:"target_type"`
+	Target        string    `json:"target"`
+	Outcome       string    `json:"outcome"`
+	Message       string    `json:"message"`
+	SourceAddress string    `json:"source_address"`
+}
+
 type ImageInfo struct {
 	ID         int64        `json:"id"`
 	OwnerToken string       `json:"owner_token"`
@@ -18,6 +34,19 @@ type ImageInfo struct {
 	Labels     pgtype.JSONB `json:"labels"`
 }
 
+type SshSession struct {
+	ID             int64        `json:"id"`
+	ConnectionID   string       `json:"connection_id"`
+	OwnerToken     string       `json:"owner_token"`
+	Environment    string       `json:"environment"`
+	SourceAddress  string       `json:"source_address"`
+	StartedAt      time.Time    `json:"started_at"`
+	LastActivityAt time.Time    `json:"last_activity_at"`
+	EndedAt        sql.NullTime `json:"ended_at"`
+	BytesIn        int64        `json:"bytes_in"`
+	BytesOut       int64        `json:"bytes_out"`
+}
+
 type User struct {
 	ID            int64  `json:"id"`
 	IdentityToken string `json:"identity_token"`
@@ -7,10 +7,44 @@ package query
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgtype"
 )
 
+const createAuditLog = `-- name: CreateAuditLog :exec
+INSERT INTO audit_logs (
+  request_id, actor, action, target_type, target, outcome, message, source_address
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+)
+`
+
+type CreateAuditLogParams struct {
+	RequestID     string `json:"request_id"`
+	Actor         string `json:"actor"`
+	Action        string `json:"action"`
+	TargetType    string `json:"target_type"`
+	Target        string `json:"target"`
+	Outcome       string `json:"outcome"`
+	Message       string `json:"message"`
+	SourceAddress string `json:"source_address"`
+}
+
+func (q *Queries) CreateAuditLog(ctx context.Context, arg CreateAuditLogParams) error {
+	_, err := q.db.Exec(ctx, createAuditLog,
+		arg.RequestID,
+		arg.Actor,
+		arg.Action,
+		arg.TargetType,
+		arg.Target,
+		arg.Outcome,
+		arg.Message,
+		arg.SourceAddress,
+	)
+	return err
+}
+
 const createImageInfo = `-- name: CreateImageInfo :one
 INSERT INTO image_info (
   owner_token, name, digest, created, size, labels
@@ -82,6 +116,43 @@ func (q *Queries) DeleteAuthor(ctx context.Context, id int64) error {
 	return err
 }
 
+const endIdleSSHSessions = `-- name: EndIdleSSHSessions :execrows
+UPDATE ssh_sessions
+SET ended_at = last_activity_at
+WHERE ended_at IS NULL AND last_activity_at < $1
+`
+
+func (q *Queries) EndIdleSSHSessions(ctx context.Context, idleSince time.Time) (int64, error) {
+	result, err := q.db.Exec(ctx, endIdleSSHSessions, idleSince)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const endSSHSession = `-- name: EndSSHSession :execrows
+UPDATE ssh_sessions
+SET bytes_in = GREATEST(bytes_in, $1),
+  bytes_out = GREATEST(bytes_out, $2),
+  last_activity_at = now(),
+  ended_at = now()
+WHERE connection_id = $3 AND ended_at IS NULL
+`
+
+type EndSSHSessionParams struct {
+	BytesIn      int64  `json:"bytes_in"`
+	BytesOut     int64  `json:"bytes_out"`
+	ConnectionID string `json:"connection_id"`
+}
+
+func (q *Queries) EndSSHSession(ctx context.Context, arg EndSSHSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, endSSHSession, arg.BytesIn, arg.BytesOut, arg.ConnectionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const getImageInfo = `-- name: GetImageInfo :one
 SELECT id, owner_token, name, digest, created, size, labels FROM image_info
 WHERE owner_token = $1 AND name = $2 LIMIT 1
@@ -119,6 +190,58 @@ func (q *Queries) GetUser(ctx context.Context, identityToken string) (User, erro
 	return i, err
 }
 
+const listAuditLogs = `-- name: ListAuditLogs :many
+SELECT id, created_at, request_id, actor, action, target_type, target, outcome, message, source_address FROM audit_logs
+WHERE ($1::text = '' OR actor = $1)
+  AND ($2::text = '' OR action = $2)
+  AND ($3::bigint = 0 OR id < $3)
+ORDER BY id DESC
+LIMIT $4
+`
+
+type ListAuditLogsParams struct {
+	Actor    string `json:"actor"`
+	Action   string `json:"action"`
+	BeforeID int64  `json:"before_id"`
+	MaxItems int32  `json:"max_items"`
+}
+
+func (q *Queries) ListAuditLogs(ctx context.Context, arg ListAuditLogsParams) ([]AuditLog, error) {
+	rows, err := q.db.Query(ctx, listAuditLogs,
+		arg.Actor,
+		arg.Action,
+		arg.BeforeID,
+		arg.MaxItems,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	for rows.Next() {
+		var i AuditLog
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.RequestID,
+			&i.Actor,
+			&i.Action,
+			&i.TargetType,
+			&i.Target,
+			&i.Outcome,
+			&i.Message,
+			&i.SourceAddress,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listImageByOwner = `-- name: ListImageByOwner :many
 SELECT id, owner_token, name, digest, created, size, labels FROM image_info
 WHERE owner_token = $1
@@ -152,6 +275,61 @@ func (q *Queries) ListImageByOwner(ctx context.Context, ownerToken string) ([]Im
 	return items, nil
 }
 
+const listSSHSessions = `-- name: ListSSHSessions :many
+SELECT id, connection_id, owner_token, environment, source_address, started_at, last_activity_at, ended_at, bytes_in, bytes_out FROM ssh_sessions
+WHERE ($1::text = '' OR owner_token = $1)
+  AND ($2::text = '' OR environment = $2)
+  AND (NOT $3::boolean OR ended_at IS NULL)
+  AND ($4::bigint = 0 OR id < $4)
+ORDER BY id DESC
+LIMIT $5
+`
+
+type ListSSHSessionsParams struct {
+	OwnerToken  string `json:"owner_token"`
+	Environment string `json:"environment"`
+	Active      bool   `json:"active"`
+	BeforeID    int64  `json:"before_id"`
+	MaxItems    int32  `json:"max_items"`
+}
+
+func (q *Queries) ListSSHSessions(ctx context.Context, arg ListSSHSessionsParams) ([]SshSession, error) {
+	rows, err := q.db.Query(ctx, listSSHSessions,
+		arg.OwnerToken,
+		arg.Environment,
+		arg.Active,
+		arg.BeforeID,
+		arg.MaxItems,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SshSession
+	for rows.Next() {
+		var i SshSession
+		if err := rows.Scan(
+			&i.ID,
+			&i.ConnectionID,
+			&i.OwnerToken,
+			&i.Environment,
+			&i.SourceAddress,
+			&i.StartedAt,
+			&i.LastActivityAt,
+			&i.EndedAt,
+			&i.BytesIn,
+			&i.BytesOut,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listUsers = `-- name: ListUsers :many
 SELECT id, identity_token, public_key FROM users
 ORDER BY id
@@ -176,3 +354,51 @@ func (q *Queries) ListUsers(ctx context.Context) ([]User, error) {
 	}
 	return items, nil
 }
+
+const startSSHSession = `-- name: StartSSHSession :exec
+INSERT INTO ssh_sessions (
+  connection_id, owner_token, environment, source_address
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (connection_id) DO NOTHING
+`
+
+type StartSSHSessionParams struct {
+	ConnectionID  string `json:"connection_id"`
+	OwnerToken    string `json:"owner_token"`
+	Environment   string `json:"environment"`
+	SourceAddress string `json:"source_address"`
+}
+
+func (q *Queries) StartSSHSession(ctx context.Context, arg StartSSHSessionParams) error {
+	_, err := q.db.Exec(ctx, startSSHSession,
+		arg.ConnectionID,
+		arg.OwnerToken,
+		arg.Environment,
+		arg.SourceAddress,
+	)
+	return err
+}
+
+const updateSSHSession = `-- name: UpdateSSHSession :execrows
+UPDATE ssh_sessions
+SET bytes_in = GREATEST(bytes_in, $1),
+  bytes_out = GREATEST(bytes_out, $2),
+  last_activity_at = now()
+WHERE connection_id = $3 AND ended_at IS NULL
+`
+
+type UpdateSSHSessionParams struct {
+	BytesIn      int64  `json:"bytes_in"`
+	BytesOut     int64  `json:"bytes_out"`
+	ConnectionID string `json:"connection_id"`
+}
+
+func (q *Queries) UpdateSSHSession(ctx context.Context, arg UpdateSSHSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateSSHSession, arg.BytesIn, arg.BytesOut, arg.ConnectionID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
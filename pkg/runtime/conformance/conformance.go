@@ -0,0 +1,189 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package conformance is the shared test suite of the runtimes. It runs
+// against the fakes of the backends in the unit tests, and can run
+// against the real ones too.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+)
+
+const (
+	owner      = "alice"
+	otherOwner = "bob"
+	image      = "tensorchord/python-basic:latest"
+)
+
+// Options of the suite.
+type Options struct {
+	// SkipExec skips the exec tests, e.g. if the fake does not support
+	// exec.
+	SkipExec bool
+	// ExecStdout is the expected stdout of `echo hello`.
+	ExecStdout string
+}
+
+// Run runs the suite against the runtime, which must have no
+// environments of the test owners.
+func Run(t *testing.T, rt runtime.Runtime, opt Options) {
+	ctx := context.Background()
+	if err := rt.Ping(ctx); err != nil {
+		t.Fatalf("Expected the runtime reachable, got %v", err)
+	}
+
+	create := runtime.CreateOptions{
+		Owner: owner,
+		Name:  "mnist",
+		Image: image,
+		Annotations: map[string]string{
+			consts.ImageLabelPorts:        `[{"name":"ssh","port":2222}]`,
+			consts.PodAnnotationSSHPolicy: "locked",
+			"other.label":                 "hidden",
+		},
+		WorkingDir: "/home/envd/mnist",
+	}
+	t.Run("create", func(t *testing.T) {
+		if err := rt.Create(ctx, create); err != nil {
+			t.Fatalf("Expected the environment created, got %v", err)
+		}
+		if err := rt.Create(ctx, create); !errdefs.IsConflict(err) {
+			t.Errorf("Expected the conflict error of the same name, got %v", err)
+		}
+		other := create
+		other.Owner, other.Name = otherOwner, "other"
+		if err := rt.Create(ctx, other); err != nil {
+			t.Fatalf("Expected the environment of the other owner created, got %v", err)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		e, err := rt.Get(ctx, owner, create.Name)
+		if err != nil {
+			t.Fatalf("Expected the environment, got %v", err)
+		}
+		if e.Name != create.Name || e.Spec.Image != image {
+			t.Errorf("Expected the environment %s of %s, got %+v", create.Name, image, e)
+		}
+		if e.Spec.SSHPolicy != "locked" {
+			t.Errorf("Expected the ssh policy locked, got %s", e.Spec.SSHPolicy)
+		}
+		if len(e.Spec.Ports) != 1 || e.Spec.Ports[0].Port != 2222 {
+			t.Errorf("Expected the ports of the annotation, got %v", e.Spec.Ports)
+		}
+		if _, ok := e.Labels["other.label"]; ok {
+			t.Errorf("Expected only the envd labels, got %v", e.Labels)
+		}
+		if _, ok := e.Labels[consts.PodLabelUID]; ok {
+			t.Errorf("Expected the owner not in the labels, got %v", e.Labels)
+		}
+		if _, err := rt.Get(ctx, "", create.Name); err != nil {
+			t.Errorf("Expected the environment of any owner, got %v", err)
+		}
+		if _, err := rt.Get(ctx, otherOwner, create.Name); !errdefs.IsUnauthorized(err) {
+			t.Errorf("Expected the unauthorized error of the other owner, got %v", err)
+		}
+		if _, err := rt.Get(ctx, owner, "missing"); !errdefs.IsNotFound(err) {
+			t.Errorf("Expected the not found error, got %v", err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		tcs := []struct {
+			owner    string
+			expected []string
+		}{
+			{owner: owner, expected: []string{"mnist"}},
+			{owner: otherOwner, expected: []string{"other"}},
+			{owner: "", expected: []string{"mnist", "other"}},
+			{owner: "nobody", expected: nil},
+		}
+		for _, tc := range tcs {
+			envs, err := rt.List(ctx, tc.owner)
+			if err != nil {
+				t.Errorf("Expected the environments of %q, got %v", tc.owner, err)
+				continue
+			}
+			var names []string
+			for _, e := range envs {
+				names = append(names, e.Name)
+			}
+			if !equal(names, tc.expected) {
+				t.Errorf("Expected the environments %v of %q, got %v", tc.expected, tc.owner, names)
+			}
+		}
+	})
+
+	t.Run("logs", func(t *testing.T) {
+		logs, err := rt.Logs(ctx, owner, create.Name, runtime.LogOptions{TailLines: 10})
+		if err != nil {
+			t.Fatalf("Expected the logs, got %v", err)
+		}
+		if _, err := io.Copy(io.Discard, logs); err != nil {
+			t.Errorf("Expected the logs readable, got %v", err)
+		}
+		logs.Close()
+		if _, err := rt.Logs(ctx, otherOwner, create.Name, runtime.LogOptions{}); !errdefs.IsUnauthorized(err) {
+			t.Errorf("Expected the unauthorized error of the other owner, got %v", err)
+		}
+	})
+
+	t.Run("exec", func(t *testing.T) {
+		if opt.SkipExec {
+			t.Skip("exec is not supported by the backend")
+		}
+		var stdout bytes.Buffer
+		code, err := rt.Exec(ctx, owner, create.Name, runtime.ExecOptions{
+			Cmd:    []string{"echo", "hello"},
+			Stdout: &stdout,
+		})
+		if err != nil || code != 0 {
+			t.Fatalf("Expected the command succeeded, got %d, %v", code, err)
+		}
+		if stdout.String() != opt.ExecStdout {
+			t.Errorf("Expected the stdout %q, got %q", opt.ExecStdout, stdout.String())
+		}
+		if _, err := rt.Exec(ctx, otherOwner, create.Name, runtime.ExecOptions{
+			Cmd: []string{"true"}}); !errdefs.IsUnauthorized(err) {
+			t.Errorf("Expected the unauthorized error of the other owner, got %v", err)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err := rt.Remove(ctx, otherOwner, create.Name); !errdefs.IsUnauthorized(err) {
+			t.Errorf("Expected the unauthorized error of the other owner, got %v", err)
+		}
+		for _, name := range []string{create.Name, create.Name} {
+			if err := rt.Remove(ctx, owner, name); err != nil {
+				t.Errorf("Expected the environment removed, got %v", err)
+			}
+		}
+		if _, err := rt.Get(ctx, owner, create.Name); !errdefs.IsNotFound(err) {
+			t.Errorf("Expected the not found error after removed, got %v", err)
+		}
+		if err := rt.Remove(ctx, otherOwner, "other"); err != nil {
+			t.Errorf("Expected the environment of the other owner removed, got %v", err)
+		}
+	})
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
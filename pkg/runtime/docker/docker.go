@@ -0,0 +1,423 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package docker runs the environments as the containers in a docker
+// daemon, or a compatible one, so that envd-server runs on a single host
+// without a cluster.
+package docker
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/cockroachdb/errors"
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	dockererrdefs "github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+)
+
+const (
+	// codeMountPath is the mount path of the code volume in the git
+	// container.
+	codeMountPath = "/code"
+)
+
+type Runtime struct {
+	client *client.Client
+	cfg    config.DockerRuntimeConfig
+	// environment returns the current config, which can be updated at
+	// runtime.
+	environment func() config.EnvironmentConfig
+}
+
+var _ runtime.Runtime = &Runtime{}
+
+// New connects to the daemon of the config, or the one of the DOCKER_HOST
+// environment variable. The extra options are applied at last, e.g. the
+// API version in the tests.
+func New(cfg config.DockerRuntimeConfig, environment func() config.EnvironmentConfig,
+	opts ...client.Opt) (*Runtime, error) {
+	opts = append([]client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}, opts...)
+	if cfg.Host != "" {
+		opts = append(opts, client.WithHost(cfg.Host))
+	}
+	cli, err := client.NewClientWithOpts(opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the docker client")
+	}
+	return &Runtime{
+		client:      cli,
+		cfg:         cfg,
+		environment: environment,
+	}, nil
+}
+
+func (r *Runtime) Create(ctx context.Context, opt runtime.CreateOptions) error {
+	cfg := r.environment()
+	if _, err := r.client.ContainerInspect(ctx, opt.Name); err == nil {
+		return errdefs.Conflict(errors.Newf("environment %s already exists", opt.Name))
+	}
+	if err := r.pullImage(ctx, opt.Image); err != nil {
+		return err
+	}
+
+	labels := map[string]string{}
+	for k, v := range opt.Annotations {
+		labels[k] = v
+	}
+	labels[consts.PodLabelUID] = opt.Owner
+	labels[consts.PodLabelEnvironmentName] = opt.Name
+	hostConfig := &container.HostConfig{
+		Mounts: []mount.Mount{
+			{
+				Type:     mount.TypeBind,
+				Source:   r.cfg.HostKeyFile,
+				Target:   cfg.HostKeyPath,
+				ReadOnly: true,
+			},
+			{
+				Type:     mount.TypeBind,
+				Source:   r.cfg.AuthorizedKeysFile,
+				Target:   cfg.AuthorizedKeysPath,
+				ReadOnly: true,
+			},
+		},
+	}
+	if opt.RepoURL != "" {
+		if err := r.cloneRepo(ctx, opt); err != nil {
+			r.removeCodeVolume(opt.Name)
+			return err
+		}
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:   mount.TypeVolume,
+			Source: codeVolume(opt.Name),
+			Target: opt.WorkingDir,
+		})
+	}
+
+	_, err := r.client.ContainerCreate(ctx, &container.Config{
+		Image: opt.Image,
+		Env: []string{
+			"ENVD_HOST_KEY=" + cfg.HostKeyPath,
+			"ENVD_AUTHORIZED_KEYS_PATH=" + cfg.AuthorizedKeysPath,
+			"ENVD_WORKDIR=" + opt.WorkingDir,
+		},
+		Labels: labels,
+	}, hostConfig, &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			r.cfg.Network: {},
+		},
+	}, nil, opt.Name)
+	if err != nil {
+		// The code volume is removed with the container by Remove, which
+		// does not find the environment without it.
+		if opt.RepoURL != "" {
+			r.removeCodeVolume(opt.Name)
+		}
+		return wrapError(err, "failed to create the container")
+	}
+	if err := r.client.ContainerStart(ctx, opt.Name, dockertypes.ContainerStartOptions{}); err != nil {
+		return wrapError(err, "failed to start the container")
+	}
+	return nil
+}
+
+func (r *Runtime) Get(ctx context.Context, owner, name string) (types.Environment, error) {
+	c, err := r.inspect(ctx, owner, name)
+	if err != nil {
+		return types.Environment{}, err
+	}
+	annotations := map[string]string{}
+	for k, v := range c.Config.Labels {
+		annotations[k] = v
+	}
+	// The owner is the identity token, which is not returned.
+	delete(annotations, consts.PodLabelUID)
+	delete(annotations, consts.PodLabelEnvironmentName)
+	return runtime.NewEnvironment(name, c.Config.Image, phase(c.State), annotations)
+}
+
+func (r *Runtime) List(ctx context.Context, owner string) ([]types.Environment, error) {
+	label := consts.PodLabelUID
+	if owner != "" {
+		label += "=" + owner
+	}
+	containers, err := r.client.ContainerList(ctx, dockertypes.ContainerListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", label)),
+	})
+	if err != nil {
+		return nil, wrapError(err, "failed to list the containers")
+	}
+	envs := make([]types.Environment, 0, len(containers))
+	for _, c := range containers {
+		name := c.Labels[consts.PodLabelEnvironmentName]
+		e, err := r.Get(ctx, owner, name)
+		if errdefs.IsNotFound(err) {
+			// Removed after it is listed.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, e)
+	}
+	sort.Slice(envs, func(i, j int) bool {
+		return envs[i].Name < envs[j].Name
+	})
+	return envs, nil
+}
+
+func (r *Runtime) Remove(ctx context.Context, owner, name string) error {
+	_, err := r.inspect(ctx, owner, name)
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = r.client.ContainerRemove(ctx, name, dockertypes.ContainerRemoveOptions{
+		Force:         true,
+		RemoveVolumes: true,
+	})
+	if err != nil && !client.IsErrNotFound(err) {
+		return wrapError(err, "failed to remove the container")
+	}
+	err = r.client.VolumeRemove(ctx, codeVolume(name), true)
+	if err != nil && !client.IsErrNotFound(err) {
+		return wrapError(err, "failed to remove the code volume")
+	}
+	logrus.WithField("name", name).Debug("container is removed")
+	return nil
+}
+
+func (r *Runtime) Logs(ctx context.Context, owner, name string,
+	opt runtime.LogOptions) (io.ReadCloser, error) {
+	if _, err := r.inspect(ctx, owner, name); err != nil {
+		return nil, err
+	}
+	logOpt := dockertypes.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opt.Follow,
+	}
+	if opt.TailLines > 0 {
+		logOpt.Tail = strconv.FormatInt(opt.TailLines, 10)
+	}
+	stream, err := r.client.ContainerLogs(ctx, name, logOpt)
+	if err != nil {
+		return nil, wrapError(err, "failed to get the logs")
+	}
+	// The logs are multiplexed since the container has no TTY.
+	pr, pw := io.Pipe()
+	go func() {
+		defer stream.Close()
+		_, err := stdcopy.StdCopy(pw, pw, stream)
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+func (r *Runtime) Exec(ctx context.Context, owner, name string,
+	opt runtime.ExecOptions) (int, error) {
+	if len(opt.Cmd) == 0 {
+		return -1, errdefs.InvalidParameter(errors.New("command is required"))
+	}
+	if _, err := r.inspect(ctx, owner, name); err != nil {
+		return -1, err
+	}
+	exec, err := r.client.ContainerExecCreate(ctx, name, dockertypes.ExecConfig{
+		Cmd:          opt.Cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return -1, wrapError(err, "failed to create the exec")
+	}
+	resp, err := r.client.ContainerExecAttach(ctx, exec.ID, dockertypes.ExecStartCheck{})
+	if err != nil {
+		return -1, wrapError(err, "failed to start the exec")
+	}
+	defer resp.Close()
+	stdout, stderr := opt.Stdout, opt.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	if _, err := stdcopy.StdCopy(stdout, stderr, resp.Reader); err != nil {
+		return -1, errors.Wrap(err, "failed to read the exec output")
+	}
+	inspect, err := r.client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return -1, wrapError(err, "failed to inspect the exec")
+	}
+	return inspect.ExitCode, nil
+}
+
+func (r *Runtime) Ping(ctx context.Context) error {
+	_, err := r.client.Ping(ctx)
+	return errors.Wrap(err, "failed to reach the docker daemon")
+}
+
+// inspect returns the container of the environment, which must belong to
+// the owner unless the owner is empty.
+func (r *Runtime) inspect(ctx context.Context, owner, name string) (dockertypes.ContainerJSON, error) {
+	c, err := r.client.ContainerInspect(ctx, name)
+	if err != nil {
+		return c, wrapError(err, "failed to get environment "+name)
+	}
+	var uid string
+	var ok bool
+	if c.ContainerJSONBase != nil && c.Config != nil {
+		uid, ok = c.Config.Labels[consts.PodLabelUID]
+	}
+	if !ok {
+		// Not an environment.
+		return c, errdefs.NotFound(errors.Newf("environment %s not found", name))
+	}
+	if owner != "" && uid != owner {
+		logrus.WithFields(logrus.Fields{
+			"identity_token_in_container": uid,
+			"identity_token_in_request":   owner,
+		}).Debug("mismatch identity_token")
+		return c, errdefs.Unauthorized(errors.New("unauthorized"))
+	}
+	return c, nil
+}
+
+// pullImage pulls the image if it is not present, like the IfNotPresent
+// policy in kubernetes.
+func (r *Runtime) pullImage(ctx context.Context, image string) error {
+	_, _, err := r.client.ImageInspectWithRaw(ctx, image)
+	if err == nil {
+		return nil
+	}
+	if !client.IsErrNotFound(err) {
+		return wrapError(err, "failed to inspect the image")
+	}
+	logrus.WithField("image", image).Debug("pulling the image")
+	progress, err := r.client.ImagePull(ctx, image, dockertypes.ImagePullOptions{})
+	if err != nil {
+		return wrapError(err, "failed to pull the image")
+	}
+	defer progress.Close()
+	// The pull is done when the progress is drained, and the errors of it,
+	// e.g. the manifest unknown, are in the messages.
+	err = jsonmessage.DisplayJSONMessagesStream(progress, io.Discard, 0, false, nil)
+	return errors.Wrapf(err, "failed to pull the image %s", image)
+}
+
+// removeCodeVolume removes the code volume of the environment which is not
+// created.
+func (r *Runtime) removeCodeVolume(name string) {
+	err := r.client.VolumeRemove(context.Background(), codeVolume(name), true)
+	if err != nil && !client.IsErrNotFound(err) {
+		logrus.WithError(err).WithField("name", name).Warn("failed to remove the code volume")
+	}
+}
+
+// cloneRepo clones the repository in the code volume of the environment,
+// like the init container in kubernetes.
+func (r *Runtime) cloneRepo(ctx context.Context, opt runtime.CreateOptions) error {
+	gitImage := r.environment().GitImage
+	if err := r.pullImage(ctx, gitImage); err != nil {
+		return err
+	}
+	logrus.Debugf("clone code from %s", opt.RepoURL)
+	created, err := r.client.ContainerCreate(ctx, &container.Config{
+		Image: gitImage,
+		Cmd:   []string{"clone", "--", opt.RepoURL, codeMountPath},
+	}, &container.HostConfig{
+		Mounts: []mount.Mount{{
+			Type:   mount.TypeVolume,
+			Source: codeVolume(opt.Name),
+			Target: codeMountPath,
+		}},
+	}, nil, nil, "")
+	if err != nil {
+		return wrapError(err, "failed to create the git container")
+	}
+	defer func() {
+		err := r.client.ContainerRemove(context.Background(), created.ID,
+			dockertypes.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			logrus.WithError(err).Warn("failed to remove the git container")
+		}
+	}()
+	// Wait for the next exit, the container is not started yet.
+	waitCh, errCh := r.client.ContainerWait(ctx, created.ID, container.WaitConditionNextExit)
+	if err := r.client.ContainerStart(ctx, created.ID, dockertypes.ContainerStartOptions{}); err != nil {
+		return wrapError(err, "failed to start the git container")
+	}
+	select {
+	case res := <-waitCh:
+		if res.StatusCode != 0 {
+			return errors.Newf("failed to clone %s, exit code %d", opt.RepoURL, res.StatusCode)
+		}
+		return nil
+	case err := <-errCh:
+		return wrapError(err, "failed to wait for the git container")
+	}
+}
+
+// phase converts the container state to the pod phases, which are used
+// by the clients.
+func phase(state *dockertypes.ContainerState) string {
+	switch {
+	case state == nil:
+		return "Unknown"
+	case state.Running:
+		return "Running"
+	case state.Status == "created" || state.Restarting:
+		return "Pending"
+	case state.Status == "exited" && state.ExitCode == 0:
+		return "Succeeded"
+	case state.Status == "exited" || state.Dead:
+		return "Failed"
+	default:
+		return "Unknown"
+	}
+}
+
+func codeVolume(name string) string {
+	return "envd-" + name + "-code"
+}
+
+// wrapError wraps the docker error, and keeps the errdefs class of it.
+func wrapError(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	wrapped := errors.Wrap(err, msg)
+	switch {
+	case client.IsErrNotFound(err):
+		return errdefs.NotFound(wrapped)
+	case dockererrdefs.IsConflict(err):
+		return errdefs.Conflict(wrapped)
+	case dockererrdefs.IsInvalidParameter(err):
+		return errdefs.InvalidParameter(wrapped)
+	case dockererrdefs.IsUnauthorized(err):
+		return errdefs.Unauthorized(wrapped)
+	case dockererrdefs.IsUnavailable(err):
+		return errdefs.Unavailable(wrapped)
+	}
+	return wrapped
+}
@@ -0,0 +1,270 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	dockertypes "github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+	"github.com/tensorchord/envd-server/pkg/runtime/conformance"
+)
+
+// fakeDaemon serves the subset of the docker API used by the runtime. The
+// containers are running once started, and the exec prints the arguments
+// of echo. The images of bert are not found in the registry, and the
+// containers of the broken images fail to be created.
+type fakeDaemon struct {
+	mu         sync.Mutex
+	images     map[string]bool
+	containers map[string]*dockertypes.ContainerJSON
+	execs      map[string][]string
+	volumes    map[string]bool
+}
+
+func newFakeDaemon() *fakeDaemon {
+	return &fakeDaemon{
+		images:     map[string]bool{},
+		containers: map[string]*dockertypes.ContainerJSON{},
+		execs:      map[string][]string{},
+		volumes:    map[string]bool{},
+	}
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v1.41")
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	notFound := func() {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"message":"no such object: %s"}`, path)
+	}
+	writeJSON := func(v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	switch {
+	case path == "/_ping":
+		w.Header().Set("API-Version", "1.41")
+		fmt.Fprint(w, "OK")
+	case strings.HasPrefix(path, "/images/") && strings.HasSuffix(path, "/json"):
+		image := strings.TrimSuffix(strings.TrimPrefix(path, "/images/"), "/json")
+		if !d.images[image] {
+			notFound()
+			return
+		}
+		writeJSON(dockertypes.ImageInspect{ID: image})
+	case path == "/images/create":
+		if strings.HasSuffix(r.URL.Query().Get("fromImage"), "bert") {
+			writeJSON(map[string]interface{}{"status": "Pulling from library/bert"})
+			writeJSON(map[string]interface{}{"errorDetail": map[string]string{"message": "manifest unknown"},
+				"error": "manifest unknown"})
+			return
+		}
+		d.images[r.URL.Query().Get("fromImage")+":"+r.URL.Query().Get("tag")] = true
+		writeJSON(map[string]string{"status": "pulled"})
+	case path == "/containers/create":
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			name = fmt.Sprintf("container-%d", len(d.containers))
+		}
+		if _, ok := d.containers[name]; ok {
+			w.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(w, `{"message":"container name %s is in use"}`, name)
+			return
+		}
+		var body struct {
+			container.Config
+			HostConfig *container.HostConfig
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		cfg := body.Config
+		if strings.HasPrefix(cfg.Image, "broken") {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"message":"failed to create the container"}`)
+			return
+		}
+		if body.HostConfig != nil {
+			for _, m := range body.HostConfig.Mounts {
+				if m.Type == mount.TypeVolume {
+					d.volumes[m.Source] = true
+				}
+			}
+		}
+		d.containers[name] = &dockertypes.ContainerJSON{
+			ContainerJSONBase: &dockertypes.ContainerJSONBase{
+				ID:    name,
+				Name:  "/" + name,
+				State: &dockertypes.ContainerState{Status: "created"},
+			},
+			Config: &cfg,
+		}
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(container.ContainerCreateCreatedBody{ID: name})
+	case path == "/containers/json":
+		args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		list := []dockertypes.Container{}
+		for name, c := range d.containers {
+			if args.MatchKVList("label", c.Config.Labels) {
+				list = append(list, dockertypes.Container{ID: name, Names: []string{"/" + name}, Labels: c.Config.Labels})
+			}
+		}
+		writeJSON(list)
+	case parts[0] == "containers" && len(parts) == 2 && r.Method == http.MethodDelete:
+		if _, ok := d.containers[parts[1]]; !ok {
+			notFound()
+			return
+		}
+		delete(d.containers, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	case parts[0] == "containers" && len(parts) == 3:
+		c, ok := d.containers[parts[1]]
+		if !ok {
+			notFound()
+			return
+		}
+		switch parts[2] {
+		case "json":
+			writeJSON(c)
+		case "start":
+			c.State = &dockertypes.ContainerState{Status: "running", Running: true}
+			w.WriteHeader(http.StatusNoContent)
+		case "wait":
+			writeJSON(container.ContainerWaitOKBody{StatusCode: 0})
+		case "logs":
+			_, _ = stdcopy.NewStdWriter(w, stdcopy.Stdout).Write([]byte("started\n"))
+		case "exec":
+			var cfg dockertypes.ExecConfig
+			if err := json.NewDecoder(r.Body).Decode(&cfg); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			id := fmt.Sprintf("exec-%d", len(d.execs))
+			d.execs[id] = cfg.Cmd
+			w.WriteHeader(http.StatusCreated)
+			writeJSON(dockertypes.IDResponse{ID: id})
+		default:
+			notFound()
+		}
+	case parts[0] == "exec" && len(parts) == 3 && parts[2] == "start":
+		cmd := d.execs[parts[1]]
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(buf, "HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\n"+
+			"Connection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+		if cmd[0] == "echo" {
+			_, _ = stdcopy.NewStdWriter(buf, stdcopy.Stdout).Write([]byte(strings.Join(cmd[1:], " ") + "\n"))
+		}
+		_ = buf.Flush()
+	case parts[0] == "exec" && len(parts) == 3 && parts[2] == "json":
+		writeJSON(dockertypes.ContainerExecInspect{ExecID: parts[1]})
+	case parts[0] == "volumes" && len(parts) == 2 && r.Method == http.MethodDelete:
+		if !d.volumes[parts[1]] {
+			notFound()
+			return
+		}
+		delete(d.volumes, parts[1])
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		notFound()
+	}
+}
+
+func newTestRuntime(t *testing.T, d *fakeDaemon) *Runtime {
+	srv := httptest.NewServer(d)
+	t.Cleanup(srv.Close)
+	rt, err := New(config.DockerRuntimeConfig{
+		Host:               "tcp://" + srv.Listener.Addr().String(),
+		Network:            "envd",
+		HostKeyFile:        "/etc/envd-server/hostkey",
+		AuthorizedKeysFile: "/etc/envd-server/publickey",
+	}, func() config.EnvironmentConfig {
+		return config.Default().Environment
+	}, client.WithVersion("1.41"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt
+}
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, newTestRuntime(t, newFakeDaemon()), conformance.Options{ExecStdout: "hello\n"})
+}
+
+func TestCreateFailure(t *testing.T) {
+	d := newFakeDaemon()
+	rt := newTestRuntime(t, d)
+
+	tcs := []struct {
+		opt         runtime.CreateOptions
+		expectedErr string
+	}{
+		{
+			opt:         runtime.CreateOptions{Owner: "alice", Name: "bert", Image: "bert:dev"},
+			expectedErr: "manifest unknown",
+		},
+		{
+			opt: runtime.CreateOptions{Owner: "alice", Name: "mnist", Image: "broken:dev",
+				RepoURL: "https://github.com/tensorchord/envd-quick-start"},
+			expectedErr: "failed to create the container",
+		},
+	}
+	for _, tc := range tcs {
+		err := rt.Create(context.Background(), tc.opt)
+		if err == nil || !strings.Contains(err.Error(), tc.expectedErr) {
+			t.Errorf("Expected the error %q creating %s, got %v", tc.expectedErr, tc.opt.Name, err)
+		}
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.containers) != 0 || len(d.volumes) != 0 {
+		t.Errorf("Expected no container and volume left, got %v, %v", d.containers, d.volumes)
+	}
+}
+
+func TestPhase(t *testing.T) {
+	tcs := []struct {
+		state    *dockertypes.ContainerState
+		expected string
+	}{
+		{state: nil, expected: "Unknown"},
+		{state: &dockertypes.ContainerState{Status: "running", Running: true}, expected: "Running"},
+		{state: &dockertypes.ContainerState{Status: "created"}, expected: "Pending"},
+		{state: &dockertypes.ContainerState{Status: "exited"}, expected: "Succeeded"},
+		{state: &dockertypes.ContainerState{Status: "exited", ExitCode: 1}, expected: "Failed"},
+		{state: &dockertypes.ContainerState{Status: "dead", Dead: true}, expected: "Failed"},
+	}
+	for _, tc := range tcs {
+		if p := phase(tc.state); p != tc.expected {
+			t.Errorf("Expected the phase %s of %+v, got %s", tc.expected, tc.state, p)
+		}
+	}
+}
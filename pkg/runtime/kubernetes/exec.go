@@ -0,0 +1,101 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package kubernetes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/client-go/util/exec"
+
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+)
+
+// Exec runs the command in the envd container with the SPDY executor of
+// client-go, so that the credentials, the proxy and the transport wrappers
+// of the rest config are all used.
+func (r *Runtime) Exec(ctx context.Context, owner, name string,
+	opt runtime.ExecOptions) (int, error) {
+	if r.restConfig == nil {
+		return -1, errdefs.NotImplemented(errors.New("exec is not supported without the kubernetes config"))
+	}
+	if len(opt.Cmd) == 0 {
+		return -1, errdefs.InvalidParameter(errors.New("command is required"))
+	}
+	pod, err := r.getPod(ctx, owner, name)
+	if err != nil {
+		return -1, err
+	}
+	client, err := corev1.NewForConfig(r.restConfig)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to create the kubernetes client")
+	}
+	req := client.RESTClient().Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: containerName,
+			Command:   opt.Cmd,
+			Stdout:    opt.Stdout != nil,
+			Stderr:    opt.Stderr != nil,
+		}, scheme.ParameterCodec)
+
+	transport, upgrader, err := spdy.RoundTripperFor(r.restConfig)
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to create the SPDY transport")
+	}
+	executor, err := remotecommand.NewSPDYExecutorForTransports(transport,
+		&contextUpgrader{Upgrader: upgrader, ctx: ctx}, http.MethodPost, req.URL())
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to create the executor")
+	}
+	err = executor.Stream(remotecommand.StreamOptions{
+		Stdout: opt.Stdout,
+		Stderr: opt.Stderr,
+	})
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), nil
+	}
+	if err != nil {
+		return -1, errors.Wrap(err, "failed to exec")
+	}
+	return 0, nil
+}
+
+// contextUpgrader closes the upgraded connection when the context is
+// done, since the executor of client-go v0.25 has no StreamWithContext.
+type contextUpgrader struct {
+	spdy.Upgrader
+	ctx context.Context
+}
+
+func (u *contextUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-u.ctx.Done():
+			conn.Close()
+		case <-conn.CloseChan():
+		}
+	}()
+	return conn, nil
+}
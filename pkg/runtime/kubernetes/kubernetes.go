@@ -0,0 +1,397 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package kubernetes runs the environments as the pods, each with a
+// service of the ssh port.
+package kubernetes
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+	"github.com/tensorchord/envd-server/pkg/tracing"
+)
+
+const (
+	// containerName is the container of the environment in the pod.
+	containerName = "envd"
+	// recreateDeleteTimeout is the time to wait for the old pod to be
+	// deleted before creating it again.
+	recreateDeleteTimeout = 2 * time.Minute
+	// serviceAccountVolumePrefix is the prefix of the volumes injected by
+	// the ServiceAccount admission, which are injected again.
+	serviceAccountVolumePrefix = "kube-api-access-"
+)
+
+type Runtime struct {
+	client kubernetes.Interface
+	// restConfig is used to exec in the pods, exec is not implemented
+	// if it is nil.
+	restConfig *rest.Config
+	// environment returns the current config, which can be updated at
+	// runtime.
+	environment func() config.EnvironmentConfig
+}
+
+var (
+	_ runtime.Runtime   = &Runtime{}
+	_ runtime.Recreator = &Runtime{}
+)
+
+func New(client kubernetes.Interface, restConfig *rest.Config,
+	environment func() config.EnvironmentConfig) *Runtime {
+	return &Runtime{
+		client:      client,
+		restConfig:  restConfig,
+		environment: environment,
+	}
+}
+
+func (r *Runtime) Create(ctx context.Context, opt runtime.CreateOptions) error {
+	cfg := r.environment()
+	labels := map[string]string{
+		consts.PodLabelUID:             opt.Owner,
+		consts.PodLabelEnvironmentName: opt.Name,
+	}
+	var defaultPermMode int32 = 0666
+	expectedPod := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        opt.Name,
+			Namespace:   cfg.Namespace,
+			Labels:      labels,
+			Annotations: opt.Annotations,
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{
+				{
+					Name:  containerName,
+					Image: opt.Image,
+					Ports: []v1.ContainerPort{
+						{
+							Name:          "ssh",
+							ContainerPort: cfg.SSHPort,
+						},
+					},
+					Env: []v1.EnvVar{
+						{
+							Name:  "ENVD_HOST_KEY",
+							Value: cfg.HostKeyPath,
+						},
+						{
+							Name:  "ENVD_AUTHORIZED_KEYS_PATH",
+							Value: cfg.AuthorizedKeysPath,
+						},
+						{
+							Name:  "ENVD_WORKDIR",
+							Value: opt.WorkingDir,
+						},
+					},
+					VolumeMounts: []v1.VolumeMount{
+						{
+							Name:      "secret",
+							ReadOnly:  true,
+							MountPath: cfg.HostKeyPath,
+							SubPath:   "hostkey",
+						},
+						{
+							Name:      "secret",
+							ReadOnly:  true,
+							MountPath: cfg.AuthorizedKeysPath,
+							SubPath:   "publickey",
+						},
+					},
+				},
+			},
+			Volumes: []v1.Volume{
+				{
+					Name: "secret",
+					VolumeSource: v1.VolumeSource{
+						Secret: &v1.SecretVolumeSource{
+							SecretName:  cfg.SecretName,
+							DefaultMode: &defaultPermMode,
+						},
+					},
+				},
+			},
+		},
+	}
+	if opt.RepoURL != "" {
+		logrus.Debugf("clone code from %s", opt.RepoURL)
+		expectedPod.Spec.InitContainers = append(expectedPod.Spec.InitContainers, v1.Container{
+			Name:  "git-cloner",
+			Image: cfg.GitImage,
+			Args:  []string{"clone", "--", opt.RepoURL, "/code"},
+			VolumeMounts: []v1.VolumeMount{
+				{
+					Name:      "code-dir",
+					MountPath: "/code",
+				},
+			},
+		})
+		expectedPod.Spec.Containers[0].VolumeMounts = append(expectedPod.Spec.Containers[0].VolumeMounts, v1.VolumeMount{
+			Name:      "code-dir",
+			MountPath: opt.WorkingDir,
+		})
+		expectedPod.Spec.Volumes = append(expectedPod.Spec.Volumes, v1.Volume{
+			Name: "code-dir",
+			VolumeSource: v1.VolumeSource{
+				EmptyDir: &v1.EmptyDirVolumeSource{},
+			},
+		})
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "kubernetes.CreatePod")
+	_, err := r.client.CoreV1().Pods(
+		cfg.Namespace).Create(ctx, &expectedPod, metav1.CreateOptions{})
+	tracing.End(span, err)
+	if err != nil {
+		return wrapError(err, "failed to create the pod")
+	}
+
+	expectedService := v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opt.Name,
+			Namespace: cfg.Namespace,
+			Labels:    labels,
+		},
+		Spec: v1.ServiceSpec{
+			Selector: labels,
+			Type:     v1.ServiceTypeClusterIP,
+			Ports: []v1.ServicePort{
+				{
+					Name: "ssh",
+					Port: cfg.SSHPort,
+				},
+			},
+		},
+	}
+	ctx, span = tracing.Tracer().Start(ctx, "kubernetes.CreateService")
+	_, err = r.client.CoreV1().Services(cfg.Namespace).Create(ctx, &expectedService, metav1.CreateOptions{})
+	tracing.End(span, err)
+	return wrapError(err, "failed to create the service")
+}
+
+func (r *Runtime) Get(ctx context.Context, owner, name string) (types.Environment, error) {
+	pod, err := r.getPod(ctx, owner, name)
+	if err != nil {
+		return types.Environment{}, err
+	}
+	return environmentFromPod(*pod)
+}
+
+func (r *Runtime) List(ctx context.Context, owner string) ([]types.Environment, error) {
+	selector := consts.PodLabelUID
+	if owner != "" {
+		selector = labels.Set{consts.PodLabelUID: owner}.String()
+	}
+	pods, err := r.client.CoreV1().Pods(r.environment().Namespace).List(ctx,
+		metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, wrapError(err, "failed to list the environments")
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Name < pods.Items[j].Name
+	})
+	envs := make([]types.Environment, 0, len(pods.Items))
+	for _, p := range pods.Items {
+		e, err := environmentFromPod(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to generate environment from pod %s", p.Name)
+		}
+		envs = append(envs, e)
+	}
+	return envs, nil
+}
+
+func (r *Runtime) Remove(ctx context.Context, owner, name string) error {
+	ns := r.environment().Namespace
+	logger := logrus.WithField("name", name)
+	pod, err := r.getPod(ctx, owner, name)
+	if !errdefs.IsNotFound(err) {
+		if err != nil {
+			return err
+		}
+		err = r.client.CoreV1().Pods(ns).Delete(ctx, pod.Name, metav1.DeleteOptions{})
+		if err != nil && !k8serrors.IsNotFound(err) {
+			return wrapError(err, "failed to delete the pod")
+		}
+		logger.Debugf("pod %s is deleted", name)
+	}
+
+	service, err := r.client.CoreV1().Services(ns).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return wrapError(err, "failed to get the service")
+	}
+	if err := checkOwner(service.Labels, owner); err != nil {
+		return err
+	}
+	err = r.client.CoreV1().Services(ns).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return wrapError(err, "failed to delete the service")
+	}
+	logger.Debugf("service %s is deleted", name)
+	return nil
+}
+
+func (r *Runtime) Logs(ctx context.Context, owner, name string,
+	opt runtime.LogOptions) (io.ReadCloser, error) {
+	pod, err := r.getPod(ctx, owner, name)
+	if err != nil {
+		return nil, err
+	}
+	logOpt := &v1.PodLogOptions{Container: containerName, Follow: opt.Follow}
+	if opt.TailLines > 0 {
+		logOpt.TailLines = &opt.TailLines
+	}
+	stream, err := r.client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, logOpt).Stream(ctx)
+	if err != nil {
+		return nil, wrapError(err, "failed to get the logs")
+	}
+	return stream, nil
+}
+
+func (r *Runtime) Ping(ctx context.Context) error {
+	_, err := r.client.Discovery().ServerVersion()
+	return errors.Wrap(err, "failed to reach the kubernetes API server")
+}
+
+// Recreate deletes the pod of the environment and creates it again with
+// the same spec. The service is kept since it selects the pod by the
+// labels.
+func (r *Runtime) Recreate(ctx context.Context, name string, annotations map[string]string) error {
+	pods := r.client.CoreV1().Pods(r.environment().Namespace)
+	p, err := r.getPod(ctx, "", name)
+	if err != nil {
+		return err
+	}
+	next := v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        p.Name,
+			Namespace:   p.Namespace,
+			Labels:      p.Labels,
+			Annotations: map[string]string{},
+		},
+		Spec: *p.Spec.DeepCopy(),
+	}
+	for k, v := range p.Annotations {
+		next.Annotations[k] = v
+	}
+	for k, v := range annotations {
+		next.Annotations[k] = v
+	}
+	next.Spec.NodeName = ""
+	removeServiceAccountVolumes(&next.Spec)
+
+	err = pods.Delete(ctx, p.Name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{UID: &p.UID},
+	})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return wrapError(err, "failed to delete the pod")
+	}
+	err = wait.PollImmediateWithContext(ctx, time.Second, recreateDeleteTimeout,
+		func(ctx context.Context) (bool, error) {
+			_, err := pods.Get(ctx, p.Name, metav1.GetOptions{})
+			if k8serrors.IsNotFound(err) {
+				return true, nil
+			}
+			return false, err
+		})
+	if err != nil {
+		return errors.Wrap(err, "failed to wait for the pod to be deleted")
+	}
+	if _, err := pods.Create(ctx, &next, metav1.CreateOptions{}); err != nil {
+		return wrapError(err, "failed to create the pod")
+	}
+	return nil
+}
+
+// getPod returns the pod of the environment, which must belong to the
+// owner unless the owner is empty.
+func (r *Runtime) getPod(ctx context.Context, owner, name string) (*v1.Pod, error) {
+	pod, err := r.client.CoreV1().Pods(r.environment().Namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, wrapError(err, "failed to get environment "+name)
+	}
+	if err := checkOwner(pod.Labels, owner); err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+func checkOwner(labels map[string]string, owner string) error {
+	if owner != "" && labels[consts.PodLabelUID] != owner {
+		logrus.WithFields(logrus.Fields{
+			"identity_token_in_pod":     labels[consts.PodLabelUID],
+			"identity_token_in_request": owner,
+		}).Debug("mismatch identity_token")
+		return errdefs.Unauthorized(errors.New("unauthorized"))
+	}
+	return nil
+}
+
+// wrapError wraps the kubernetes error, and marks the not found and the
+// conflict errors with the errdefs classes.
+func wrapError(err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	err = errors.Wrap(err, msg)
+	switch {
+	case k8serrors.IsNotFound(err):
+		return errdefs.NotFound(err)
+	case k8serrors.IsAlreadyExists(err), k8serrors.IsConflict(err):
+		return errdefs.Conflict(err)
+	}
+	return err
+}
+
+func environmentFromPod(p v1.Pod) (types.Environment, error) {
+	var image string
+	if len(p.Spec.Containers) != 0 {
+		image = p.Spec.Containers[0].Image
+	}
+	return runtime.NewEnvironment(p.Name, image, string(p.Status.Phase), p.Annotations)
+}
+
+// removeServiceAccountVolumes removes the token volumes injected in the
+// old pod, otherwise the new pod is rejected for the duplicated mounts.
+func removeServiceAccountVolumes(spec *v1.PodSpec) {
+	var volumes []v1.Volume
+	for _, v := range spec.Volumes {
+		if !strings.HasPrefix(v.Name, serviceAccountVolumePrefix) {
+			volumes = append(volumes, v)
+		}
+	}
+	spec.Volumes = volumes
+	for i := range spec.Containers {
+		var mounts []v1.VolumeMount
+		for _, m := range spec.Containers[i].VolumeMounts {
+			if !strings.HasPrefix(m.Name, serviceAccountVolumePrefix) {
+				mounts = append(mounts, m)
+			}
+		}
+		spec.Containers[i].VolumeMounts = mounts
+	}
+}
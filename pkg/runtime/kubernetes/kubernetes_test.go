@@ -0,0 +1,127 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/apimachinery/pkg/util/httpstream/spdy"
+	remotecommandconsts "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/rest"
+
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+	"github.com/tensorchord/envd-server/pkg/runtime/conformance"
+)
+
+// newExecServer serves the exec subresource of the API server over SPDY.
+// The command prints the arguments, and exits with the code of `exit N`.
+func newExecServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := httpstream.Handshake(r, w, []string{remotecommandconsts.StreamProtocolV4Name}); err != nil {
+			t.Error(err)
+			return
+		}
+		streams := make(chan httpstream.Stream)
+		conn := spdy.NewResponseUpgrader().UpgradeResponse(w, r,
+			func(stream httpstream.Stream, _ <-chan struct{}) error {
+				streams <- stream
+				return nil
+			})
+		if conn == nil {
+			return
+		}
+		defer conn.Close()
+
+		// The client creates the error stream and the stdout stream.
+		var errorStream, stdoutStream httpstream.Stream
+		for errorStream == nil || stdoutStream == nil {
+			stream := <-streams
+			switch stream.Headers().Get(corev1.StreamType) {
+			case corev1.StreamTypeError:
+				errorStream = stream
+			case corev1.StreamTypeStdout:
+				stdoutStream = stream
+			}
+		}
+
+		cmd := r.URL.Query()["command"]
+		status := metav1.Status{Status: metav1.StatusSuccess}
+		switch cmd[0] {
+		case "echo":
+			if _, err := stdoutStream.Write([]byte(strings.Join(cmd[1:], " ") + "\n")); err != nil {
+				t.Error(err)
+			}
+		case "exit":
+			status = metav1.Status{
+				Status: metav1.StatusFailure,
+				Reason: remotecommandconsts.NonZeroExitCodeReason,
+				Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{
+					{Type: remotecommandconsts.ExitCodeCauseType, Message: cmd[1]},
+				}},
+			}
+		}
+		stdoutStream.Close()
+		data, _ := json.Marshal(status)
+		if _, err := errorStream.Write(data); err != nil {
+			t.Error(err)
+		}
+		errorStream.Close()
+	}))
+}
+
+func TestConformance(t *testing.T) {
+	srv := newExecServer(t)
+	defer srv.Close()
+	rt := New(fake.NewSimpleClientset(), &rest.Config{Host: srv.URL}, func() config.EnvironmentConfig {
+		return config.Default().Environment
+	})
+	conformance.Run(t, rt, conformance.Options{ExecStdout: "hello\n"})
+}
+
+func TestExitCode(t *testing.T) {
+	srv := newExecServer(t)
+	defer srv.Close()
+	client := fake.NewSimpleClientset()
+	rt := New(client, &rest.Config{Host: srv.URL}, func() config.EnvironmentConfig {
+		return config.Default().Environment
+	})
+	err := rt.Create(context.Background(), runtime.CreateOptions{Owner: "alice", Name: "mnist", Image: "python"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		cmd          []string
+		expectedCode int
+		expectedOut  string
+	}{
+		{cmd: []string{"echo", "a", "b"}, expectedCode: 0, expectedOut: "a b\n"},
+		{cmd: []string{"exit", "3"}, expectedCode: 3},
+	}
+	for _, tc := range tcs {
+		var stdout bytes.Buffer
+		code, err := rt.Exec(context.Background(), "alice", "mnist", runtime.ExecOptions{
+			Cmd: tc.cmd, Stdout: &stdout})
+		if err != nil {
+			t.Errorf("Expected %v to exit, got %v", tc.cmd, err)
+			continue
+		}
+		if code != tc.expectedCode || stdout.String() != tc.expectedOut {
+			t.Errorf("Expected %v to exit %d with %q, got %d with %q",
+				tc.cmd, tc.expectedCode, tc.expectedOut, code, stdout.String())
+		}
+	}
+}
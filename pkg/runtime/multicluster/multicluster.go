@@ -0,0 +1,371 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package multicluster places the environments in several clusters, and
+// routes the requests of an environment to the cluster it is placed in.
+package multicluster
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+)
+
+// Cluster is one of the clusters of the runtime.
+type Cluster struct {
+	Name   string
+	Labels map[string]string
+	// MaxEnvironments is the number of the environments placed in the
+	// cluster, it is unlimited if zero.
+	MaxEnvironments int
+	Runtime         runtime.Runtime
+}
+
+// countTTL is how long the numbers of the environments in the clusters
+// are cached for the placement. They are updated by the creates and the
+// removes in between, and listed again to catch the other changes.
+const countTTL = 30 * time.Second
+
+// Runtime runs the environments in the clusters. The names of the
+// environments are unique in all the clusters, since the SSH usernames
+// only have the names.
+type Runtime struct {
+	clusters []Cluster
+
+	mu sync.Mutex
+	// placements caches the clusters of the environments, the clusters
+	// are searched on a miss.
+	placements map[string]*Cluster
+	// creating has the names of the environments being created, so that
+	// the concurrent creates of a name are not placed in two clusters.
+	creating map[string]bool
+	// counts caches the numbers of the environments, keyed by the
+	// clusters.
+	counts map[string]clusterCount
+}
+
+type clusterCount struct {
+	environments int
+	listedAt     time.Time
+}
+
+var (
+	_ runtime.Runtime   = &Runtime{}
+	_ runtime.Recreator = &Runtime{}
+)
+
+func New(clusters []Cluster) *Runtime {
+	return &Runtime{
+		clusters:   clusters,
+		placements: map[string]*Cluster{},
+		creating:   map[string]bool{},
+		counts:     map[string]clusterCount{},
+	}
+}
+
+// Create places the environment in the requested cluster, or the one
+// with the fewest environments of the clusters matching the selector.
+// The placement is recorded in the annotation of the environment. The
+// concurrent creates of the name in the replica fail with a conflict.
+func (r *Runtime) Create(ctx context.Context, opt runtime.CreateOptions) error {
+	if !r.reserve(opt.Name) {
+		return errdefs.Conflict(errors.Newf("environment %s is being created", opt.Name))
+	}
+	defer r.release(opt.Name)
+	_, _, err := r.locate(ctx, "", opt.Name)
+	if err == nil || errdefs.IsUnauthorized(err) {
+		return errdefs.Conflict(errors.Newf("environment %s already exists", opt.Name))
+	}
+	if !errdefs.IsNotFound(err) {
+		return err
+	}
+	c, err := r.place(ctx, opt)
+	if err != nil {
+		return err
+	}
+	annotations := map[string]string{}
+	for k, v := range opt.Annotations {
+		annotations[k] = v
+	}
+	annotations[consts.PodAnnotationCluster] = c.Name
+	opt.Annotations = annotations
+	if err := c.Runtime.Create(ctx, opt); err != nil {
+		return errors.Wrapf(err, "failed to create the environment in cluster %s", c.Name)
+	}
+	logrus.WithFields(logrus.Fields{
+		"environment": opt.Name,
+		"cluster":     c.Name,
+	}).Debug("environment placed")
+	r.remember(opt.Name, c)
+	r.adjustCount(c.Name, 1)
+	return nil
+}
+
+func (r *Runtime) Get(ctx context.Context, owner, name string) (types.Environment, error) {
+	_, e, err := r.locate(ctx, owner, name)
+	return e, err
+}
+
+func (r *Runtime) List(ctx context.Context, owner string) ([]types.Environment, error) {
+	var envs []types.Environment
+	for i := range r.clusters {
+		c := &r.clusters[i]
+		list, err := c.Runtime.List(ctx, owner)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to list the environments in cluster %s", c.Name)
+		}
+		if owner == "" {
+			r.setCount(c.Name, len(list))
+		}
+		for _, e := range list {
+			e.Spec.Cluster = c.Name
+			r.remember(e.Name, c)
+			envs = append(envs, e)
+		}
+	}
+	sort.SliceStable(envs, func(i, j int) bool {
+		return envs[i].Name < envs[j].Name
+	})
+	return envs, nil
+}
+
+func (r *Runtime) Remove(ctx context.Context, owner, name string) error {
+	c, _, err := r.locate(ctx, owner, name)
+	if errdefs.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := c.Runtime.Remove(ctx, owner, name); err != nil {
+		return err
+	}
+	r.forget(name)
+	r.adjustCount(c.Name, -1)
+	return nil
+}
+
+func (r *Runtime) Logs(ctx context.Context, owner, name string,
+	opt runtime.LogOptions) (io.ReadCloser, error) {
+	c, _, err := r.locate(ctx, owner, name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Runtime.Logs(ctx, owner, name, opt)
+}
+
+func (r *Runtime) Exec(ctx context.Context, owner, name string,
+	opt runtime.ExecOptions) (int, error) {
+	c, _, err := r.locate(ctx, owner, name)
+	if err != nil {
+		return 0, err
+	}
+	return c.Runtime.Exec(ctx, owner, name, opt)
+}
+
+// Ping checks all the clusters.
+func (r *Runtime) Ping(ctx context.Context) error {
+	var errs error
+	for _, c := range r.clusters {
+		if err := c.Runtime.Ping(ctx); err != nil {
+			errs = errors.CombineErrors(errs, errors.Wrapf(err, "cluster %s", c.Name))
+		}
+	}
+	return errs
+}
+
+func (r *Runtime) Recreate(ctx context.Context, name string, annotations map[string]string) error {
+	c, _, err := r.locate(ctx, "", name)
+	if err != nil {
+		return err
+	}
+	recreator, ok := c.Runtime.(runtime.Recreator)
+	if !ok {
+		return errdefs.NotImplemented(errors.Newf(
+			"cluster %s does not support recreating the environments", c.Name))
+	}
+	return recreator.Recreate(ctx, name, annotations)
+}
+
+// place returns the cluster of the new environment.
+func (r *Runtime) place(ctx context.Context, opt runtime.CreateOptions) (*Cluster, error) {
+	if opt.Cluster != "" && r.cluster(opt.Cluster) == nil {
+		return nil, errdefs.InvalidParameter(errors.Newf("unknown cluster %s", opt.Cluster))
+	}
+	var best *Cluster
+	bestCount, matched := 0, 0
+	for i := range r.clusters {
+		c := &r.clusters[i]
+		if opt.Cluster != "" && c.Name != opt.Cluster {
+			continue
+		}
+		if !matches(c.Labels, opt.ClusterSelector) {
+			continue
+		}
+		matched++
+		n, err := r.count(ctx, c)
+		if err != nil {
+			if opt.Cluster != "" {
+				return nil, errors.Wrapf(err, "failed to list the environments in cluster %s", c.Name)
+			}
+			logrus.WithError(err).WithField("cluster", c.Name).
+				Warn("skip the unreachable cluster")
+			continue
+		}
+		if c.MaxEnvironments > 0 && n >= c.MaxEnvironments {
+			continue
+		}
+		if best == nil || n < bestCount {
+			best, bestCount = c, n
+		}
+	}
+	switch {
+	case best != nil:
+		return best, nil
+	case matched == 0:
+		return nil, errdefs.InvalidParameter(errors.Newf(
+			"no cluster matches the selector %v", opt.ClusterSelector))
+	default:
+		return nil, errdefs.Unavailable(errors.New(
+			"no cluster has the capacity for the environment"))
+	}
+}
+
+// locate returns the cluster of the environment, and the environment
+// with the cluster in the spec.
+func (r *Runtime) locate(ctx context.Context, owner, name string) (*Cluster, types.Environment, error) {
+	r.mu.Lock()
+	cached := r.placements[name]
+	r.mu.Unlock()
+	if cached != nil {
+		e, err := cached.Runtime.Get(ctx, owner, name)
+		if err == nil {
+			e.Spec.Cluster = cached.Name
+		}
+		if !errdefs.IsNotFound(err) {
+			return cached, e, err
+		}
+		r.forget(name)
+	}
+
+	// The environment is found if the other clusters are unreachable.
+	var unreachable error
+	for i := range r.clusters {
+		c := &r.clusters[i]
+		e, err := c.Runtime.Get(ctx, owner, name)
+		switch {
+		case errdefs.IsNotFound(err):
+			continue
+		case err != nil && !errdefs.IsUnauthorized(err):
+			unreachable = errors.CombineErrors(unreachable,
+				errors.Wrapf(err, "failed to get the environment in cluster %s", c.Name))
+			continue
+		}
+		r.remember(name, c)
+		if err == nil {
+			e.Spec.Cluster = c.Name
+		}
+		return c, e, err
+	}
+	if unreachable != nil {
+		return nil, types.Environment{}, unreachable
+	}
+	return nil, types.Environment{}, errdefs.NotFound(
+		errors.Newf("environment %s not found", name))
+}
+
+func (r *Runtime) cluster(name string) *Cluster {
+	for i := range r.clusters {
+		if r.clusters[i].Name == name {
+			return &r.clusters[i]
+		}
+	}
+	return nil
+}
+
+// count returns the number of the environments in the cluster, which is
+// listed if the cached one is expired.
+func (r *Runtime) count(ctx context.Context, c *Cluster) (int, error) {
+	r.mu.Lock()
+	cached, ok := r.counts[c.Name]
+	r.mu.Unlock()
+	if ok && time.Since(cached.listedAt) < countTTL {
+		return cached.environments, nil
+	}
+	envs, err := c.Runtime.List(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+	r.setCount(c.Name, len(envs))
+	return len(envs), nil
+}
+
+func (r *Runtime) setCount(cluster string, n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counts[cluster] = clusterCount{environments: n, listedAt: time.Now()}
+}
+
+// adjustCount updates the cached number of the environments, if any,
+// without extending it.
+func (r *Runtime) adjustCount(cluster string, delta int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cached, ok := r.counts[cluster]; ok {
+		cached.environments += delta
+		if cached.environments < 0 {
+			cached.environments = 0
+		}
+		r.counts[cluster] = cached
+	}
+}
+
+// reserve returns false if the environment is being created already.
+func (r *Runtime) reserve(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.creating[name] {
+		return false
+	}
+	r.creating[name] = true
+	return true
+}
+
+func (r *Runtime) release(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.creating, name)
+}
+
+func (r *Runtime) remember(name string, c *Cluster) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.placements[name] = c
+}
+
+func (r *Runtime) forget(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.placements, name)
+}
+
+// matches returns true if the labels have all the pairs of the selector.
+func matches(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
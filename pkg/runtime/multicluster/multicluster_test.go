@@ -0,0 +1,247 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package multicluster
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+	"github.com/tensorchord/envd-server/pkg/runtime/conformance"
+	k8sruntime "github.com/tensorchord/envd-server/pkg/runtime/kubernetes"
+)
+
+func environmentConfig() config.EnvironmentConfig {
+	return config.Default().Environment
+}
+
+// newClusters returns the clusters of the fake clientsets, gpu has the
+// capacity of one environment.
+func newClusters() ([]Cluster, map[string]*fake.Clientset) {
+	clients := map[string]*fake.Clientset{
+		"cpu": fake.NewSimpleClientset(),
+		"gpu": fake.NewSimpleClientset(),
+	}
+	return []Cluster{
+		{
+			Name:    "cpu",
+			Labels:  map[string]string{"gpu": "none"},
+			Runtime: k8sruntime.New(clients["cpu"], nil, environmentConfig),
+		},
+		{
+			Name:            "gpu",
+			Labels:          map[string]string{"gpu": "a100"},
+			MaxEnvironments: 1,
+			Runtime:         k8sruntime.New(clients["gpu"], nil, environmentConfig),
+		},
+	}, clients
+}
+
+func TestConformance(t *testing.T) {
+	clusters, _ := newClusters()
+	// The fake clientsets do not serve exec.
+	conformance.Run(t, New(clusters), conformance.Options{SkipExec: true})
+}
+
+func TestPlacement(t *testing.T) {
+	clusters, clients := newClusters()
+	rt := New(clusters)
+	ctx := context.Background()
+
+	// The cases run in order, the environments are kept.
+	tcs := []struct {
+		name            string
+		cluster         string
+		selector        map[string]string
+		expected        string
+		expectedInvalid bool
+		expectedFull    bool
+		expectedExists  bool
+	}{
+		{name: "a", expected: "cpu"},
+		{name: "b", expected: "gpu"},
+		{name: "c", cluster: "cpu", expected: "cpu"},
+		{name: "d", selector: map[string]string{"gpu": "a100"}, expectedFull: true},
+		{name: "e", cluster: "gpu", expectedFull: true},
+		{name: "f", selector: map[string]string{"gpu": "h100"}, expectedInvalid: true},
+		{name: "g", cluster: "tpu", expectedInvalid: true},
+		{name: "b", cluster: "cpu", expectedExists: true},
+	}
+	for _, tc := range tcs {
+		err := rt.Create(ctx, runtime.CreateOptions{
+			Owner:           "alice",
+			Name:            tc.name,
+			Image:           "python",
+			Cluster:         tc.cluster,
+			ClusterSelector: tc.selector,
+		})
+		switch {
+		case tc.expectedInvalid:
+			if !errdefs.IsInvalidParameter(err) {
+				t.Errorf("Expected the invalid parameter error of %s, got %v", tc.name, err)
+			}
+			continue
+		case tc.expectedFull:
+			if !errdefs.IsUnavailable(err) {
+				t.Errorf("Expected the unavailable error of %s, got %v", tc.name, err)
+			}
+			continue
+		case tc.expectedExists:
+			if !errdefs.IsConflict(err) {
+				t.Errorf("Expected the conflict error of %s, got %v", tc.name, err)
+			}
+			continue
+		case err != nil:
+			t.Errorf("Expected %s created, got %v", tc.name, err)
+			continue
+		}
+		pod, err := clients[tc.expected].CoreV1().Pods(environmentConfig().Namespace).
+			Get(ctx, tc.name, metav1.GetOptions{})
+		if err != nil {
+			t.Errorf("Expected %s in cluster %s, got %v", tc.name, tc.expected, err)
+			continue
+		}
+		if c := pod.Annotations[consts.PodAnnotationCluster]; c != tc.expected {
+			t.Errorf("Expected the placement %s of %s recorded, got %q", tc.expected, tc.name, c)
+		}
+		e, err := rt.Get(ctx, "alice", tc.name)
+		if err != nil || e.Spec.Cluster != tc.expected {
+			t.Errorf("Expected %s got from cluster %s, got %+v, %v", tc.name, tc.expected, e, err)
+		}
+	}
+}
+
+func TestRouting(t *testing.T) {
+	clusters, clients := newClusters()
+	// The environment is created before the cluster joins the runtime,
+	// without the annotation of the placement.
+	err := clusters[1].Runtime.Create(context.Background(), runtime.CreateOptions{
+		Owner: "alice", Name: "legacy", Image: "python"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := New(clusters)
+	ctx := context.Background()
+
+	e, err := rt.Get(ctx, "alice", "legacy")
+	if err != nil || e.Spec.Cluster != "gpu" {
+		t.Errorf("Expected legacy found in cluster gpu, got %+v, %v", e, err)
+	}
+	envs, err := rt.List(ctx, "")
+	if err != nil || len(envs) != 1 || envs[0].Spec.Cluster != "gpu" {
+		t.Errorf("Expected legacy listed in cluster gpu, got %+v, %v", envs, err)
+	}
+	if err := rt.Remove(ctx, "alice", "legacy"); err != nil {
+		t.Errorf("Expected legacy removed, got %v", err)
+	}
+	pods, err := clients["gpu"].CoreV1().Pods(environmentConfig().Namespace).
+		List(ctx, metav1.ListOptions{})
+	if err != nil || len(pods.Items) != 0 {
+		t.Errorf("Expected the pod removed from cluster gpu, got %v, %v", pods, err)
+	}
+	if _, err := rt.Get(ctx, "alice", "legacy"); !errdefs.IsNotFound(err) {
+		t.Errorf("Expected the not found error after removed, got %v", err)
+	}
+}
+
+// slowRuntime blocks the creates until started is closed, and counts the
+// lists of all the environments.
+type slowRuntime struct {
+	runtime.Runtime
+	started chan struct{}
+	lists   int32
+}
+
+func (r *slowRuntime) Create(ctx context.Context, opt runtime.CreateOptions) error {
+	<-r.started
+	return r.Runtime.Create(ctx, opt)
+}
+
+func (r *slowRuntime) List(ctx context.Context, owner string) ([]types.Environment, error) {
+	if owner == "" {
+		atomic.AddInt32(&r.lists, 1)
+	}
+	return r.Runtime.List(ctx, owner)
+}
+
+func TestConcurrentCreate(t *testing.T) {
+	started := make(chan struct{})
+	clusters, clients := newClusters()
+	for i := range clusters {
+		clusters[i].Runtime = &slowRuntime{Runtime: clusters[i].Runtime, started: started}
+	}
+	rt := New(clusters)
+	ctx := context.Background()
+
+	// The creates of the name are placed in the two clusters without the
+	// reservation, since neither has the environment yet.
+	errs := make(chan error, 2)
+	for _, c := range []string{"cpu", "gpu"} {
+		go func(c string) {
+			errs <- rt.Create(ctx, runtime.CreateOptions{
+				Owner: "alice", Name: "mnist", Image: "python", Cluster: c})
+		}(c)
+	}
+	// Wait for one of them to fail before the other is created.
+	var conflicts int
+	if err := <-errs; errdefs.IsConflict(err) {
+		conflicts++
+	} else {
+		t.Errorf("Expected the conflict error of the concurrent create, got %v", err)
+	}
+	close(started)
+	if err := <-errs; err != nil {
+		t.Errorf("Expected one create to succeed, got %v", err)
+	}
+
+	var placed int
+	for _, client := range clients {
+		pods, err := client.CoreV1().Pods(environmentConfig().Namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		placed += len(pods.Items)
+	}
+	if conflicts != 1 || placed != 1 {
+		t.Errorf("Expected the environment placed in one cluster, got %d pods", placed)
+	}
+}
+
+func TestPlacementCount(t *testing.T) {
+	started := make(chan struct{})
+	close(started)
+	clusters, _ := newClusters()
+	cpu := &slowRuntime{Runtime: clusters[0].Runtime, started: started}
+	clusters[0].Runtime = cpu
+	rt := New(clusters)
+	ctx := context.Background()
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := rt.Create(ctx, runtime.CreateOptions{Owner: "alice", Name: name, Image: "python",
+			ClusterSelector: map[string]string{"gpu": "none"}}); err != nil {
+			t.Fatalf("Expected %s created, got %v", name, err)
+		}
+	}
+	if n := atomic.LoadInt32(&cpu.lists); n != 1 {
+		t.Errorf("Expected the environments listed once for the placements, got %d", n)
+	}
+	if err := rt.Remove(ctx, "alice", "a"); err != nil {
+		t.Fatal(err)
+	}
+	rt.mu.Lock()
+	n := rt.counts["cpu"].environments
+	rt.mu.Unlock()
+	if n != 2 {
+		t.Errorf("Expected 2 environments counted in cluster cpu, got %d", n)
+	}
+}
@@ -0,0 +1,121 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package runtime defines the backends which run the environments, e.g.
+// the pods in kubernetes or the containers in a local docker daemon.
+package runtime
+
+import (
+	"context"
+	"io"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/util"
+	"github.com/tensorchord/envd-server/pkg/util/imageutil"
+)
+
+// Runtime runs the environments of the users. The environments of an
+// owner are only visible to the owner, the errors are in the errdefs
+// classes:
+//
+//   - NotFound if the environment does not exist.
+//   - Unauthorized if the environment belongs to another owner.
+//   - Conflict if the name of the new environment is used.
+//
+// The empty owner matches the environments of all the owners, it is
+// used by the server itself.
+type Runtime interface {
+	// Create creates the environment and returns without waiting for it
+	// to be running.
+	Create(ctx context.Context, opt CreateOptions) error
+	Get(ctx context.Context, owner, name string) (types.Environment, error)
+	// List returns the environments sorted by the names.
+	List(ctx context.Context, owner string) ([]types.Environment, error)
+	// Remove removes the environment. It succeeds if the environment
+	// does not exist.
+	Remove(ctx context.Context, owner, name string) error
+	// Logs streams the logs of the environment until the reader is
+	// closed, or the environment stops if it is followed.
+	Logs(ctx context.Context, owner, name string, opt LogOptions) (io.ReadCloser, error)
+	// Exec runs the command in the environment and returns the exit
+	// code after it exits.
+	Exec(ctx context.Context, owner, name string, opt ExecOptions) (int, error)
+	// Ping checks if the backend is reachable.
+	Ping(ctx context.Context) error
+}
+
+// Recreator is implemented by the runtimes which can recreate the
+// environment with the same spec, e.g. to mount the rotated host key.
+type Recreator interface {
+	// Recreate deletes the environment and creates it again with the
+	// annotations merged. The data out of the volumes is lost.
+	Recreate(ctx context.Context, name string, annotations map[string]string) error
+}
+
+type CreateOptions struct {
+	Owner string
+	Name  string
+	Image string
+	// Annotations are kept in the environment, and returned as the
+	// labels if they have the envd prefix.
+	Annotations map[string]string
+	// WorkingDir is the project directory in the environment.
+	WorkingDir string
+	// RepoURL is cloned in the working directory if it is not empty.
+	RepoURL string
+	// Cluster and ClusterSelector place the environment in one of the
+	// clusters, they are ignored by the runtimes of a single cluster.
+	Cluster         string
+	ClusterSelector map[string]string
+}
+
+type LogOptions struct {
+	Follow bool
+	// TailLines is the number of the lines from the end, all the logs
+	// are returned if it is not positive.
+	TailLines int64
+}
+
+// ExecOptions runs the command without the stdin and the TTY.
+type ExecOptions struct {
+	Cmd    []string
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewEnvironment returns the environment of the runtime object. Only the
+// annotations with the envd prefix are returned as the labels.
+func NewEnvironment(name, image, phase string,
+	annotations map[string]string) (types.Environment, error) {
+	e := types.Environment{
+		ObjectMeta: types.ObjectMeta{
+			Name:   name,
+			Labels: util.Filter(annotations, util.IsEnvdLabel),
+		},
+		Spec: types.EnvironmentSpec{
+			Image:     image,
+			SSHPolicy: annotations[consts.PodAnnotationSSHPolicy],
+			Cluster:   annotations[consts.PodAnnotationCluster],
+		},
+		Status: types.EnvironmentStatus{
+			Phase: phase,
+		},
+	}
+	if jupyterAddr, ok := annotations[consts.PodLabelJupyterAddr]; ok {
+		e.Status.JupyterAddr = &jupyterAddr
+	}
+	if rstudioServerAddr, ok := annotations[consts.PodLabelRStudioServerAddr]; ok {
+		e.Status.RStudioServerAddr = &rstudioServerAddr
+	}
+	// The ports are missing if the object is not created by envd-server.
+	if label, ok := annotations[consts.ImageLabelPorts]; ok {
+		ports, err := imageutil.PortsFromLabel(label)
+		if err != nil {
+			return e, err
+		}
+		e.Spec.Ports = ports
+	}
+	return e, nil
+}
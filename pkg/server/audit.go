@@ -0,0 +1,210 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/query"
+)
+
+const (
+	AuditActionUserAuth          = "user.auth"
+	AuditActionEnvironmentCreate = "environment.create"
+	AuditActionEnvironmentRemove = "environment.remove"
+	AuditActionEnvironmentExec   = "environment.exec"
+	AuditActionSSHAuth           = "ssh.auth"
+	AuditActionHostKeyCreate     = "hostkey.create"
+	AuditActionHostKeyActivate   = "hostkey.activate"
+	AuditActionHostKeyRoll       = "hostkey.roll"
+	AuditActionHostKeyRemove     = "hostkey.remove"
+
+	// auditActorAdmin is the actor of the requests to the admin router.
+	auditActorAdmin = "admin"
+
+	auditRecordKey = "audit_record"
+
+	defaultAuditListLimit = 100
+	maxAuditListLimit     = 1000
+)
+
+type auditRoute struct {
+	action     string
+	targetType string
+}
+
+// auditRoutes names the actions of the audited routes, keyed by the
+// method and the route. The mutating routes which are not named here
+// are audited as well, with the method and the route as the action.
+var auditRoutes = map[string]auditRoute{
+	"POST /v1/auth":   {AuditActionUserAuth, "user"},
+	"POST /v1/pubkey": {AuditActionSSHAuth, "environment"},
+	"POST /v1/users/:identity_token/environments":            {AuditActionEnvironmentCreate, "environment"},
+	"DELETE /v1/users/:identity_token/environments/:name":    {AuditActionEnvironmentRemove, "environment"},
+	"POST /v1/users/:identity_token/environments/:name/exec": {AuditActionEnvironmentExec, "environment"},
+	"POST /hostkeys":                {AuditActionHostKeyCreate, "hostkey"},
+	"POST /hostkeys/:name/activate": {AuditActionHostKeyActivate, "hostkey"},
+	"POST /hostkeys/roll":           {AuditActionHostKeyRoll, "hostkey"},
+	"DELETE /hostkeys/:name":        {AuditActionHostKeyRemove, "hostkey"},
+}
+
+// unauditedRoutes are the mutating routes which are not audited, since
+// they are called by containerssh for every connection and recorded in
+// the SSH sessions instead.
+var unauditedRoutes = map[string]bool{
+	"POST /v1/config": true,
+	"POST /session":   true,
+}
+
+// auditRouteOf returns the audited route of the request, and false if it
+// is not audited, e.g. the reads.
+func auditRouteOf(method, path string) (auditRoute, bool) {
+	key := method + " " + path
+	if route, ok := auditRoutes[key]; ok {
+		return route, true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return auditRoute{}, false
+	}
+	if path == "" || unauditedRoutes[key] {
+		return auditRoute{}, false
+	}
+	return auditRoute{action: key}, true
+}
+
+// auditRecord is filled by the handlers with the fields which cannot
+// be inferred from the request, e.g. the target in the request body.
+type auditRecord struct {
+	Actor         string
+	Target        string
+	Outcome       string
+	Message       string
+	SourceAddress string
+}
+
+// auditRecordFrom returns the audit record of the request. It is safe to
+// use in the routes which are not audited.
+func auditRecordFrom(c *gin.Context) *auditRecord {
+	if v, ok := c.Get(auditRecordKey); ok {
+		if rec, ok := v.(*auditRecord); ok {
+			return rec
+		}
+	}
+	return &auditRecord{}
+}
+
+// AuditMiddleware persists an audit log for every audited route after the
+// request is handled, including the ones rejected by the auth middleware.
+// It is used on both the API and the admin routers.
+func (s *Server) AuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route, ok := auditRouteOf(c.Request.Method, c.FullPath())
+		if !ok {
+			c.Next()
+			return
+		}
+		rec := &auditRecord{}
+		c.Set(auditRecordKey, rec)
+		c.Next()
+
+		if rec.Actor == "" {
+			rec.Actor = c.GetString("identity_token")
+		}
+		if rec.Actor == "" {
+			rec.Actor = c.Param("identity_token")
+		}
+		if rec.Target == "" {
+			rec.Target = c.Param("name")
+		}
+		if rec.SourceAddress == "" {
+			rec.SourceAddress = c.ClientIP()
+		}
+		if rec.Outcome == "" {
+			rec.Outcome = auditOutcome(c.Writer.Status())
+		}
+		if err := c.Errors.Last(); err != nil && rec.Message == "" {
+			rec.Message = err.Error()
+		}
+
+		// The request context may be cancelled already, the audit log
+		// should be persisted anyway.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Storage.CreateAuditLog(ctx, query.CreateAuditLogParams{
+			RequestID:     c.GetString(requestIDKey),
+			Actor:         rec.Actor,
+			Action:        route.action,
+			TargetType:    route.targetType,
+			Target:        rec.Target,
+			Outcome:       rec.Outcome,
+			Message:       rec.Message,
+			SourceAddress: rec.SourceAddress,
+		}); err != nil {
+			requestLogger(c).WithError(err).Warn("failed to write the audit log")
+		}
+	}
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status >= http.StatusInternalServerError:
+		return types.AuditOutcomeError
+	case status >= http.StatusBadRequest:
+		return types.AuditOutcomeFailure
+	default:
+		return types.AuditOutcomeSuccess
+	}
+}
+
+// auditList lists the audit logs in the reverse order of creation.
+// It is served on the admin router.
+func (s *Server) auditList(c *gin.Context) {
+	var req types.AuditLogListRequest
+	if err := c.BindQuery(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultAuditListLimit
+	} else if req.Limit > maxAuditListLimit {
+		req.Limit = maxAuditListLimit
+	}
+
+	logs, err := s.Storage.ListAuditLogs(c, query.ListAuditLogsParams{
+		Actor:    req.Actor,
+		Action:   req.Action,
+		BeforeID: req.Before,
+		MaxItems: req.Limit,
+	})
+	if err != nil {
+		respondWithError(c, errors.Wrap(err, "failed to list the audit logs"))
+		return
+	}
+
+	res := types.AuditLogListResponse{Items: []types.AuditLog{}}
+	for _, l := range logs {
+		res.Items = append(res.Items, types.AuditLog{
+			ID:            l.ID,
+			CreatedAt:     l.CreatedAt,
+			RequestID:     l.RequestID,
+			Actor:         l.Actor,
+			Action:        l.Action,
+			TargetType:    l.TargetType,
+			Target:        l.Target,
+			Outcome:       l.Outcome,
+			Message:       l.Message,
+			SourceAddress: l.SourceAddress,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
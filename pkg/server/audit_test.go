@@ -0,0 +1,33 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"testing"
+)
+
+func TestAuditRouteOf(t *testing.T) {
+	tcs := []struct {
+		method         string
+		path           string
+		expectedAction string
+	}{
+		{method: "POST", path: "/v1/users/:identity_token/environments", expectedAction: AuditActionEnvironmentCreate},
+		{method: "DELETE", path: "/hostkeys/:name", expectedAction: AuditActionHostKeyRemove},
+		// The mutating routes are audited without the names.
+		{method: "PUT", path: "/v1/users/:identity_token/quota", expectedAction: "PUT /v1/users/:identity_token/quota"},
+		{method: "GET", path: "/v1/users/:identity_token/environments"},
+		{method: "GET", path: "/audit"},
+		{method: "POST", path: "/session"},
+		// The requests not matching any route.
+		{method: "POST", path: ""},
+	}
+	for _, tc := range tcs {
+		route, ok := auditRouteOf(tc.method, tc.path)
+		if ok != (tc.expectedAction != "") || route.action != tc.expectedAction {
+			t.Errorf("Expected action %q of %s %s, got %q", tc.expectedAction, tc.method, tc.path, route.action)
+		}
+	}
+}
@@ -5,13 +5,14 @@
 package server
 
 import (
-	"context"
+	"net/http"
 
+	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
 	"github.com/tensorchord/envd-server/pkg/query"
 )
 
@@ -22,28 +23,32 @@ import (
 // @Produce     json
 // @Param       request body     types.AuthRequest true "query params"
 // @Success     200     {object} types.AuthResponse
+// @Failure     400     {object} types.ErrorResponse
+// @Failure     500     {object} types.ErrorResponse
+// @Failure     429     {object} types.ErrorResponse
 // @Router      /auth [post]
 func (s *Server) auth(c *gin.Context) {
 	var req types.AuthRequest
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(500, err)
+		respondWithError(c, errdefs.InvalidParameter(err))
 		return
 	}
+	auditRecordFrom(c).Actor = req.IdentityToken
 
 	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey))
 	if err != nil {
-		c.JSON(500, err)
+		respondWithError(c, errdefs.InvalidParameter(
+			errors.Wrap(err, "failed to parse the public key")))
 		return
 	}
-	_, err = s.Queries.CreateUser(context.Background(), query.CreateUserParams{IdentityToken: req.IdentityToken, PublicKey: key.Marshal()})
+	_, err = s.Storage.CreateUser(c, query.CreateUserParams{IdentityToken: req.IdentityToken, PublicKey: key.Marshal()})
 	if err != nil {
-		logrus.Warnf("Create error: %+v", err)
-		c.JSON(500, err)
+		respondWithError(c, errors.Wrap(err, "failed to create the user"))
 		return
 	}
 	res := types.AuthResponse{
 		IdentityToken: req.IdentityToken,
 		Status:        "login succeeded",
 	}
-	c.JSON(200, res)
+	c.JSON(http.StatusOK, res)
 }
@@ -5,37 +5,34 @@
 package server
 
 import (
-	"context"
-	"fmt"
-	"net/http"
+	"crypto/subtle"
+	"strings"
 
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v4"
 
 	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/storage"
 )
 
 func (s *Server) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		amr := types.AuthMiddlewareRequest{}
 		if err := c.BindUri(&amr); err != nil {
-			respondWithError(c, http.StatusUnauthorized,
-				fmt.Sprintf("auth failed: %v", err))
-			c.Next()
+			respondWithError(c, errdefs.Unauthorized(
+				errors.Wrap(err, "auth failed")))
 			return
 		}
-		_, err := s.Queries.GetUser(context.Background(), amr.IdentityToken)
+		_, err := s.Storage.GetUser(c, amr.IdentityToken)
 		if err != nil {
-			if errors.Is(err, pgx.ErrNoRows) {
-				respondWithError(c, http.StatusUnauthorized,
-					"failed to auth the identity_token")
-				return
-			} else {
-				respondWithError(c, http.StatusInternalServerError,
-					fmt.Sprintf("failed to query the identity_token: %v", err))
+			if errors.Is(err, storage.ErrNotFound) {
+				respondWithError(c, errdefs.Unauthorized(
+					errors.New("failed to auth the identity_token")))
 				return
 			}
+			respondWithError(c, errors.Wrap(err, "failed to query the identity_token"))
+			return
 		} else {
 			c.Set("identity_token", amr.IdentityToken)
 			c.Next()
@@ -48,9 +45,8 @@ func (s *Server) NoAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		amr := types.AuthMiddlewareRequest{}
 		if err := c.BindUri(&amr); err != nil {
-			respondWithError(c, http.StatusUnauthorized,
-				fmt.Sprintf("auth failed: %v", err))
-			c.Next()
+			respondWithError(c, errdefs.Unauthorized(
+				errors.Wrap(err, "auth failed")))
 			return
 		}
 
@@ -59,7 +55,21 @@ func (s *Server) NoAuthMiddleware() gin.HandlerFunc {
 	}
 }
 
-// nolint:unparam
-func respondWithError(c *gin.Context, code int, message interface{}) {
-	c.AbortWithStatusJSON(code, gin.H{"error": message})
+// AdminAuthMiddleware requires the admin token as the bearer token of the
+// admin API. The admin API is open if the token is not set, which is only
+// allowed on the loopback address, see config.Config.Validate.
+func (s *Server) AdminAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.adminToken != "" {
+			token := c.GetHeader("Authorization")
+			if !strings.HasPrefix(token, "Bearer ") || subtle.ConstantTimeCompare(
+				[]byte(strings.TrimPrefix(token, "Bearer ")), []byte(s.adminToken)) != 1 {
+				respondWithError(c, errdefs.Unauthorized(
+					errors.New("failed to auth the admin token")))
+				return
+			}
+		}
+		auditRecordFrom(c).Actor = auditActorAdmin
+		c.Next()
+	}
 }
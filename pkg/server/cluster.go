@@ -0,0 +1,91 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+	k8sruntime "github.com/tensorchord/envd-server/pkg/runtime/kubernetes"
+	"github.com/tensorchord/envd-server/pkg/runtime/multicluster"
+	"github.com/tensorchord/envd-server/pkg/tracing"
+)
+
+// newClusterRuntime returns the runtime placing the environments in the
+// clusters, each with the client of the kubeconfig and the context.
+func (s *Server) newClusterRuntime(clusters []config.ClusterConfig) (runtime.Runtime, error) {
+	placed := make([]multicluster.Cluster, 0, len(clusters))
+	s.clusterClients = make(map[string]kubernetes.Interface, len(clusters))
+	for _, c := range clusters {
+		k8sConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: c.KubeConfig},
+			&clientcmd.ConfigOverrides{CurrentContext: c.Context}).ClientConfig()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to load the config of cluster %s", c.Name)
+		}
+		k8sConfig.Wrap(tracing.WrapTransport)
+		cli, err := kubernetes.NewForConfig(k8sConfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create the client of cluster %s", c.Name)
+		}
+		s.clusterClients[c.Name] = cli
+		placed = append(placed, multicluster.Cluster{
+			Name:            c.Name,
+			Labels:          c.Labels,
+			MaxEnvironments: c.MaxEnvironments,
+			Runtime:         k8sruntime.New(cli, k8sConfig, s.EnvironmentConfig),
+		})
+	}
+	return multicluster.New(placed), nil
+}
+
+// sshHost returns the host of the environment for containerssh, which is
+// the name unless the cluster of the environment has the SSH domain.
+func (s *Server) sshHost(ctx context.Context, name string) string {
+	if len(s.clusters) == 0 {
+		return name
+	}
+	e, err := s.runtime.Get(ctx, "", name)
+	if err != nil {
+		// The connection fails later if the environment is missing.
+		logrus.WithError(err).WithField("environment", name).
+			Debug("failed to get the cluster of the environment")
+		return name
+	}
+	for _, c := range s.clusters {
+		if c.Name == e.Spec.Cluster && c.SSHDomain != "" {
+			return name + "." + c.SSHDomain
+		}
+	}
+	return name
+}
+
+// @Summary     List the clusters.
+// @Description List the clusters the environments can be placed in, it is empty if there is only one.
+// @Tags        cluster
+// @Accept      json
+// @Produce     json
+// @Param       identity_token path     string true "identity token" example("a332139d39b89a241400013700e665a3")
+// @Success     200            {object} types.ClusterListResponse
+// @Router      /users/{identity_token}/clusters [get]
+func (s *Server) clusterList(c *gin.Context) {
+	res := types.ClusterListResponse{Items: []types.Cluster{}}
+	for _, cluster := range s.clusters {
+		res.Items = append(res.Items, types.Cluster{
+			Name:   cluster.Name,
+			Labels: cluster.Labels,
+		})
+	}
+	c.JSON(http.StatusOK, res)
+}
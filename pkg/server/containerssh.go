@@ -5,19 +5,23 @@
 package server
 
 import (
-	"context"
 	"crypto/subtle"
 	"encoding/json"
+	"fmt"
+	"net"
 
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v4"
 	"github.com/sirupsen/logrus"
 	"go.containerssh.io/libcontainerssh/auth"
 	"go.containerssh.io/libcontainerssh/config"
 	"golang.org/x/crypto/ssh"
 
-	"github.com/tensorchord/envd-server/sshname"
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	envdconfig "github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/metrics"
+	"github.com/tensorchord/envd-server/pkg/storage"
 )
 
 // @Summary     Update the config of containerssh.
@@ -31,26 +35,48 @@ import (
 func (s *Server) OnConfig(c *gin.Context) {
 	var req config.Request
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(500, err)
+		respondWithError(c, errdefs.InvalidParameter(err))
 		return
 	}
 
-	_, name, err := sshname.GetInfo(req.Username)
+	owner, name, err := s.sshTarget(req.Username)
 	if err != nil {
-		c.JSON(500, err)
+		respondWithError(c, errdefs.InvalidParameter(err))
 		return
 	}
 
-	cfg := config.AppConfig{
-		Backend: "sshproxy",
-		SSHProxy: config.SSHProxyConfig{
-			Server:   name,
-			Port:     2222,
-			Username: "envd",
-		},
-	}
-	fingerprints := s.serverFingerPrints
-	cfg.SSHProxy.AllowedHostKeyFingerprints = fingerprints
+	var cfg config.AppConfig
+	env := name
+	if s.ssh.Backend == envdconfig.SSHBackendKubernetes {
+		// The sessions run in the images, not the environments.
+		env = ""
+		cfg, err = s.kubernetesBackendConfig(c, owner, name)
+		if err != nil {
+			respondWithError(c, err)
+			return
+		}
+	} else {
+		envCfg := s.EnvironmentConfig()
+		cfg = config.AppConfig{
+			Backend: "sshproxy",
+			SSHProxy: config.SSHProxyConfig{
+				Server:   s.sshHost(c, name),
+				Port:     uint16(envCfg.SSHPort),
+				Username: envCfg.SSHUser,
+			},
+		}
+		cfg.SSHProxy.AllowedHostKeyFingerprints = s.hostKeyFingerprints()
+	}
+	cfg.Security, err = s.sshSecurityConfig(c, owner, env)
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	var addr string
+	if req.RemoteAddress.IP != nil {
+		addr = req.RemoteAddress.IP.String()
+	}
+	s.startSession(c, req.ConnectionID, owner, name, addr)
 	res := config.ResponseBody{
 		Config: cfg,
 	}
@@ -68,48 +94,97 @@ func (s *Server) OnConfig(c *gin.Context) {
 func (s *Server) OnPubKey(c *gin.Context) {
 	var req auth.PublicKeyAuthRequest
 	if err := c.BindJSON(&req); err != nil {
-		logrus.WithError(err).WithField("req", req).Error("failed to bind the json")
-		c.JSON(500, err)
+		requestLogger(c).WithError(err).WithField("req", req).Error("failed to bind the json")
+		metrics.SSHAuthTotal.WithLabelValues(metrics.ResultError).Inc()
+		respondWithError(c, errdefs.InvalidParameter(err))
 		return
 	}
 
-	owner, _, err := sshname.GetInfo(req.Username)
+	rec := auditRecordFrom(c)
+	if req.RemoteAddress.IP != nil {
+		rec.SourceAddress = req.RemoteAddress.IP.String()
+	}
+	owner, name, err := s.sshTarget(req.Username)
 	if err != nil {
-		c.JSON(500, err)
+		metrics.SSHAuthTotal.WithLabelValues(metrics.ResultError).Inc()
+		respondWithError(c, errdefs.InvalidParameter(err))
 		return
 	}
+	rec.Actor = owner
+	rec.Target = name
 
-	user, err := s.Queries.GetUser(context.Background(), owner)
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey.PublicKey))
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			logrus.WithError(err).Error("user not found")
-			c.JSON(500, "user not found")
-			return
-		} else {
-			logrus.WithError(err).Errorf("db query failed: %v", err)
-			c.JSON(500, "Internal error")
-			return
-		}
+		metrics.SSHAuthTotal.WithLabelValues(metrics.ResultError).Inc()
+		respondWithError(c, errdefs.InvalidParameter(
+			errors.Wrap(err, "failed to parse key")))
+		return
 	}
-	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(req.PublicKey.PublicKey))
+	if cert, ok := key.(*ssh.Certificate); ok {
+		s.authenticateCertificate(c, owner, cert, req.RemoteAddress.IP)
+		return
+	}
+
+	user, err := s.Storage.GetUser(c, owner)
 	if err != nil {
-		logrus.WithError(err).Error("failed to parse key")
-		c.JSON(500, err)
+		if errors.Is(err, storage.ErrNotFound) {
+			requestLogger(c).WithField("owner", owner).Info("user not found")
+			metrics.SSHAuthTotal.WithLabelValues(metrics.ResultFailure).Inc()
+			rec.Outcome = types.AuditOutcomeFailure
+			rec.Message = "user not found"
+			c.JSON(200, auth.ResponseBody{Success: false})
+			return
+		}
+		metrics.SSHAuthTotal.WithLabelValues(metrics.ResultError).Inc()
+		respondWithError(c, errors.Wrap(err, "failed to get the user"))
 		return
 	}
 	if subtle.ConstantTimeCompare(key.Marshal(), user.PublicKey) == 1 {
+		metrics.SSHAuthTotal.WithLabelValues(metrics.ResultSuccess).Inc()
 		res := auth.ResponseBody{
 			Success: true,
 		}
 		c.JSON(200, res)
 		return
 	}
+	metrics.SSHAuthTotal.WithLabelValues(metrics.ResultFailure).Inc()
+	rec.Outcome = types.AuditOutcomeFailure
+	rec.Message = "public key mismatch"
 	res := auth.ResponseBody{
 		Success: false,
 	}
 	c.JSON(200, res)
 }
 
+// authenticateCertificate responds whether the certificate authenticates
+// the owner. The users are not required to be registered.
+func (s *Server) authenticateCertificate(c *gin.Context, owner string, cert *ssh.Certificate, addr net.IP) {
+	rec := auditRecordFrom(c)
+	err := errors.New("certificate authentication is disabled")
+	if s.certAuthority != nil {
+		err = s.certAuthority.authenticate(owner, cert, addr)
+	}
+	if err != nil {
+		requestLogger(c).WithError(err).WithFields(logrus.Fields{
+			"owner":  owner,
+			"key_id": cert.KeyId,
+		}).Info("certificate denied")
+		metrics.SSHAuthTotal.WithLabelValues(metrics.ResultFailure).Inc()
+		rec.Outcome = types.AuditOutcomeFailure
+		rec.Message = err.Error()
+		c.JSON(200, auth.ResponseBody{Success: false})
+		return
+	}
+	requestLogger(c).WithFields(logrus.Fields{
+		"owner":  owner,
+		"key_id": cert.KeyId,
+		"serial": cert.Serial,
+	}).Debug("certificate accepted")
+	metrics.SSHAuthTotal.WithLabelValues(metrics.ResultSuccess).Inc()
+	rec.Message = fmt.Sprintf("certificate %q serial %d", cert.KeyId, cert.Serial)
+	c.JSON(200, auth.ResponseBody{Success: true})
+}
+
 func PrettyStruct(data interface{}) (string, error) {
 	val, err := json.MarshalIndent(data, "", "    ")
 	if err != nil {
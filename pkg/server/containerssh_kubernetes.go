@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	sshconfig "go.containerssh.io/libcontainerssh/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/storage"
+	"github.com/tensorchord/envd-server/sshname"
+)
+
+// sshTarget returns the owner and the target of the ssh username, which is
+// the environment for the sshproxy backend, or the image for the
+// kubernetes backend.
+func (s *Server) sshTarget(username string) (string, string, error) {
+	if s.ssh.Backend == config.SSHBackendKubernetes {
+		return sshname.GetImage(username)
+	}
+	return s.sshNames.Parse(username)
+}
+
+// kubernetesBackendConfig returns the containerssh config to run the
+// session in an ephemeral pod from the image of the owner.
+func (s *Server) kubernetesBackendConfig(ctx context.Context,
+	owner, image string) (sshconfig.AppConfig, error) {
+	info, err := s.Storage.GetImageInfo(ctx,
+		query.GetImageInfoParams{OwnerToken: owner, Name: image})
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return sshconfig.AppConfig{}, errdefs.NotFound(
+				errors.Newf("cannot find the image(%s)", image))
+		}
+		return sshconfig.AppConfig{}, errors.Wrap(err, "cannot get the image info")
+	}
+
+	k := s.ssh.Kubernetes
+	mode := sshconfig.KubernetesExecutionModeConnection
+	if k.Mode == config.SSHKubernetesModeSession {
+		mode = sshconfig.KubernetesExecutionModeSession
+	}
+	return sshconfig.AppConfig{
+		Backend: config.SSHBackendKubernetes,
+		Kubernetes: sshconfig.KubernetesConfig{
+			Connection: sshconfig.KubernetesConnectionConfig{
+				Host:            k.Host,
+				CAData:          s.sshCAData,
+				BearerTokenFile: k.BearerTokenFile,
+			},
+			Pod: sshconfig.KubernetesPodConfig{
+				Metadata: metav1.ObjectMeta{
+					GenerateName: "envd-ssh-",
+					Namespace:    k.Namespace,
+					Labels: map[string]string{
+						consts.PodLabelSessionOwner: owner,
+					},
+				},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:            "shell",
+							Image:           info.Name,
+							ImagePullPolicy: v1.PullIfNotPresent,
+						},
+					},
+					RestartPolicy: v1.RestartPolicyNever,
+				},
+				Mode:         mode,
+				ShellCommand: k.ShellCommand,
+				IdleCommand:  k.IdleCommand,
+				AgentPath:    k.AgentPath,
+				DisableAgent: k.DisableAgent,
+			},
+			Timeouts: sshconfig.KubernetesTimeoutConfig{
+				PodStart: k.PodStartTimeout.Duration,
+			},
+		},
+	}, nil
+}
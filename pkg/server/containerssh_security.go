@@ -0,0 +1,65 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	sshconfig "go.containerssh.io/libcontainerssh/config"
+
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+)
+
+// sshSecurityConfig returns the security settings of the sessions of the
+// owner in the environment. The environment is empty for the kubernetes
+// backend.
+func (s *Server) sshSecurityConfig(ctx context.Context,
+	owner, env string) (sshconfig.SecurityConfig, error) {
+	var name string
+	if env != "" {
+		e, err := s.runtime.Get(ctx, "", env)
+		switch {
+		case errdefs.IsNotFound(err):
+			// The connection fails in sshproxy anyway.
+		case err != nil:
+			return sshconfig.SecurityConfig{}, errors.Wrapf(err,
+				"failed to get the ssh policy of environment %s", env)
+		default:
+			name = e.Spec.SSHPolicy
+		}
+	}
+	// The unknown policy denies the sessions, instead of loosening them.
+	p, err := s.ssh.Security.Policy(owner, name)
+	if err != nil {
+		return sshconfig.SecurityConfig{}, err
+	}
+	return securityConfig(p), nil
+}
+
+// securityConfig converts the policy to the containerssh settings.
+func securityConfig(p config.SSHSecurityPolicy) sshconfig.SecurityConfig {
+	mode := func(m string) sshconfig.SecurityExecutionPolicy {
+		return sshconfig.SecurityExecutionPolicy(m)
+	}
+	return sshconfig.SecurityConfig{
+		Env: sshconfig.SecurityEnvConfig{
+			Mode:  mode(p.Env),
+			Allow: p.AllowedEnv,
+		},
+		Subsystem: sshconfig.SecuritySubsystemConfig{
+			Mode: mode(p.SFTP),
+		},
+		Forwarding: sshconfig.ForwardingConfig{
+			ForwardingMode:        mode(p.Forwarding),
+			SocketForwardingMode:  mode(p.Forwarding),
+			ReverseForwardingMode: mode(p.ReverseForwarding),
+			SocketListenMode:      mode(p.ReverseForwarding),
+			X11ForwardingMode:     mode(p.X11Forwarding),
+		},
+		MaxSessions: p.MaxSessions,
+	}
+}
@@ -0,0 +1,233 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	sshconfig "go.containerssh.io/libcontainerssh/config"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	k8sruntime "github.com/tensorchord/envd-server/pkg/runtime/kubernetes"
+	"github.com/tensorchord/envd-server/pkg/runtime/multicluster"
+	"github.com/tensorchord/envd-server/pkg/storage/postgres"
+	"github.com/tensorchord/envd-server/sshname"
+)
+
+// imageDB serves the image_info rows of the images in it.
+type imageDB struct {
+	images map[string]string
+}
+
+func (db imageDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return nil, nil
+}
+
+func (db imageDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, pgx.ErrNoRows
+}
+
+func (db imageDB) QueryRow(_ context.Context, _ string, args ...interface{}) pgx.Row {
+	owner, name := args[0].(string), args[1].(string)
+	if db.images[name] != owner {
+		return imageRow{err: pgx.ErrNoRows}
+	}
+	return imageRow{owner: owner, name: name}
+}
+
+type imageRow struct {
+	owner, name string
+	err         error
+}
+
+func (r imageRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	*dest[1].(*string) = r.owner
+	*dest[2].(*string) = r.name
+	return dest[6].(*pgtype.JSONB).Set(map[string]string{})
+}
+
+func TestOnConfig(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	kubernetesSSH := config.Default().SSH
+	kubernetesSSH.Backend = config.SSHBackendKubernetes
+	lockedSSH := config.Default().SSH
+	lockedSSH.Security.Policies = map[string]config.SSHSecurityPolicy{
+		"locked": {Forwarding: config.SSHPolicyDisable, SFTP: config.SSHPolicyDisable},
+	}
+	lockedPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "prod",
+		Namespace:   config.Default().Environment.Namespace,
+		Annotations: map[string]string{consts.PodAnnotationSSHPolicy: "locked"},
+	}}
+	remotePod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:      "remote",
+		Namespace: config.Default().Environment.Namespace,
+	}}
+	clusters := []config.ClusterConfig{
+		{Name: "local"},
+		{Name: "remote", SSHDomain: "envd.svc.clusterset.local"},
+	}
+
+	tcs := []struct {
+		ssh              config.SSHConfig
+		formats          []sshname.Format
+		clusters         []config.ClusterConfig
+		username         string
+		expectedCode     int
+		expectedBackend  string
+		expectedTarget   string
+		expectedSessions sshconfig.KubernetesExecutionMode
+		// expectedForwarding is checked if it is not empty.
+		expectedForwarding sshconfig.SecurityExecutionPolicy
+	}{
+		{
+			ssh:                config.Default().SSH,
+			username:           "alice/mnist",
+			expectedCode:       http.StatusOK,
+			expectedBackend:    config.SSHBackendSSHProxy,
+			expectedTarget:     "mnist",
+			expectedForwarding: sshconfig.ExecutionPolicyEnable,
+		},
+		{
+			ssh:                lockedSSH,
+			username:           "alice/prod",
+			expectedCode:       http.StatusOK,
+			expectedBackend:    config.SSHBackendSSHProxy,
+			expectedTarget:     "prod",
+			expectedForwarding: sshconfig.ExecutionPolicyDisable,
+		},
+		{
+			// The policy is removed from the server.
+			ssh:          config.Default().SSH,
+			username:     "alice/prod",
+			expectedCode: http.StatusInternalServerError,
+		},
+		{
+			ssh:             config.Default().SSH,
+			clusters:        clusters,
+			username:        "alice/remote",
+			expectedCode:    http.StatusOK,
+			expectedBackend: config.SSHBackendSSHProxy,
+			expectedTarget:  "remote.envd.svc.clusterset.local",
+		},
+		{
+			ssh:             config.Default().SSH,
+			clusters:        clusters,
+			username:        "alice/mnist",
+			expectedCode:    http.StatusOK,
+			expectedBackend: config.SSHBackendSSHProxy,
+			expectedTarget:  "mnist",
+		},
+		{
+			ssh:          config.Default().SSH,
+			username:     "alice/tensorchord/pytorch:dev",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			ssh:             config.Default().SSH,
+			formats:         []sshname.Format{sshname.FormatDot, sshname.FormatAt},
+			username:        "mnist@alice",
+			expectedCode:    http.StatusOK,
+			expectedBackend: config.SSHBackendSSHProxy,
+			expectedTarget:  "mnist",
+		},
+		{
+			ssh:          config.Default().SSH,
+			formats:      []sshname.Format{sshname.FormatDot, sshname.FormatAt},
+			username:     "mnist.alice@bob",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			ssh:              kubernetesSSH,
+			username:         "alice/tensorchord/pytorch:dev",
+			expectedCode:     http.StatusOK,
+			expectedBackend:  config.SSHBackendKubernetes,
+			expectedTarget:   "tensorchord/pytorch:dev",
+			expectedSessions: sshconfig.KubernetesExecutionModeConnection,
+		},
+		{
+			// The image of another user.
+			ssh:          kubernetesSSH,
+			username:     "bob/tensorchord/pytorch:dev",
+			expectedCode: http.StatusNotFound,
+		},
+	}
+	for _, tc := range tcs {
+		s := &Server{
+			Router:   gin.New(),
+			Storage:  postgres.NewWithDB(imageDB{images: map[string]string{"tensorchord/pytorch:dev": "alice"}}),
+			Client:   fake.NewSimpleClientset(lockedPod),
+			ssh:      tc.ssh,
+			sshNames: sshname.Parser{Formats: tc.formats},
+			clusters: tc.clusters,
+		}
+		s.SetEnvironmentConfig(config.Default().Environment)
+		s.runtime = k8sruntime.New(s.Client, nil, s.EnvironmentConfig)
+		if len(tc.clusters) != 0 {
+			s.runtime = multicluster.New([]multicluster.Cluster{
+				{Name: "local", Runtime: s.runtime},
+				{Name: "remote", Runtime: k8sruntime.New(
+					fake.NewSimpleClientset(remotePod), nil, s.EnvironmentConfig)},
+			})
+		}
+		s.Router.POST("/config", s.OnConfig)
+
+		var req sshconfig.Request
+		req.Username = tc.username
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config", bytes.NewReader(body)))
+		if w.Code != tc.expectedCode {
+			t.Errorf("Expected status %d for %s, got %d: %s", tc.expectedCode, tc.username, w.Code, w.Body)
+			continue
+		}
+		if tc.expectedCode != http.StatusOK {
+			continue
+		}
+		var res sshconfig.ResponseBody
+		if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+			t.Fatalf("Expected the config response, got %v", err)
+		}
+		if res.Config.Backend != tc.expectedBackend {
+			t.Errorf("Expected backend %s, got %s", tc.expectedBackend, res.Config.Backend)
+		}
+		if forwarding := res.Config.Security.Forwarding.ForwardingMode; tc.expectedForwarding != "" &&
+			forwarding != tc.expectedForwarding {
+			t.Errorf("Expected forwarding %s for %s, got %s", tc.expectedForwarding, tc.username, forwarding)
+		}
+		if tc.expectedBackend == config.SSHBackendSSHProxy {
+			if res.Config.SSHProxy.Server != tc.expectedTarget {
+				t.Errorf("Expected sshproxy server %s, got %s", tc.expectedTarget, res.Config.SSHProxy.Server)
+			}
+			continue
+		}
+		pod := res.Config.Kubernetes.Pod
+		if len(pod.Spec.Containers) != 1 || pod.Spec.Containers[0].Image != tc.expectedTarget {
+			t.Errorf("Expected a container of image %s, got %+v", tc.expectedTarget, pod.Spec.Containers)
+		}
+		if pod.Metadata.Labels[consts.PodLabelSessionOwner] != "alice" {
+			t.Errorf("Expected the session owner label alice, got %v", pod.Metadata.Labels)
+		}
+		if pod.Mode != tc.expectedSessions {
+			t.Errorf("Expected mode %s, got %s", tc.expectedSessions, pod.Mode)
+		}
+	}
+}
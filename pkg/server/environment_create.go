@@ -5,21 +5,21 @@
 package server
 
 import (
-	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgtype"
 	"github.com/sirupsen/logrus"
-	v1 "k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
 	"github.com/tensorchord/envd-server/pkg/consts"
-	"github.com/tensorchord/envd-server/pkg/image"
+	"github.com/tensorchord/envd-server/pkg/metrics"
 	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/runtime"
 	"github.com/tensorchord/envd-server/pkg/util/imageutil"
 )
 
@@ -31,39 +31,61 @@ import (
 // @Param       identity_token path     string                         true "identity token" example("a332139d39b89a241400013700e665a3")
 // @Param       request        body     types.EnvironmentCreateRequest true "query params"
 // @Success     201            {object} types.EnvironmentCreateResponse
+// @Failure     429            {object} types.ErrorResponse
 // @Router      /users/{identity_token}/environments [post]
 func (s *Server) environmentCreate(c *gin.Context) {
 	it := c.GetString("identity_token")
 
+	// failure is the reason of the failure, it is empty on success.
+	var failure string
+	defer func(start time.Time) {
+		observeOperation(metrics.EnvironmentCreateDuration,
+			metrics.EnvironmentCreateFailures, start, failure)
+	}(time.Now())
+
 	var req types.EnvironmentCreateRequest
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(500, err)
+		failure = "invalid_request"
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	auditRecordFrom(c).Target = req.Name
+	if _, ok := s.ssh.Security.Policies[req.Spec.SSHPolicy]; req.Spec.SSHPolicy != "" && !ok {
+		failure = "invalid_request"
+		respondWithError(c, errdefs.InvalidParameter(
+			errors.Newf("unknown ssh policy %s", req.Spec.SSHPolicy)))
+		return
+	}
+	if (req.Spec.Cluster != "" || len(req.Spec.ClusterSelector) != 0) && len(s.clusters) == 0 {
+		failure = "invalid_request"
+		respondWithError(c, errdefs.InvalidParameter(
+			errors.New("the server does not place the environments in clusters")))
 		return
 	}
 
-	meta, err := image.FetchMetadata(c.Request.Context(), req.Spec.Image)
+	meta, err := s.fetchImageMetadata(c, req.Spec.Image)
 	if err != nil {
-		c.JSON(500, err)
+		failure = "image_metadata"
+		respondWithError(c, errors.Wrapf(err,
+			"failed to fetch the metadata of image %s", req.Spec.Image))
 		return
 	}
 	var pglabel pgtype.JSONB
 	err = pglabel.Set(meta.Labels)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		failure = "image_labels"
+		respondWithError(c, errors.Wrap(err, "failed to encode the image labels"))
 		return
 	}
-	_, err = s.Queries.CreateImageInfo(context.Background(),
+	_, err = s.Storage.CreateImageInfo(c,
 		query.CreateImageInfoParams{OwnerToken: it,
 			Name: meta.Name, Digest: meta.Digest, Created: meta.Created, Size: meta.Size, Labels: pglabel})
 	if err != nil {
-		c.JSON(500, err)
-	}
-	labels := map[string]string{
-		consts.PodLabelUID:             it,
-		consts.PodLabelEnvironmentName: req.Name,
+		failure = "db"
+		respondWithError(c, errors.Wrap(err, "failed to save the image info"))
+		return
 	}
-
-	logrus.WithFields(logrus.Fields{
+	requestLogger(c).WithFields(logrus.Fields{
 		"identity_token": it,
 		"image_labels":   meta.Labels,
 		"environment":    req.Environment,
@@ -72,17 +94,30 @@ func (s *Server) environmentCreate(c *gin.Context) {
 	for k, v := range meta.Labels {
 		annotations[k] = v
 	}
+	// The policy and the host key are not taken from the image labels.
+	delete(annotations, consts.PodAnnotationSSHPolicy)
+	delete(annotations, consts.PodAnnotationHostKey)
+	if key, ok := s.activeHostKey(); ok {
+		annotations[consts.PodAnnotationHostKey] = key.fingerprint
+	}
+	if req.Spec.SSHPolicy != "" {
+		annotations[consts.PodAnnotationSSHPolicy] = req.Spec.SSHPolicy
+	}
 
 	portLabel, ok := meta.Labels[consts.ImageLabelPorts]
 	if !ok {
-		logrus.Info("failed to get port label")
-		c.JSON(500, errors.Wrap(err, "failed to get the port"))
+		requestLogger(c).Info("failed to get port label")
+		failure = "image_labels"
+		respondWithError(c, errdefs.InvalidParameter(errors.Newf(
+			"image %s does not have the label %s", req.Spec.Image, consts.ImageLabelPorts)))
 		return
 	}
 	ports, err := imageutil.PortsFromLabel(portLabel)
 	if err != nil {
-		logrus.Infof("failed to get ports from: %s", portLabel)
-		c.JSON(500, errors.Wrap(err, "failed to parse ports from label"))
+		requestLogger(c).Infof("failed to get ports from: %s", portLabel)
+		failure = "image_labels"
+		respondWithError(c, errdefs.InvalidParameter(
+			errors.Wrap(err, "failed to parse ports from label")))
 		return
 	}
 
@@ -91,143 +126,45 @@ func (s *Server) environmentCreate(c *gin.Context) {
 	if ok {
 		repoInfo, err = imageutil.RepoInfoFromLabel(repoLabel)
 		if err != nil {
-			logrus.Info("failed to parse repo from label")
-			c.JSON(500, errors.Wrap(err, "failed to get repo information from label"))
+			requestLogger(c).Info("failed to parse repo from label")
+			failure = "image_labels"
+			respondWithError(c, errdefs.InvalidParameter(
+				errors.Wrap(err, "failed to get repo information from label")))
 			return
 		}
 	}
 
 	projectName, ok := meta.Labels[consts.ImageLabelContainerName]
 	if !ok {
-		logrus.Info("failed to get the project name from label")
-		c.JSON(500, errors.New("failed to get the project name(working dir) from label"))
+		requestLogger(c).Info("failed to get the project name from label")
+		failure = "image_labels"
+		respondWithError(c, errdefs.InvalidParameter(errors.Newf(
+			"image %s does not have the label %s", req.Spec.Image, consts.ImageLabelContainerName)))
 		return
 	}
-	logrus.WithFields(logrus.Fields{
+	requestLogger(c).WithFields(logrus.Fields{
 		"port":    ports,
 		"repo":    repoInfo,
 		"project": projectName,
 	}).Debug("creating environment")
-	hostKeyPath := "/var/envd/hostkey"
-	authKeyPath := "/var/envd/authkey"
-	var defaultPermMode int32 = 0666
-	expectedPod := v1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:        req.Name,
-			Namespace:   "default",
-			Labels:      labels,
-			Annotations: annotations,
-		},
-		Spec: v1.PodSpec{
-			Containers: []v1.Container{
-				{
-					Name:  "envd",
-					Image: req.Spec.Image,
-					Ports: []v1.ContainerPort{
-						{
-							Name:          "ssh",
-							ContainerPort: 2222,
-						},
-					},
-					Env: []v1.EnvVar{
-						{
-							Name:  "ENVD_HOST_KEY",
-							Value: hostKeyPath,
-						},
-						{
-							Name:  "ENVD_AUTHORIZED_KEYS_PATH",
-							Value: authKeyPath,
-						},
-						{
-							Name:  "ENVD_WORKDIR",
-							Value: fmt.Sprintf("/home/envd/%s", projectName),
-						},
-					},
-					VolumeMounts: []v1.VolumeMount{
-						{
-							Name:      "secret",
-							ReadOnly:  true,
-							MountPath: hostKeyPath,
-							SubPath:   "hostkey",
-						},
-						{
-							Name:      "secret",
-							ReadOnly:  true,
-							MountPath: authKeyPath,
-							SubPath:   "publickey",
-						},
-					},
-				},
-			},
-			Volumes: []v1.Volume{
-				{
-					Name: "secret",
-					VolumeSource: v1.VolumeSource{
-						Secret: &v1.SecretVolumeSource{
-							SecretName:  "envd-server",
-							DefaultMode: &defaultPermMode,
-						},
-					},
-				},
-			},
-		},
-	}
-	if repoInfo != nil && len(repoInfo.URL) > 0 {
-		logrus.Debugf("clone code from %s", repoInfo.URL)
-		expectedPod.Spec.InitContainers = append(expectedPod.Spec.InitContainers, v1.Container{
-			Name:  "git-cloner",
-			Image: "alpine/git",
-			Args:  []string{"clone", "--", repoInfo.URL, "/code"},
-			VolumeMounts: []v1.VolumeMount{
-				{
-					Name:      "code-dir",
-					MountPath: "/code",
-				},
-			},
-		})
-		expectedPod.Spec.Containers[0].VolumeMounts = append(expectedPod.Spec.Containers[0].VolumeMounts, v1.VolumeMount{
-			Name:      "code-dir",
-			MountPath: fmt.Sprintf("/home/envd/%s", projectName),
-		})
-		expectedPod.Spec.Volumes = append(expectedPod.Spec.Volumes, v1.Volume{
-			Name: "code-dir",
-			VolumeSource: v1.VolumeSource{
-				EmptyDir: &v1.EmptyDirVolumeSource{},
-				// HostPath: &v1.HostPathVolumeSource{
-				// 	Path: fmt.Sprintf("/var/envd/code/%s", req.Name),
-				// },
-			},
-		})
-	}
+	opt := runtime.CreateOptions{
+		Owner: it,
+		Name:  req.Name,
+		// The local images are run by the names recorded in them.
+		Image:       meta.Name,
+		Annotations: annotations,
+		WorkingDir:  fmt.Sprintf("/home/envd/%s", projectName),
 
-	_, err = s.Client.CoreV1().Pods(
-		"default").Create(c, &expectedPod, metav1.CreateOptions{})
-	if err != nil {
-		logrus.Infof("failed to create pod: %v", err)
-		c.JSON(500, err)
-		return
+		Cluster:         req.Spec.Cluster,
+		ClusterSelector: req.Spec.ClusterSelector,
 	}
-
-	expectedService := v1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      req.Name,
-			Namespace: "default",
-			Labels:    labels,
-		},
-		Spec: v1.ServiceSpec{
-			Selector: labels,
-			Type:     v1.ServiceTypeClusterIP,
-			Ports: []v1.ServicePort{
-				{
-					Name: "ssh",
-					Port: 2222,
-				},
-			},
-		},
-	}
-	_, err = s.Client.CoreV1().Services("default").Create(c, &expectedService, metav1.CreateOptions{})
-	if err != nil {
-		c.JSON(500, err)
+	if repoInfo != nil {
+		opt.RepoURL = repoInfo.URL
+	}
+	if err := s.runtime.Create(c, opt); err != nil {
+		requestLogger(c).Infof("failed to create the environment: %v", err)
+		failure = "runtime"
+		respondWithError(c, errors.Wrap(err, "failed to create the environment"))
 		return
 	}
 
@@ -235,5 +172,11 @@ func (s *Server) environmentCreate(c *gin.Context) {
 		Created: req.Environment,
 	}
 	resp.Created.Spec.Ports = ports
-	c.JSON(201, resp)
+	if len(s.clusters) != 0 {
+		// The cluster is chosen by the runtime.
+		if e, err := s.runtime.Get(c, it, req.Name); err == nil {
+			resp.Created.Spec.Cluster = e.Spec.Cluster
+		}
+	}
+	c.JSON(http.StatusCreated, resp)
 }
@@ -0,0 +1,89 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+)
+
+// maxExecOutput is the bytes of the stdout and the stderr each kept in the
+// response, the rest of the output is dropped.
+const maxExecOutput = 1 << 20
+
+// limitedBuffer keeps the first limit bytes written to it. The writes never
+// fail, so that the command is not stopped by the dropped output.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if n := b.limit - b.buf.Len(); len(p) > n {
+		b.buf.Write(p[:n])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// @Summary     Run the command in the environment.
+// @Description Run the command without the stdin and the TTY, and return the output after it exits. The first 1 MiB of the stdout and the stderr each is returned.
+// @Tags        environment
+// @Accept      json
+// @Produce     json
+// @Param       identity_token path     string                       true "identity token" example("a332139d39b89a241400013700e665a3")
+// @Param       name           path     string                       true "environment name" example("pytorch-example")
+// @Param       request        body     types.EnvironmentExecRequest true "command"
+// @Success     200            {object} types.EnvironmentExecResponse
+// @Failure     401            {object} types.ErrorResponse
+// @Failure     404            {object} types.ErrorResponse
+// @Failure     501            {object} types.ErrorResponse
+// @Router      /users/{identity_token}/environments/{name}/exec [post]
+func (s *Server) environmentExec(c *gin.Context) {
+	it := c.GetString("identity_token")
+
+	var req types.EnvironmentExecRequest
+	if err := c.BindUri(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if err := c.BindJSON(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if len(req.Cmd) == 0 {
+		respondWithError(c, errdefs.InvalidParameter(errors.New("cmd is required")))
+		return
+	}
+
+	stdout := &limitedBuffer{limit: maxExecOutput}
+	stderr := &limitedBuffer{limit: maxExecOutput}
+	code, err := s.runtime.Exec(c, it, req.Name, runtime.ExecOptions{
+		Cmd:    req.Cmd,
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	if err != nil {
+		respondWithError(c, errors.Wrapf(err, "failed to exec in environment %s", req.Name))
+		return
+	}
+	c.JSON(http.StatusOK, types.EnvironmentExecResponse{
+		ExitCode: code,
+		Stdout:   stdout.buf.String(),
+		Stderr:   stderr.buf.String(),
+
+		StdoutTruncated: stdout.truncated,
+		StderrTruncated: stderr.truncated,
+	})
+}
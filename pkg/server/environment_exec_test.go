@@ -0,0 +1,88 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+)
+
+// outputRuntime writes the output of the sizes in the chunks of 4 KiB.
+type outputRuntime struct {
+	runtime.Runtime
+	stdout, stderr int
+}
+
+func (r outputRuntime) Exec(_ context.Context, _, _ string, opt runtime.ExecOptions) (int, error) {
+	write := func(w io.Writer, size int) error {
+		chunk := []byte(strings.Repeat("x", 4096))
+		for size > 0 {
+			n := len(chunk)
+			if size < n {
+				n = size
+			}
+			if _, err := w.Write(chunk[:n]); err != nil {
+				return err
+			}
+			size -= n
+		}
+		return nil
+	}
+	if err := write(opt.Stdout, r.stdout); err != nil {
+		return -1, err
+	}
+	return 3, write(opt.Stderr, r.stderr)
+}
+
+func TestEnvironmentExecOutput(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tcs := []struct {
+		stdout, stderr  int
+		expectedStdout  int
+		expectedStderr  int
+		stdoutTruncated bool
+		stderrTruncated bool
+	}{
+		{stdout: 10, stderr: 0, expectedStdout: 10},
+		{stdout: maxExecOutput, stderr: 10, expectedStdout: maxExecOutput, expectedStderr: 10},
+		{stdout: maxExecOutput + 1, stderr: 3 * maxExecOutput, expectedStdout: maxExecOutput,
+			expectedStderr: maxExecOutput, stdoutTruncated: true, stderrTruncated: true},
+	}
+	for i, tc := range tcs {
+		s := &Server{Router: gin.New()}
+		s.runtime = outputRuntime{stdout: tc.stdout, stderr: tc.stderr}
+		s.Router.POST("/environments/:name/exec", s.environmentExec)
+
+		body, _ := json.Marshal(types.EnvironmentExecRequest{Cmd: []string{"cat"}})
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost,
+			"/environments/mnist/exec", bytes.NewReader(body)))
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status 200 in case %d, got %d: %s", i, w.Code, w.Body)
+			continue
+		}
+		var resp types.EnvironmentExecResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if resp.ExitCode != 3 || len(resp.Stdout) != tc.expectedStdout || len(resp.Stderr) != tc.expectedStderr ||
+			resp.StdoutTruncated != tc.stdoutTruncated || resp.StderrTruncated != tc.stderrTruncated {
+			t.Errorf("Expected %d/%d bytes truncated %t/%t in case %d, got %d/%d bytes truncated %t/%t",
+				tc.expectedStdout, tc.expectedStderr, tc.stdoutTruncated, tc.stderrTruncated, i,
+				len(resp.Stdout), len(resp.Stderr), resp.StdoutTruncated, resp.StderrTruncated)
+		}
+	}
+}
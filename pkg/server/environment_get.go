@@ -7,13 +7,11 @@ package server
 import (
 	"net/http"
 
+	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
-	"github.com/sirupsen/logrus"
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/tensorchord/envd-server/api/types"
-	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/errdefs"
 )
 
 // @Summary     Get the environment.
@@ -24,42 +22,21 @@ import (
 // @Param       identity_token path     string true "identity token" example("a332139d39b89a241400013700e665a3")
 // @Param       name           path     string true "environment name" example("pytorch-example")
 // @Success     200            {object} types.EnvironmentGetResponse
+// @Failure     401            {object} types.ErrorResponse
+// @Failure     404            {object} types.ErrorResponse
 // @Router      /users/{identity_token}/environments/{name} [get]
 func (s *Server) environmentGet(c *gin.Context) {
 	it := c.GetString("identity_token")
 
 	var req types.EnvironmentGetRequest
 	if err := c.BindUri(&req); err != nil {
-		c.JSON(500, err)
+		respondWithError(c, errdefs.InvalidParameter(err))
 		return
 	}
 
-	pod, err := s.Client.CoreV1().Pods("default").Get(c, req.Name, metav1.GetOptions{})
+	e, err := s.runtime.Get(c, it, req.Name)
 	if err != nil {
-		if k8serrors.IsNotFound(err) {
-			c.JSON(http.StatusNotFound, types.EnvironmentGetResponse{})
-			return
-		}
-		c.JSON(500, err)
-		return
-	}
-	if pod.Labels[consts.PodLabelUID] != it {
-		logrus.WithFields(logrus.Fields{
-			"identity_token_in_pod":     pod.Labels[consts.PodLabelUID],
-			"identity_token_in_request": it,
-		}).Debug("mismatch identity_token")
-		respondWithError(c, http.StatusUnauthorized, "unauthorized")
-		return
-	}
-
-	if pod == nil {
-		c.JSON(http.StatusNotFound, types.EnvironmentGetResponse{})
-		return
-	}
-
-	e, err := generateEnvironmentFromPod(*pod)
-	if err != nil {
-		c.JSON(500, err)
+		respondWithError(c, errors.Wrapf(err, "failed to get environment %s", req.Name))
 		return
 	}
 
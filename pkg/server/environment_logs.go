@@ -0,0 +1,73 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+)
+
+// @Summary     Get the logs of the environment.
+// @Description Get the logs of the environment, which are streamed if follow is set.
+// @Tags        environment
+// @Produce     plain
+// @Param       identity_token path     string true  "identity token" example("a332139d39b89a241400013700e665a3")
+// @Param       name           path     string true  "environment name" example("pytorch-example")
+// @Param       follow         query    bool   false "stream the logs until the environment stops"
+// @Param       tail           query    int    false "number of the lines from the end"
+// @Success     200            {string} string
+// @Failure     401            {object} types.ErrorResponse
+// @Failure     404            {object} types.ErrorResponse
+// @Router      /users/{identity_token}/environments/{name}/logs [get]
+func (s *Server) environmentLogs(c *gin.Context) {
+	it := c.GetString("identity_token")
+
+	var req types.EnvironmentLogsRequest
+	if err := c.BindUri(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if err := c.BindQuery(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+
+	logs, err := s.runtime.Logs(c, it, req.Name, runtime.LogOptions{
+		Follow:    req.Follow,
+		TailLines: req.Tail,
+	})
+	if err != nil {
+		respondWithError(c, errors.Wrapf(err, "failed to get the logs of environment %s", req.Name))
+		return
+	}
+	defer logs.Close()
+
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+	// Flush the logs as they come, the followed logs never end.
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := logs.Read(buf)
+		if n > 0 {
+			if _, err := c.Writer.Write(buf[:n]); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				requestLogger(c).WithError(err).Debug("the logs stream is closed")
+			}
+			return
+		}
+	}
+}
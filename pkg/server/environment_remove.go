@@ -6,14 +6,15 @@ package server
 
 import (
 	"net/http"
+	"time"
 
+	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
-	k8serrors "k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/tensorchord/envd-server/api/types"
-	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/metrics"
 )
 
 // @Summary     Remove the environment.
@@ -28,64 +29,32 @@ import (
 func (s *Server) environmentRemove(c *gin.Context) {
 	it := c.GetString("identity_token")
 
+	// failure is the reason of the failure, it is empty on success.
+	var failure string
+	defer func(start time.Time) {
+		observeOperation(metrics.EnvironmentRemoveDuration,
+			metrics.EnvironmentRemoveFailures, start, failure)
+	}(time.Now())
+
 	var req types.EnvironmentRemoveRequest
 	if err := c.BindUri(&req); err != nil {
-		c.JSON(500, err)
+		failure = "invalid_request"
+		respondWithError(c, errdefs.InvalidParameter(err))
 		return
 	}
 
-	logger := logrus.WithFields(logrus.Fields{
-		"name":           req.Name,
-		"identity_token": it,
-	})
-	pod, err := s.Client.CoreV1().Pods("default").Get(c, req.Name, metav1.GetOptions{})
-	if !k8serrors.IsNotFound(err) {
-		if err != nil {
-			logger.Error(err)
-			c.JSON(500, err)
-			return
-		}
-		if pod.Labels[consts.PodLabelUID] != it {
-			logger.WithFields(logrus.Fields{
-				"identity_token_in_pod":     pod.Labels[consts.PodLabelUID],
-				"identity_token_in_request": it,
-			}).Debug("mismatch identity_token")
-			respondWithError(c, http.StatusUnauthorized, "unauthorized")
-			return
+	if err := s.runtime.Remove(c, it, req.Name); err != nil {
+		failure = "runtime"
+		if errdefs.IsUnauthorized(err) {
+			failure = "unauthorized"
 		}
-		err = s.Client.CoreV1().Pods(
-			"default").Delete(c, req.Name, metav1.DeleteOptions{})
-		if err != nil && !k8serrors.IsNotFound(err) {
-			logger.Error(err)
-			c.JSON(500, err)
-			return
-		}
-		logger.Debugf("pod %s is deleted", req.Name)
-	}
-
-	service, err := s.Client.CoreV1().Services("default").Get(c, req.Name, metav1.GetOptions{})
-	if !k8serrors.IsNotFound(err) {
-		if err != nil {
-			logger.Error(err)
-			c.JSON(500, err)
-			return
-		}
-		if service.Labels[consts.PodLabelUID] != it {
-			logger.WithFields(logrus.Fields{
-				"identity_token_in_pod":     pod.Labels[consts.PodLabelUID],
-				"identity_token_in_request": it,
-			}).Debug("mismatch identity_token")
-			respondWithError(c, http.StatusUnauthorized, "unauthorized")
-			return
-		}
-		err = s.Client.CoreV1().Services("default").Delete(c, req.Name, metav1.DeleteOptions{})
-		if err != nil && !k8serrors.IsNotFound(err) {
-			logger.Error(err)
-			c.JSON(500, err)
-			return
-		}
-		logger.Debugf("service %s is deleted", req.Name)
+		respondWithError(c, errors.Wrapf(err, "failed to remove environment %s", req.Name))
+		return
 	}
+	requestLogger(c).WithFields(logrus.Fields{
+		"name":           req.Name,
+		"identity_token": it,
+	}).Debug("environment is removed")
 
-	c.JSON(200, types.EnvironmentRemoveResponse{})
+	c.JSON(http.StatusOK, types.EnvironmentRemoveResponse{})
 }
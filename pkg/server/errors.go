@@ -0,0 +1,108 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgconn"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/storage"
+)
+
+// respondWithError translates the error to the status code and
+// aborts the request with the error body.
+func respondWithError(c *gin.Context, err error) {
+	err, details := translateError(err)
+	code := errdefs.ToStatusCode(err)
+	if code >= http.StatusInternalServerError {
+		requestLogger(c).WithError(err).WithField("path", c.FullPath()).
+			Error("request failed")
+	}
+	// Keep the error for the logger and the audit middleware.
+	_ = c.Error(err)
+	c.AbortWithStatusJSON(code, types.ErrorResponse{
+		Code:      errdefs.Code(err),
+		Message:   err.Error(),
+		Details:   details,
+		RequestID: c.GetString(requestIDKey),
+	})
+}
+
+// translateError converts the Kubernetes, database and context errors to
+// the errdefs classes, unless the error already has one. Errors without a
+// known class are system errors.
+func translateError(err error) (error, map[string]string) {
+	var details map[string]string
+	var statusErr k8serrors.APIStatus
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.As(err, &statusErr):
+		status := statusErr.Status()
+		details = map[string]string{"reason": string(status.Reason)}
+		if status.Details != nil {
+			details["kind"] = status.Details.Kind
+			details["name"] = status.Details.Name
+		}
+	case errors.As(err, &pgErr):
+		details = map[string]string{"sqlstate": pgErr.Code}
+	}
+
+	switch {
+	case errdefs.Code(err) != errdefs.CodeUnknown:
+		return err, details
+	case statusErr != nil:
+		return translateKubernetesError(err), details
+	case pgErr != nil:
+		return translatePostgresError(pgErr.Code, err), details
+	case errors.Is(err, storage.ErrNotFound):
+		return errdefs.NotFound(err), details
+	case errors.Is(err, context.Canceled):
+		return errdefs.Cancelled(err), details
+	case errors.Is(err, context.DeadlineExceeded):
+		return errdefs.Deadline(err), details
+	default:
+		return errdefs.System(err), details
+	}
+}
+
+func translatePostgresError(sqlState string, err error) error {
+	switch {
+	case sqlState == "23505": // unique_violation
+		return errdefs.Conflict(err)
+	case strings.HasPrefix(sqlState, "22"): // data_exception
+		return errdefs.InvalidParameter(err)
+	default:
+		return errdefs.System(err)
+	}
+}
+
+func translateKubernetesError(err error) error {
+	switch {
+	case k8serrors.IsNotFound(err):
+		return errdefs.NotFound(err)
+	case k8serrors.IsAlreadyExists(err), k8serrors.IsConflict(err):
+		return errdefs.Conflict(err)
+	case k8serrors.IsInvalid(err), k8serrors.IsBadRequest(err):
+		return errdefs.InvalidParameter(err)
+	case k8serrors.IsUnauthorized(err):
+		return errdefs.Unauthorized(err)
+	case k8serrors.IsForbidden(err):
+		return errdefs.Forbidden(err)
+	case k8serrors.IsTimeout(err), k8serrors.IsServerTimeout(err):
+		return errdefs.Deadline(err)
+	case k8serrors.IsTooManyRequests(err), k8serrors.IsServiceUnavailable(err):
+		return errdefs.Unavailable(err)
+	default:
+		return errdefs.System(err)
+	}
+}
@@ -0,0 +1,74 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgconn"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/storage"
+)
+
+func TestTranslateError(t *testing.T) {
+	tcs := []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{
+			err:    errdefs.InvalidParameter(errors.New("bad input")),
+			code:   errdefs.CodeInvalidParameter,
+			status: http.StatusBadRequest,
+		},
+		{
+			err: errors.Wrap(k8serrors.NewNotFound(
+				schema.GroupResource{Resource: "pods"}, "test"), "failed to get"),
+			code:   errdefs.CodeNotFound,
+			status: http.StatusNotFound,
+		},
+		{
+			err: k8serrors.NewAlreadyExists(
+				schema.GroupResource{Resource: "pods"}, "test"),
+			code:   errdefs.CodeConflict,
+			status: http.StatusConflict,
+		},
+		{
+			err:    &pgconn.PgError{Code: "23505"},
+			code:   errdefs.CodeConflict,
+			status: http.StatusConflict,
+		},
+		{
+			err:    errors.Wrap(storage.ErrNotFound, "failed to get the user"),
+			code:   errdefs.CodeNotFound,
+			status: http.StatusNotFound,
+		},
+		{
+			err:    context.DeadlineExceeded,
+			code:   errdefs.CodeDeadline,
+			status: http.StatusInternalServerError,
+		},
+		{
+			err:    errors.New("unknown"),
+			code:   errdefs.CodeSystem,
+			status: http.StatusInternalServerError,
+		},
+	}
+	for _, tc := range tcs {
+		err, _ := translateError(tc.err)
+		if code := errdefs.Code(err); code != tc.code {
+			t.Errorf("Expected code %s for %v, got %s", tc.code, tc.err, code)
+		}
+		if status := errdefs.ToStatusCode(err); status != tc.status {
+			t.Errorf("Expected status %d for %v, got %d", tc.status, tc.err, status)
+		}
+	}
+}
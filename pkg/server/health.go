@@ -0,0 +1,150 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/config"
+)
+
+const healthCheckTimeout = 5 * time.Second
+
+// healthCheck returns nil if the component is healthy.
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+// handleHealthz is the liveness probe. It only reports that the process
+// serves the requests, the dependencies are checked in handleReadyz so
+// that an outage of them does not restart the replicas.
+func (s *Server) handleHealthz(c *gin.Context) {
+	s.respondHealth(c, nil)
+}
+
+// handleReadyz is the readiness probe. It checks the dependencies that
+// the server cannot serve any request without, and waits for the
+// informer cache of the kubernetes runtime to be synced.
+func (s *Server) handleReadyz(c *gin.Context) {
+	checks := []healthCheck{
+		{name: s.databaseName(), check: s.checkDatabase},
+		{name: s.runtimeName(), check: s.checkRuntime},
+	}
+	if s.runtimeName() == config.RuntimeBackendKubernetes {
+		checks = append(checks, healthCheck{name: "informer", check: s.checkInformer})
+	}
+	s.respondHealth(c, append(checks,
+		healthCheck{name: "hostkey", check: s.checkHostKey},
+		healthCheck{name: "leaderelection", check: s.checkLeaderElection}))
+}
+
+func (s *Server) respondHealth(c *gin.Context, checks []healthCheck) {
+	ctx, cancel := context.WithTimeout(c, healthCheckTimeout)
+	defer cancel()
+
+	resp := types.HealthResponse{
+		Status: types.HealthStatusOK,
+		Checks: make([]types.HealthCheck, 0, len(checks)),
+	}
+	for _, hc := range checks {
+		res := types.HealthCheck{
+			Name:   hc.name,
+			Status: types.HealthStatusOK,
+		}
+		if err := hc.check(ctx); err != nil {
+			logrus.WithError(err).WithField("check", hc.name).
+				Debug("health check failed")
+			res.Status = types.HealthStatusFailed
+			res.Message = err.Error()
+			resp.Status = types.HealthStatusFailed
+		}
+		resp.Checks = append(resp.Checks, res)
+	}
+	if s.elector != nil {
+		resp.Leader = &types.LeaderStatus{
+			Enabled:  s.elector.Enabled(),
+			IsLeader: s.elector.IsLeader(),
+			Identity: s.elector.Identity(),
+			Leader:   s.elector.Leader(),
+		}
+	}
+
+	code := http.StatusOK
+	if resp.Status != types.HealthStatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, resp)
+}
+
+// databaseName is the name of the database check, postgres by default.
+func (s *Server) databaseName() string {
+	if s.databaseBackend == "" {
+		return config.DatabaseBackendPostgres
+	}
+	return s.databaseBackend
+}
+
+func (s *Server) checkDatabase(ctx context.Context) error {
+	if s.Storage == nil {
+		return errors.New("database is not configured")
+	}
+	return s.Storage.Ping(ctx)
+}
+
+// runtimeName is the name of the runtime check, kubernetes by default.
+func (s *Server) runtimeName() string {
+	if s.runtimeBackend == "" {
+		return config.RuntimeBackendKubernetes
+	}
+	return s.runtimeBackend
+}
+
+func (s *Server) checkRuntime(ctx context.Context) error {
+	if s.runtime == nil {
+		return errors.New("runtime is not configured")
+	}
+	return s.runtime.Ping(ctx)
+}
+
+func (s *Server) checkInformer(ctx context.Context) error {
+	if s.podInformer == nil {
+		return errors.New("informer is not configured")
+	}
+	if !s.podInformer.HasSynced() {
+		return errors.New("pod informer is not synced")
+	}
+	return nil
+}
+
+func (s *Server) checkHostKey(ctx context.Context) error {
+	if len(s.hostKeyFingerprints()) == 0 {
+		return errors.New("host key is not configured")
+	}
+	if s.hostKeyPath == "" {
+		return nil
+	}
+	if _, err := os.Stat(s.hostKeyPath); err != nil {
+		return errors.Wrapf(err, "host key %s is not available", s.hostKeyPath)
+	}
+	return nil
+}
+
+// checkLeaderElection fails if the replica is the leader but cannot renew
+// the lease.
+func (s *Server) checkLeaderElection(ctx context.Context) error {
+	if s.elector == nil {
+		return nil
+	}
+	return errors.Wrap(s.elector.Check(), "failed to renew the leader lease")
+}
@@ -0,0 +1,231 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+const (
+	// secretHostKey is the key in the secret mounted as the host key of
+	// the new environments.
+	secretHostKey = "hostkey"
+	// secretHostKeyPrefix is the prefix of the other accepted keys.
+	secretHostKeyPrefix = "hostkey-"
+)
+
+// hostKey is a host key of the environments accepted by containerssh.
+type hostKey struct {
+	name        string
+	source      string
+	fingerprint string
+	active      bool
+}
+
+// hostKeys returns the accepted keys of all the sources. The same key in
+// several sources is only returned once. The active key is the hostkey in
+// the secret, or the one of the --hostkey file.
+func (s *Server) hostKeys() []hostKey {
+	s.hostKeysMu.RLock()
+	defer s.hostKeysMu.RUnlock()
+	var keys []hostKey
+	seen := map[string]bool{}
+	hasActive := false
+	for _, source := range []string{
+		types.HostKeySourceSecret, types.HostKeySourceFile, types.HostKeySourceDir} {
+		for _, k := range s.hostKeySources[source] {
+			if seen[k.fingerprint] {
+				continue
+			}
+			seen[k.fingerprint] = true
+			k.active = !hasActive && (k.source == types.HostKeySourceSecret && k.name == secretHostKey ||
+				k.source == types.HostKeySourceFile)
+			hasActive = hasActive || k.active
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// hostKeyFingerprints returns the fingerprints accepted by containerssh.
+func (s *Server) hostKeyFingerprints() []string {
+	keys := s.hostKeys()
+	fingerprints := make([]string, 0, len(keys))
+	for _, k := range keys {
+		fingerprints = append(fingerprints, k.fingerprint)
+	}
+	return fingerprints
+}
+
+// activeHostKey returns the host key of the new environments.
+func (s *Server) activeHostKey() (hostKey, bool) {
+	for _, k := range s.hostKeys() {
+		if k.active {
+			return k, true
+		}
+	}
+	return hostKey{}, false
+}
+
+// reloadHostKeys loads the keys of all the sources. The keys of a source
+// are kept as is if it fails to load.
+func (s *Server) reloadHostKeys(ctx context.Context) error {
+	var errs error
+	for source, load := range map[string]func(context.Context) ([]hostKey, error){
+		types.HostKeySourceSecret: s.loadSecretHostKeys,
+		types.HostKeySourceFile:   s.loadFileHostKey,
+		types.HostKeySourceDir:    s.loadDirHostKeys,
+	} {
+		keys, err := load(ctx)
+		if err != nil {
+			errs = errors.CombineErrors(errs, err)
+			continue
+		}
+		s.hostKeysMu.Lock()
+		if s.hostKeySources == nil {
+			s.hostKeySources = map[string][]hostKey{}
+		}
+		s.hostKeySources[source] = keys
+		s.hostKeysMu.Unlock()
+	}
+	return errs
+}
+
+// watchHostKeys reloads the host keys periodically until the context is
+// done, so that the keys added by the other replicas are accepted too.
+func (s *Server) watchHostKeys(ctx context.Context) {
+	if s.hostKeysCfg.ReloadInterval.Duration <= 0 {
+		return
+	}
+	ticker := time.NewTicker(s.hostKeysCfg.ReloadInterval.Duration)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.reloadHostKeys(ctx); err != nil {
+				logrus.WithError(err).Warn("failed to reload the host keys, keep the current ones")
+			}
+		}
+	}
+}
+
+func (s *Server) loadFileHostKey(context.Context) ([]hostKey, error) {
+	if s.hostKeyPath == "" {
+		return nil, nil
+	}
+	pemBytes, err := os.ReadFile(s.hostKeyPath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "reading private key %s failed", s.hostKeyPath)
+	}
+	key, err := parseHostKey(pemBytes)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the host key %s", s.hostKeyPath)
+	}
+	return []hostKey{{
+		name:        filepath.Base(s.hostKeyPath),
+		source:      types.HostKeySourceFile,
+		fingerprint: ssh.FingerprintSHA256(key),
+	}}, nil
+}
+
+// loadDirHostKeys loads the files in the dir. The hidden files are skipped,
+// e.g. the ..data links of the mounted configmaps and secrets.
+func (s *Server) loadDirHostKeys(context.Context) ([]hostKey, error) {
+	if s.hostKeysCfg.Dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.hostKeysCfg.Dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the host keys dir %s", s.hostKeysCfg.Dir)
+	}
+	var keys []hostKey
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(s.hostKeysCfg.Dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the host key %s", path)
+		}
+		key, err := parseHostKey(data)
+		if err != nil {
+			logrus.WithError(err).WithField("path", path).Warn("skip the invalid host key")
+			continue
+		}
+		keys = append(keys, hostKey{
+			name:        entry.Name(),
+			source:      types.HostKeySourceDir,
+			fingerprint: ssh.FingerprintSHA256(key),
+		})
+	}
+	return keys, nil
+}
+
+func (s *Server) loadSecretHostKeys(ctx context.Context) ([]hostKey, error) {
+	if !s.hostKeysCfg.Secret || s.Client == nil {
+		return nil, nil
+	}
+	cfg := s.EnvironmentConfig()
+	secret, err := s.Client.CoreV1().Secrets(cfg.Namespace).Get(ctx, cfg.SecretName, metav1.GetOptions{})
+	if err != nil {
+		if k8serrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get the secret %s", cfg.SecretName)
+	}
+	names := make([]string, 0, len(secret.Data))
+	for name := range secret.Data {
+		if isHostKeyName(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var keys []hostKey
+	for _, name := range names {
+		key, err := parseHostKey(secret.Data[name])
+		if err != nil {
+			logrus.WithError(err).WithField("name", name).Warn("skip the invalid host key in the secret")
+			continue
+		}
+		keys = append(keys, hostKey{
+			name:        name,
+			source:      types.HostKeySourceSecret,
+			fingerprint: ssh.FingerprintSHA256(key),
+		})
+	}
+	return keys, nil
+}
+
+// parseHostKey returns the public key of the private key, or the public
+// key in the authorized_keys format.
+func parseHostKey(data []byte) (ssh.PublicKey, error) {
+	if signer, err := ssh.ParsePrivateKey(data); err == nil {
+		return signer.PublicKey(), nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+	if err != nil {
+		return nil, errors.New("neither a private key nor a public key")
+	}
+	return key, nil
+}
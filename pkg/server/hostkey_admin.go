@@ -0,0 +1,383 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	v1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+)
+
+const defaultHostKeyRollLimit = 10
+
+// The host keys are rotated with the admin API in the steps:
+//
+//  1. POST /hostkeys adds a new key to the secret. It is accepted by all
+//     the replicas after the reload interval.
+//  2. POST /hostkeys/{name}/activate mounts it in the new environments.
+//  3. POST /hostkeys/roll recreates the environments of the other keys,
+//     until there are no environments left.
+//  4. DELETE /hostkeys/{name} retires the old key.
+
+// hostKeyList lists the accepted host keys with the number of the
+// environments of them. It is served on the admin router.
+func (s *Server) hostKeyList(c *gin.Context) {
+	envs, err := s.runtime.List(c, "")
+	if err != nil {
+		respondWithError(c, errors.Wrap(err, "failed to list the environments"))
+		return
+	}
+	counts := map[string]int{}
+	for _, e := range envs {
+		counts[e.Labels[consts.PodAnnotationHostKey]]++
+	}
+
+	res := types.HostKeyListResponse{Items: []types.HostKey{}}
+	for _, k := range s.hostKeys() {
+		res.Items = append(res.Items, hostKeyResponse(k, counts[k.fingerprint]))
+		delete(counts, k.fingerprint)
+	}
+	// The environments of the unknown or removed keys.
+	for _, n := range counts {
+		res.UnknownEnvironments += n
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// hostKeyCreate generates a host key in the secret, which is accepted but
+// not used by the new environments until it is activated.
+func (s *Server) hostKeyCreate(c *gin.Context) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		respondWithError(c, errors.Wrap(err, "failed to generate the host key"))
+		return
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		respondWithError(c, errors.Wrap(err, "failed to encode the host key"))
+		return
+	}
+	var name string
+	err = s.updateHostKeySecret(c, func(data map[string][]byte) error {
+		name = newSecretHostKeyName(data)
+		data[name] = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		respondWithError(c, errors.Wrap(err, "failed to encode the host public key"))
+		return
+	}
+	auditRecordFrom(c).Target = name
+	requestLogger(c).WithField("name", name).Info("host key created")
+	c.JSON(http.StatusCreated, types.HostKeyCreateResponse{HostKey: types.HostKey{
+		Name:        name,
+		Fingerprint: ssh.FingerprintSHA256(pub),
+		Source:      types.HostKeySourceSecret,
+	}})
+}
+
+// hostKeyActivate mounts the key in the new environments. The previous
+// active key is kept as another key in the secret.
+func (s *Server) hostKeyActivate(c *gin.Context) {
+	var req types.HostKeyActivateRequest
+	if err := c.BindUri(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if !strings.HasPrefix(req.Name, secretHostKeyPrefix) {
+		respondWithError(c, errdefs.InvalidParameter(errors.Newf(
+			"host key %s is not an inactive key in the secret", req.Name)))
+		return
+	}
+	err := s.updateHostKeySecret(c, func(data map[string][]byte) error {
+		key, ok := data[req.Name]
+		if !ok {
+			return errdefs.NotFound(errors.Newf("cannot find the host key %s", req.Name))
+		}
+		delete(data, req.Name)
+		if active, ok := data[secretHostKey]; ok {
+			data[newSecretHostKeyName(data)] = active
+		}
+		data[secretHostKey] = key
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	requestLogger(c).WithField("name", req.Name).Info("host key activated")
+	c.Status(http.StatusNoContent)
+}
+
+// hostKeyRemove retires the inactive key in the secret. It is denied if
+// there are environments of the key unless it is forced.
+func (s *Server) hostKeyRemove(c *gin.Context) {
+	var req types.HostKeyRemoveRequest
+	if err := c.BindUri(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if err := c.BindQuery(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if !strings.HasPrefix(req.Name, secretHostKeyPrefix) {
+		respondWithError(c, errdefs.InvalidParameter(errors.Newf(
+			"host key %s is not an inactive key in the secret", req.Name)))
+		return
+	}
+	var envs []types.Environment
+	if !req.Force {
+		var err error
+		if envs, err = s.runtime.List(c, ""); err != nil {
+			respondWithError(c, errors.Wrap(err, "failed to list the environments"))
+			return
+		}
+	}
+	err := s.updateHostKeySecret(c, func(data map[string][]byte) error {
+		key, ok := data[req.Name]
+		if !ok {
+			return errdefs.NotFound(errors.Newf("cannot find the host key %s", req.Name))
+		}
+		if !req.Force {
+			// The fingerprint is of the key in the secret, the loaded keys
+			// of the replica may not be reloaded yet.
+			pub, err := parseHostKey(key)
+			if err != nil {
+				return errdefs.Conflict(errors.Wrapf(err,
+					"cannot check the environments of the host key %s, remove it with force", req.Name))
+			}
+			fingerprint := ssh.FingerprintSHA256(pub)
+			for _, e := range envs {
+				if e.Labels[consts.PodAnnotationHostKey] == fingerprint {
+					return errdefs.Conflict(errors.Newf(
+						"host key %s is used by environment %s, roll the environments first", req.Name, e.Name))
+				}
+			}
+		}
+		delete(data, req.Name)
+		return nil
+	})
+	if err != nil {
+		respondWithError(c, err)
+		return
+	}
+	requestLogger(c).WithField("name", req.Name).Info("host key removed")
+	c.Status(http.StatusNoContent)
+}
+
+// hostKeyRoll recreates the environments which are not created with the
+// active key, so that they mount the active key.
+func (s *Server) hostKeyRoll(c *gin.Context) {
+	var req types.HostKeyRollRequest
+	if err := c.BindQuery(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if req.Limit <= 0 {
+		req.Limit = defaultHostKeyRollLimit
+	}
+	recreator, ok := s.runtime.(runtime.Recreator)
+	if !ok {
+		respondWithError(c, errdefs.NotImplemented(errors.Newf(
+			"the %s runtime cannot recreate the environments", s.runtimeName())))
+		return
+	}
+	active, ok := s.activeHostKey()
+	if !ok {
+		respondWithError(c, errdefs.InvalidParameter(errors.New("there is no active host key")))
+		return
+	}
+	auditRecordFrom(c).Target = active.name
+	// The environments in the other clusters would mount the previous
+	// key if the secret there is not synced, e.g. by a failed update.
+	if err := s.syncHostKeySecret(c); err != nil {
+		respondWithError(c, err)
+		return
+	}
+	envs, err := s.runtime.List(c, "")
+	if err != nil {
+		respondWithError(c, errors.Wrap(err, "failed to list the environments"))
+		return
+	}
+
+	var stale []string
+	for _, e := range envs {
+		if e.Labels[consts.PodAnnotationHostKey] != active.fingerprint {
+			stale = append(stale, e.Name)
+		}
+	}
+	res := types.HostKeyRollResponse{Rolled: []string{}}
+	for i, name := range stale {
+		if i >= req.Limit {
+			res.Remaining = len(stale) - i
+			break
+		}
+		err := recreator.Recreate(c, name, map[string]string{
+			consts.PodAnnotationHostKey: active.fingerprint,
+		})
+		if err != nil {
+			requestLogger(c).WithError(err).WithField("environment", name).
+				Warn("failed to roll the environment")
+			if res.Failed == nil {
+				res.Failed = map[string]string{}
+			}
+			res.Failed[name] = err.Error()
+			res.Remaining++
+			continue
+		}
+		requestLogger(c).WithField("environment", name).Info("environment rolled to the active host key")
+		res.Rolled = append(res.Rolled, name)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// updateHostKeySecret updates the host keys in the secret and reloads
+// them.
+func (s *Server) updateHostKeySecret(ctx context.Context, update func(map[string][]byte) error) error {
+	if !s.hostKeysCfg.Secret || s.Client == nil {
+		return errdefs.Unavailable(errors.New("the host keys in the secret are disabled"))
+	}
+	cfg := s.EnvironmentConfig()
+	secrets := s.Client.CoreV1().Secrets(cfg.Namespace)
+	secret, err := secrets.Get(ctx, cfg.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the secret %s", cfg.SecretName)
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	if err := update(secret.Data); err != nil {
+		return err
+	}
+	// The update fails with a conflict if the secret is changed since it
+	// is read, e.g. by another replica.
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return errors.Wrapf(err, "failed to update the secret %s", cfg.SecretName)
+	}
+	if err := s.reloadHostKeys(ctx); err != nil {
+		logrus.WithError(err).Warn("failed to reload the host keys")
+	}
+	if err := s.syncHostKeySecret(ctx); err != nil {
+		return errors.Wrap(err, "the host keys are updated, but not synced to all the clusters, "+
+			"POST /hostkeys/roll syncs them again")
+	}
+	return nil
+}
+
+// syncHostKeySecret copies the host keys in the secret of the client to
+// the secrets of the clusters, and removes the other host keys there. The
+// other data in the secrets is kept.
+func (s *Server) syncHostKeySecret(ctx context.Context) error {
+	if len(s.clusterClients) == 0 {
+		return nil
+	}
+	if !s.hostKeysCfg.Secret || s.Client == nil {
+		return errdefs.Unavailable(errors.New("the host keys in the secret are disabled"))
+	}
+	cfg := s.EnvironmentConfig()
+	source, err := s.Client.CoreV1().Secrets(cfg.Namespace).Get(ctx, cfg.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the secret %s", cfg.SecretName)
+	}
+	names := make([]string, 0, len(s.clusterClients))
+	for name := range s.clusterClients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var errs error
+	for _, name := range names {
+		if err := syncHostKeys(ctx, s.clusterClients[name], cfg.Namespace, cfg.SecretName,
+			source.Data); err != nil {
+			errs = errors.CombineErrors(errs, errors.Wrapf(err, "cluster %s", name))
+		}
+	}
+	return errs
+}
+
+func syncHostKeys(ctx context.Context, client kubernetes.Interface, namespace, name string,
+	data map[string][]byte) error {
+	secrets := client.CoreV1().Secrets(namespace)
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	notFound := k8serrors.IsNotFound(err)
+	if notFound {
+		secret = &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to get the secret %s", name)
+	}
+	if secret.Data == nil {
+		secret.Data = map[string][]byte{}
+	}
+	for k := range secret.Data {
+		if isHostKeyName(k) {
+			delete(secret.Data, k)
+		}
+	}
+	for k, v := range data {
+		if isHostKeyName(k) {
+			secret.Data[k] = v
+		}
+	}
+	if notFound {
+		_, err = secrets.Create(ctx, secret, metav1.CreateOptions{})
+	} else {
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	return errors.Wrapf(err, "failed to update the secret %s", name)
+}
+
+// isHostKeyName returns true if the key in the secret is a host key.
+func isHostKeyName(name string) bool {
+	return name == secretHostKey || strings.HasPrefix(name, secretHostKeyPrefix)
+}
+
+// newSecretHostKeyName returns an unused name for a key in the secret.
+func newSecretHostKeyName(data map[string][]byte) string {
+	ts := time.Now().Unix()
+	for {
+		name := secretHostKeyPrefix + strconv.FormatInt(ts, 10)
+		if _, ok := data[name]; !ok {
+			return name
+		}
+		ts++
+	}
+}
+
+func hostKeyResponse(k hostKey, environments int) types.HostKey {
+	return types.HostKey{
+		Name:         k.name,
+		Fingerprint:  k.fingerprint,
+		Source:       k.source,
+		Active:       k.active,
+		Environments: environments,
+	}
+}
@@ -0,0 +1,278 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/ssh"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/consts"
+	k8sruntime "github.com/tensorchord/envd-server/pkg/runtime/kubernetes"
+	"github.com/tensorchord/envd-server/pkg/runtime/multicluster"
+)
+
+func generateHostKey(t *testing.T) ([]byte, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := ssh.NewPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), ssh.FingerprintSHA256(pub)
+}
+
+func TestHostKeyRotation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	env := config.Default().Environment
+	oldKey, oldFingerprint := generateHostKey(t)
+	client := fake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: env.SecretName, Namespace: env.Namespace},
+			Data:       map[string][]byte{secretHostKey: oldKey, "publickey": []byte("ssh-rsa AAAA")},
+		},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "mnist",
+			Namespace:   env.Namespace,
+			Labels:      map[string]string{consts.PodLabelUID: "alice"},
+			Annotations: map[string]string{consts.PodAnnotationHostKey: oldFingerprint},
+		}},
+	)
+	s := &Server{AdminRouter: gin.New(), Client: client, hostKeysCfg: config.HostKeysConfig{Secret: true}}
+	s.SetEnvironmentConfig(env)
+	s.runtime = k8sruntime.New(client, nil, s.EnvironmentConfig)
+	s.AdminRouter.GET("/hostkeys", s.hostKeyList)
+	s.AdminRouter.POST("/hostkeys", s.hostKeyCreate)
+	s.AdminRouter.POST("/hostkeys/roll", s.hostKeyRoll)
+	s.AdminRouter.POST("/hostkeys/:name/activate", s.hostKeyActivate)
+	s.AdminRouter.DELETE("/hostkeys/:name", s.hostKeyRemove)
+	if err := s.reloadHostKeys(context.Background()); err != nil {
+		t.Fatalf("Expected the host keys loaded, got %v", err)
+	}
+	if active, ok := s.activeHostKey(); !ok || active.fingerprint != oldFingerprint {
+		t.Fatalf("Expected the active host key %s, got %+v", oldFingerprint, active)
+	}
+
+	do := func(method, path string, expectedCode int, res interface{}) {
+		w := httptest.NewRecorder()
+		s.AdminRouter.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != expectedCode {
+			t.Fatalf("Expected status %d of %s %s, got %d: %s", expectedCode, method, path, w.Code, w.Body)
+		}
+		if res != nil {
+			if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+				t.Fatalf("Expected the response of %s %s, got %v", method, path, err)
+			}
+		}
+	}
+
+	var created types.HostKeyCreateResponse
+	do(http.MethodPost, "/hostkeys", http.StatusCreated, &created)
+	if len(s.hostKeyFingerprints()) != 2 {
+		t.Errorf("Expected both the host keys accepted, got %v", s.hostKeyFingerprints())
+	}
+	do(http.MethodPost, "/hostkeys/"+secretHostKey+"/activate", http.StatusBadRequest, nil)
+	do(http.MethodPost, "/hostkeys/"+created.Name+"/activate", http.StatusNoContent, nil)
+	if active, ok := s.activeHostKey(); !ok || active.fingerprint != created.Fingerprint {
+		t.Errorf("Expected the active host key %s, got %+v", created.Fingerprint, active)
+	}
+
+	var list types.HostKeyListResponse
+	do(http.MethodGet, "/hostkeys", http.StatusOK, &list)
+	var retired string
+	for _, k := range list.Items {
+		if k.Fingerprint == oldFingerprint {
+			retired = k.Name
+			if k.Active || k.Environments != 1 {
+				t.Errorf("Expected the inactive old key with 1 environment, got %+v", k)
+			}
+		}
+	}
+	if len(list.Items) != 2 || retired == "" {
+		t.Fatalf("Expected the old and the new keys, got %+v", list.Items)
+	}
+
+	// The environment still uses the old key.
+	do(http.MethodDelete, "/hostkeys/"+retired, http.StatusConflict, nil)
+	var rolled types.HostKeyRollResponse
+	do(http.MethodPost, "/hostkeys/roll", http.StatusOK, &rolled)
+	if len(rolled.Rolled) != 1 || rolled.Remaining != 0 {
+		t.Errorf("Expected the environment rolled, got %+v", rolled)
+	}
+	pod, err := client.CoreV1().Pods(env.Namespace).Get(context.Background(), "mnist", metav1.GetOptions{})
+	if err != nil || pod.Annotations[consts.PodAnnotationHostKey] != created.Fingerprint {
+		t.Errorf("Expected the environment with the new key, got %v, %v", pod, err)
+	}
+	do(http.MethodDelete, "/hostkeys/"+retired, http.StatusNoContent, nil)
+	if fingerprints := s.hostKeyFingerprints(); len(fingerprints) != 1 || fingerprints[0] != created.Fingerprint {
+		t.Errorf("Expected only the new key accepted, got %v", fingerprints)
+	}
+}
+
+func TestHostKeyRemoveNotReloaded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	env := config.Default().Environment
+	activeKey, _ := generateHostKey(t)
+	usedKey, usedFingerprint := generateHostKey(t)
+	client := fake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: env.SecretName, Namespace: env.Namespace},
+			Data:       map[string][]byte{secretHostKey: activeKey},
+		},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "mnist",
+			Namespace:   env.Namespace,
+			Labels:      map[string]string{consts.PodLabelUID: "alice"},
+			Annotations: map[string]string{consts.PodAnnotationHostKey: usedFingerprint},
+		}},
+	)
+	s := &Server{AdminRouter: gin.New(), Client: client, hostKeysCfg: config.HostKeysConfig{Secret: true}}
+	s.SetEnvironmentConfig(env)
+	s.runtime = k8sruntime.New(client, nil, s.EnvironmentConfig)
+	s.AdminRouter.DELETE("/hostkeys/:name", s.hostKeyRemove)
+	if err := s.reloadHostKeys(context.Background()); err != nil {
+		t.Fatalf("Expected the host keys loaded, got %v", err)
+	}
+
+	// The keys are added by another replica, and not reloaded by this one.
+	secrets := client.CoreV1().Secrets(env.Namespace)
+	secret, err := secrets.Get(context.Background(), env.SecretName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Data[secretHostKeyPrefix+"1"] = usedKey
+	secret.Data[secretHostKeyPrefix+"2"] = []byte("invalid")
+	if _, err := secrets.Update(context.Background(), secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		path         string
+		expectedCode int
+	}{
+		{path: "/hostkeys/" + secretHostKeyPrefix + "1", expectedCode: http.StatusConflict},
+		{path: "/hostkeys/" + secretHostKeyPrefix + "2", expectedCode: http.StatusConflict},
+		{path: "/hostkeys/" + secretHostKeyPrefix + "2?force=true", expectedCode: http.StatusNoContent},
+	}
+	for _, tc := range tcs {
+		w := httptest.NewRecorder()
+		s.AdminRouter.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, tc.path, nil))
+		if w.Code != tc.expectedCode {
+			t.Errorf("Expected status %d of DELETE %s, got %d: %s", tc.expectedCode, tc.path, w.Code, w.Body)
+		}
+	}
+}
+
+func TestHostKeySecretSync(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	env := config.Default().Environment
+	oldKey, oldFingerprint := generateHostKey(t)
+	staleKey, _ := generateHostKey(t)
+	client := fake.NewSimpleClientset(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: env.SecretName, Namespace: env.Namespace},
+		Data:       map[string][]byte{secretHostKey: oldKey},
+	})
+	// The secret of cluster a has the other data and a stale key, and
+	// cluster b has no secret.
+	clusterA := fake.NewSimpleClientset(
+		&v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: env.SecretName, Namespace: env.Namespace},
+			Data: map[string][]byte{secretHostKey: oldKey, secretHostKeyPrefix + "1": staleKey,
+				"publickey": []byte("ssh-rsa AAAA")},
+		},
+		&v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "mnist",
+			Namespace:   env.Namespace,
+			Labels:      map[string]string{consts.PodLabelUID: "alice"},
+			Annotations: map[string]string{consts.PodAnnotationHostKey: oldFingerprint},
+		}},
+	)
+	clusterB := fake.NewSimpleClientset()
+	s := &Server{AdminRouter: gin.New(), Client: client, hostKeysCfg: config.HostKeysConfig{Secret: true},
+		clusterClients: map[string]kubernetes.Interface{"a": clusterA, "b": clusterB}}
+	s.SetEnvironmentConfig(env)
+	s.runtime = multicluster.New([]multicluster.Cluster{
+		{Name: "a", Runtime: k8sruntime.New(clusterA, nil, s.EnvironmentConfig)},
+		{Name: "b", Runtime: k8sruntime.New(clusterB, nil, s.EnvironmentConfig)},
+	})
+	s.AdminRouter.POST("/hostkeys", s.hostKeyCreate)
+	s.AdminRouter.POST("/hostkeys/roll", s.hostKeyRoll)
+	s.AdminRouter.POST("/hostkeys/:name/activate", s.hostKeyActivate)
+	if err := s.reloadHostKeys(context.Background()); err != nil {
+		t.Fatalf("Expected the host keys loaded, got %v", err)
+	}
+
+	do := func(method, path string, expectedCode int, res interface{}) {
+		w := httptest.NewRecorder()
+		s.AdminRouter.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		if w.Code != expectedCode {
+			t.Fatalf("Expected status %d of %s %s, got %d: %s", expectedCode, method, path, w.Code, w.Body)
+		}
+		if res != nil {
+			if err := json.Unmarshal(w.Body.Bytes(), res); err != nil {
+				t.Fatalf("Expected the response of %s %s, got %v", method, path, err)
+			}
+		}
+	}
+	var created types.HostKeyCreateResponse
+	do(http.MethodPost, "/hostkeys", http.StatusCreated, &created)
+	do(http.MethodPost, "/hostkeys/"+created.Name+"/activate", http.StatusNoContent, nil)
+
+	source, err := client.CoreV1().Secrets(env.Namespace).Get(context.Background(), env.SecretName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, cli := range s.clusterClients {
+		secret, err := cli.CoreV1().Secrets(env.Namespace).Get(context.Background(), env.SecretName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Expected the secret in cluster %s, got %v", name, err)
+		}
+		for k, v := range source.Data {
+			if !bytes.Equal(secret.Data[k], v) {
+				t.Errorf("Expected the host key %s synced to cluster %s", k, name)
+			}
+		}
+		if _, ok := secret.Data[secretHostKeyPrefix+"1"]; ok {
+			t.Errorf("Expected the stale host key removed in cluster %s", name)
+		}
+	}
+	secret, _ := clusterA.CoreV1().Secrets(env.Namespace).Get(context.Background(), env.SecretName, metav1.GetOptions{})
+	if string(secret.Data["publickey"]) != "ssh-rsa AAAA" {
+		t.Errorf("Expected the other data of the secret kept, got %v", secret.Data)
+	}
+
+	var rolled types.HostKeyRollResponse
+	do(http.MethodPost, "/hostkeys/roll", http.StatusOK, &rolled)
+	if len(rolled.Rolled) != 1 {
+		t.Errorf("Expected the environment rolled, got %+v", rolled)
+	}
+	pod, err := clusterA.CoreV1().Pods(env.Namespace).Get(context.Background(), "mnist", metav1.GetOptions{})
+	if err != nil || pod.Annotations[consts.PodAnnotationHostKey] != created.Fingerprint {
+		t.Errorf("Expected the environment with the new key, got %v, %v", pod, err)
+	}
+}
@@ -5,17 +5,16 @@
 package server
 
 import (
-	"context"
 	"net/http"
 	"net/url"
 
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v4"
-	"github.com/sirupsen/logrus"
 
 	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
 	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/storage"
 	"github.com/tensorchord/envd-server/pkg/util"
 )
 
@@ -27,37 +26,37 @@ import (
 // @Param       identity_token path     string true "identity token" example("a332139d39b89a241400013700e665a3")
 // @Param       name           path     string true "image name" example("pytorch-example")
 // @Success     200            {object} types.ImageGetResponse
+// @Failure     404            {object} types.ErrorResponse
 // @Router      /users/{identity_token}/images/{name} [get]
 func (s *Server) imageGet(c *gin.Context) {
 	it := c.GetString("identity_token")
 
 	var req types.ImageGetRequest
 	if err := c.BindUri(&req); err != nil {
-		c.JSON(http.StatusInternalServerError, err)
+		respondWithError(c, errdefs.InvalidParameter(err))
 		return
 	}
 
 	name, err := url.PathUnescape(req.Name)
 	if err != nil {
-		logrus.Infof("cannot unescape the requested image name: %s", req.Name)
-		c.JSON(http.StatusBadRequest, err)
+		requestLogger(c).Infof("cannot unescape the requested image name: %s", req.Name)
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
 	}
 
-	imageInfo, err := s.Queries.GetImageInfo(context.Background(), query.GetImageInfoParams{OwnerToken: it, Name: name})
+	imageInfo, err := s.Storage.GetImageInfo(c, query.GetImageInfoParams{OwnerToken: it, Name: name})
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			c.JSON(http.StatusBadRequest, errors.Newf("cannot find the image(%s)", req.Name))
-			return
-		} else {
-			logrus.Warnf("cannot get the image info: %+v", err)
-			c.JSON(http.StatusInternalServerError, "internal error")
+		if errors.Is(err, storage.ErrNotFound) {
+			respondWithError(c, errdefs.NotFound(
+				errors.Newf("cannot find the image(%s)", req.Name)))
 			return
 		}
+		respondWithError(c, errors.Wrap(err, "cannot get the image info"))
+		return
 	}
 	meta, err := util.DaoToImageMeta(imageInfo)
 	if err != nil {
-		logrus.Warnf("cannot get label info: %+v", err)
-		c.JSON(http.StatusInternalServerError, "internal error")
+		respondWithError(c, errors.Wrap(err, "cannot get label info"))
 		return
 	}
 	c.JSON(http.StatusOK, types.ImageGetResponse{
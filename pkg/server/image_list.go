@@ -5,15 +5,13 @@
 package server
 
 import (
-	"context"
 	"net/http"
 
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v4"
-	"github.com/sirupsen/logrus"
 
 	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/storage"
 	"github.com/tensorchord/envd-server/pkg/util"
 )
 
@@ -30,23 +28,20 @@ func (s *Server) imageList(c *gin.Context) {
 	it := c.GetString("identity_token")
 
 	resp := types.ImageListResponse{}
-	images, err := s.Queries.ListImageByOwner(context.Background(), it)
+	images, err := s.Storage.ListImageByOwner(c, it)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
+		if errors.Is(err, storage.ErrNotFound) {
 			// No image found
 			c.JSON(http.StatusOK, resp)
 			return
-		} else {
-			logrus.Warnf("cannot get the image info: %+v", err)
-			c.JSON(http.StatusInternalServerError, "internal error")
-			return
 		}
+		respondWithError(c, errors.Wrap(err, "cannot get the image info"))
+		return
 	}
 	for _, info := range images {
 		item, err := util.DaoToImageMeta(info)
 		if err != nil {
-			logrus.Warnf("cannot convert dao to image info: %+v", err)
-			c.JSON(http.StatusInternalServerError, "internal error")
+			respondWithError(c, errors.Wrap(err, "cannot convert dao to image info"))
 			return
 		}
 		resp.Items = append(resp.Items, *item)
@@ -0,0 +1,41 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"net"
+	"os"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd-server/pkg/config"
+)
+
+// listen creates the listener of the address, see config.ParseAddr for
+// the format.
+func listen(addr string) (net.Listener, error) {
+	network, address, err := config.ParseAddr(addr)
+	if err != nil {
+		return nil, err
+	}
+	if network == "unix" {
+		// Remove the socket left by the last run, which was not
+		// stopped gracefully.
+		if err := os.Remove(address); err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to remove the socket %s", address)
+		}
+	}
+	ln, err := net.Listen(network, address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to listen on %s", addr)
+	}
+	if network == "unix" {
+		if err := os.Chmod(address, 0660); err != nil {
+			ln.Close()
+			return nil, errors.Wrapf(err, "failed to chmod the socket %s", address)
+		}
+	}
+	return ln, nil
+}
@@ -0,0 +1,83 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/labels"
+	listerv1 "k8s.io/client-go/listers/core/v1"
+
+	"github.com/tensorchord/envd-server/pkg/consts"
+	"github.com/tensorchord/envd-server/pkg/metrics"
+)
+
+// MetricsMiddleware records the count and latency of the requests
+// by the matched route instead of the raw path, to keep the cardinality low.
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestsTotal.WithLabelValues(
+			c.Request.Method, route, strconv.Itoa(c.Writer.Status())).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).
+			Observe(time.Since(start).Seconds())
+	}
+}
+
+// observeOperation records the duration of the operation, and counts the
+// failure reason if it is not empty.
+func observeOperation(duration *prometheus.HistogramVec,
+	failures *prometheus.CounterVec, start time.Time, reason string) {
+	result := metrics.ResultSuccess
+	if reason != "" {
+		result = metrics.ResultFailure
+		failures.WithLabelValues(reason).Inc()
+	}
+	duration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+var environmentsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName("envd_server", "environment", "count"),
+	"Number of environments by phase and owner.",
+	[]string{"phase", "owner"}, nil,
+)
+
+// environmentCollector counts the environment pods in the informer cache
+// on every scrape.
+type environmentCollector struct {
+	lister listerv1.PodLister
+}
+
+func (e environmentCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- environmentsDesc
+}
+
+func (e environmentCollector) Collect(ch chan<- prometheus.Metric) {
+	pods, err := e.lister.List(labels.Everything())
+	if err != nil {
+		logrus.WithError(err).Warn("failed to list pods for metrics")
+		return
+	}
+
+	type key struct{ phase, owner string }
+	counts := map[key]int{}
+	for _, p := range pods {
+		counts[key{string(p.Status.Phase), p.Labels[consts.PodLabelUID]}]++
+	}
+	for k, v := range counts {
+		ch <- prometheus.MustNewConstMetric(environmentsDesc,
+			prometheus.GaugeValue, float64(v), k.phase, k.owner)
+	}
+}
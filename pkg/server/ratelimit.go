@@ -0,0 +1,209 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/metrics"
+)
+
+// Route classes of the rate limits.
+const (
+	rateLimitClassAuth    = "auth"
+	rateLimitClassWebhook = "webhook"
+	rateLimitClassRead    = "read"
+	rateLimitClassWrite   = "write"
+)
+
+// limiterIdleTimeout is the time after which the bucket of an inactive
+// key is dropped. The bucket is full again by then in practice.
+const limiterIdleTimeout = 10 * time.Minute
+
+// rateLimiter keeps the token buckets of each route class.
+type rateLimiter struct {
+	classes map[string]*limiterStore
+	creates *concurrencyLimiter
+}
+
+func newRateLimiter(cfg config.RateLimitConfig) *rateLimiter {
+	return &rateLimiter{
+		classes: map[string]*limiterStore{
+			rateLimitClassAuth:    newLimiterStore(cfg.Auth),
+			rateLimitClassWebhook: newLimiterStore(cfg.Webhook),
+			rateLimitClassRead:    newLimiterStore(cfg.Read),
+			rateLimitClassWrite:   newLimiterStore(cfg.Write),
+		},
+		creates: newConcurrencyLimiter(cfg.MaxConcurrentCreates),
+	}
+}
+
+// limiterStore is the token buckets of a route class, keyed by the user
+// or the client IP. It is nil if the limit is disabled.
+type limiterStore struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	limiters  map[string]*limiterEntry
+	lastSweep time.Time
+}
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newLimiterStore(l config.RateLimit) *limiterStore {
+	if l.RPS <= 0 {
+		return nil
+	}
+	return &limiterStore{
+		limit:    rate.Limit(l.RPS),
+		burst:    l.Burst,
+		limiters: make(map[string]*limiterEntry),
+	}
+}
+
+// reserve takes a token from the bucket of the key. It returns the time to
+// wait for the next token if the bucket is empty, or 0 if it is allowed.
+func (s *limiterStore) reserve(key string, now time.Time) time.Duration {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) > limiterIdleTimeout {
+		for k, e := range s.limiters {
+			if now.Sub(e.lastSeen) > limiterIdleTimeout {
+				delete(s.limiters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	e, ok := s.limiters[key]
+	if !ok {
+		e = &limiterEntry{limiter: rate.NewLimiter(s.limit, s.burst)}
+		s.limiters[key] = e
+	}
+	e.lastSeen = now
+
+	r := e.limiter.ReserveN(now, 1)
+	delay := r.DelayFrom(now)
+	if delay > 0 {
+		// Do not take the token if the request is rejected.
+		r.CancelAt(now)
+	}
+	return delay
+}
+
+// concurrencyLimiter limits the in-flight requests of each user.
+type concurrencyLimiter struct {
+	max int
+
+	mu       sync.Mutex
+	inflight map[string]int
+}
+
+func newConcurrencyLimiter(max int) *concurrencyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &concurrencyLimiter{max: max, inflight: make(map[string]int)}
+}
+
+func (l *concurrencyLimiter) acquire(key string) bool {
+	if l == nil {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[key] >= l.max {
+		return false
+	}
+	l.inflight[key]++
+	return true
+}
+
+func (l *concurrencyLimiter) release(key string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[key]--; l.inflight[key] <= 0 {
+		delete(l.inflight, key)
+	}
+}
+
+// RateLimitMiddleware limits the requests of the route class by the client
+// IP. It is used on the routes without the identity token.
+func (s *Server) RateLimitMiddleware(class string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.rateLimit(c, class, c.ClientIP())
+	}
+}
+
+// UserRateLimitMiddleware limits the requests of each user, the GET
+// requests and the others are limited separately. It must be used after
+// the auth middleware.
+func (s *Server) UserRateLimitMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		class := rateLimitClassWrite
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			class = rateLimitClassRead
+		}
+		s.rateLimit(c, class, c.GetString("identity_token"))
+	}
+}
+
+func (s *Server) rateLimit(c *gin.Context, class, key string) {
+	if s.limiter == nil {
+		c.Next()
+		return
+	}
+	delay := s.limiter.classes[class].reserve(key, time.Now())
+	if delay == 0 {
+		c.Next()
+		return
+	}
+	metrics.HTTPRateLimitedTotal.WithLabelValues(class).Inc()
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+	respondWithError(c, errdefs.ResourceExhausted(errors.Newf(
+		"rate limit of %s requests exceeded, retry after %s", class, delay.Round(time.Millisecond))))
+}
+
+// CreateConcurrencyMiddleware limits the in-flight environment creations
+// of each user, since each of them fetches the image metadata from the
+// registry. It must be used after the auth middleware.
+func (s *Server) CreateConcurrencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if s.limiter == nil {
+			c.Next()
+			return
+		}
+		key := c.GetString("identity_token")
+		if !s.limiter.creates.acquire(key) {
+			metrics.HTTPRateLimitedTotal.WithLabelValues("create").Inc()
+			respondWithError(c, errdefs.ResourceExhausted(errors.Newf(
+				"too many concurrent environment creations, at most %d are allowed",
+				s.limiter.creates.max)))
+			return
+		}
+		defer s.limiter.creates.release(key)
+		c.Next()
+	}
+}
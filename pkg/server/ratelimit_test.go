@@ -0,0 +1,204 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+)
+
+func TestLimiterStore(t *testing.T) {
+	now := time.Now()
+	tcs := []struct {
+		limit         config.RateLimit
+		key           string
+		at            time.Time
+		expectedDelay bool
+	}{
+		{
+			limit:         config.RateLimit{},
+			key:           "alice",
+			at:            now,
+			expectedDelay: false,
+		},
+		{
+			limit:         config.RateLimit{RPS: 1, Burst: 2},
+			key:           "alice",
+			at:            now,
+			expectedDelay: false,
+		},
+		{
+			limit:         config.RateLimit{RPS: 1, Burst: 2},
+			key:           "alice",
+			at:            now,
+			expectedDelay: false,
+		},
+		{
+			limit:         config.RateLimit{RPS: 1, Burst: 2},
+			key:           "alice",
+			at:            now,
+			expectedDelay: true,
+		},
+		{
+			// The rejected request does not take the token.
+			limit:         config.RateLimit{RPS: 1, Burst: 2},
+			key:           "alice",
+			at:            now.Add(time.Second),
+			expectedDelay: false,
+		},
+		{
+			limit:         config.RateLimit{RPS: 1, Burst: 2},
+			key:           "bob",
+			at:            now.Add(time.Second),
+			expectedDelay: false,
+		},
+	}
+	stores := map[config.RateLimit]*limiterStore{}
+	for i, tc := range tcs {
+		store, ok := stores[tc.limit]
+		if !ok {
+			store = newLimiterStore(tc.limit)
+			stores[tc.limit] = store
+		}
+		delay := store.reserve(tc.key, tc.at)
+		if tc.expectedDelay != (delay > 0) {
+			t.Errorf("Expected delay %v in case %d, got %s", tc.expectedDelay, i, delay)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{limiter: newRateLimiter(config.RateLimitConfig{
+		Auth: config.RateLimit{RPS: 0.5, Burst: 1},
+	})}
+	router := gin.New()
+	router.POST("/v1/auth", s.RateLimitMiddleware(rateLimitClassAuth), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tcs := []struct {
+		remoteAddr string
+		code       int
+		retryAfter string
+	}{
+		{remoteAddr: "10.0.0.1:1234", code: http.StatusOK},
+		{remoteAddr: "10.0.0.1:1235", code: http.StatusTooManyRequests, retryAfter: "2"},
+		{remoteAddr: "10.0.0.2:1234", code: http.StatusOK},
+	}
+	for _, tc := range tcs {
+		req := httptest.NewRequest(http.MethodPost, "/v1/auth", nil)
+		req.RemoteAddr = tc.remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("Expected status %d from %s, got %d", tc.code, tc.remoteAddr, w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != tc.retryAfter {
+			t.Errorf("Expected Retry-After %q, got %q", tc.retryAfter, got)
+		}
+		if tc.code != http.StatusTooManyRequests {
+			continue
+		}
+		var resp types.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Expected the error response, got %v", err)
+		}
+		if resp.Code != errdefs.CodeResourceExhausted {
+			t.Errorf("Expected code %s, got %s", errdefs.CodeResourceExhausted, resp.Code)
+		}
+	}
+}
+
+func TestRateLimitMiddlewareForwardedFor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tcs := []struct {
+		trustedProxies []string
+		code           int
+	}{
+		// The forged X-Forwarded-For header does not bypass the limit.
+		{trustedProxies: nil, code: http.StatusTooManyRequests},
+		{trustedProxies: []string{"10.0.0.0/8"}, code: http.StatusOK},
+	}
+	for _, tc := range tcs {
+		s := &Server{limiter: newRateLimiter(config.RateLimitConfig{
+			Auth: config.RateLimit{RPS: 0.5, Burst: 1},
+		})}
+		router := gin.New()
+		if err := router.SetTrustedProxies(tc.trustedProxies); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		router.POST("/v1/auth", s.RateLimitMiddleware(rateLimitClassAuth), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+
+		var code int
+		for _, forwardedFor := range []string{"192.168.0.1", "192.168.0.2"} {
+			req := httptest.NewRequest(http.MethodPost, "/v1/auth", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			code = w.Code
+		}
+		if code != tc.code {
+			t.Errorf("Expected status %d with the trusted proxies %v, got %d",
+				tc.code, tc.trustedProxies, code)
+		}
+	}
+}
+
+func TestCreateConcurrencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{limiter: newRateLimiter(config.RateLimitConfig{
+		MaxConcurrentCreates: 1,
+	})}
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	router := gin.New()
+	router.POST("/v1/users/:identity_token/environments", s.NoAuthMiddleware(),
+		s.CreateConcurrencyMiddleware(), func(c *gin.Context) {
+			if c.Param("identity_token") == "alice" && c.Query("block") != "" {
+				close(started)
+				<-unblock
+			}
+			c.Status(http.StatusCreated)
+		})
+	create := func(user, query string) int {
+		req := httptest.NewRequest(http.MethodPost,
+			"/v1/users/"+user+"/environments"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	done := make(chan int)
+	go func() { done <- create("alice", "?block=1") }()
+	<-started
+	if code := create("alice", ""); code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %d for the concurrent create, got %d",
+			http.StatusTooManyRequests, code)
+	}
+	if code := create("bob", ""); code != http.StatusCreated {
+		t.Errorf("Expected status %d for the other user, got %d", http.StatusCreated, code)
+	}
+	close(unblock)
+	if code := <-done; code != http.StatusCreated {
+		t.Errorf("Expected status %d for the first create, got %d", http.StatusCreated, code)
+	}
+	if code := create("alice", ""); code != http.StatusCreated {
+		t.Errorf("Expected status %d after the first create, got %d", http.StatusCreated, code)
+	}
+}
@@ -0,0 +1,90 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+const (
+	requestIDKey = "request_id"
+	// maxRequestIDLength limits the request ID given by the client, to
+	// avoid flooding the logs and the audit table.
+	maxRequestIDLength = 128
+)
+
+// RequestIDMiddleware reuses the request ID in the header if it is valid,
+// or generates a new one. The ID is returned in the response header.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(types.HeaderRequestID)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(types.HeaderRequestID, id)
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestLogger returns the logger with the request ID of the request.
+func requestLogger(c *gin.Context) *logrus.Entry {
+	return logrus.WithField(requestIDKey, c.GetString(requestIDKey))
+}
+
+// LoggerMiddleware logs the requests with a stable set of fields.
+func LoggerMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		logger := requestLogger(c).WithFields(logrus.Fields{
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"route":      c.FullPath(),
+			"status":     status,
+			"latency_ms": time.Since(start).Milliseconds(),
+			"client_ip":  c.ClientIP(),
+			"user_agent": c.Request.UserAgent(),
+		})
+		if it := c.GetString("identity_token"); it != "" {
+			logger = logger.WithField("identity_token", it)
+		}
+		if err := c.Errors.Last(); err != nil {
+			logger = logger.WithError(err.Err)
+		}
+
+		switch {
+		case status >= 500:
+			logger.Error("request completed")
+		case status >= 400:
+			logger.Warn("request completed")
+		default:
+			logger.Info("request completed")
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tcs := []struct {
+		header   string
+		expected string
+	}{
+		{
+			header:   "6f1c2b1e-3d8b-4f3a-9d5e-0a1b2c3d4e5f",
+			expected: "6f1c2b1e-3d8b-4f3a-9d5e-0a1b2c3d4e5f",
+		},
+		{
+			header:   "",
+			expected: "",
+		},
+		{
+			header:   "invalid id\n",
+			expected: "",
+		},
+		{
+			header:   strings.Repeat("a", maxRequestIDLength+1),
+			expected: "",
+		},
+	}
+	for _, tc := range tcs {
+		router := gin.New()
+		router.Use(RequestIDMiddleware())
+		var got string
+		router.GET("/", func(c *gin.Context) {
+			got = c.GetString(requestIDKey)
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			req.Header.Set(types.HeaderRequestID, tc.header)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if got == "" {
+			t.Errorf("Expected a request ID for %q", tc.header)
+		}
+		if tc.expected != "" && got != tc.expected {
+			t.Errorf("Expected request ID %s, got %s", tc.expected, got)
+		}
+		if tc.expected == "" && got == tc.header {
+			t.Errorf("Expected a generated request ID for %q", tc.header)
+		}
+		if h := w.Header().Get(types.HeaderRequestID); h != got {
+			t.Errorf("Expected response header %s, got %s", got, h)
+		}
+	}
+}
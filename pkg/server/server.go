@@ -6,130 +6,518 @@ package server
 
 import (
 	"context"
-	"fmt"
+	"crypto/tls"
+	"net/http"
 	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/cockroachdb/errors"
 	"github.com/gin-gonic/gin"
-	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 	swaggerfiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
-	ginlogrus "github.com/toorop/gin-logrus"
-	"golang.org/x/crypto/ssh"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/consts"
 	_ "github.com/tensorchord/envd-server/pkg/docs"
-	"github.com/tensorchord/envd-server/pkg/query"
-	"github.com/tensorchord/envd-server/pkg/util"
+	"github.com/tensorchord/envd-server/pkg/image"
+	"github.com/tensorchord/envd-server/pkg/leader"
+	"github.com/tensorchord/envd-server/pkg/runtime"
+	dockerruntime "github.com/tensorchord/envd-server/pkg/runtime/docker"
+	k8sruntime "github.com/tensorchord/envd-server/pkg/runtime/kubernetes"
+	"github.com/tensorchord/envd-server/pkg/storage"
+	"github.com/tensorchord/envd-server/pkg/storage/postgres"
+	"github.com/tensorchord/envd-server/pkg/storage/sqlite"
+	"github.com/tensorchord/envd-server/pkg/tracing"
+	"github.com/tensorchord/envd-server/sshname"
 )
 
 type Server struct {
 	Router      *gin.Engine
 	AdminRouter *gin.Engine
-	Queries     *query.Queries
-	Client      kubernetes.Interface
+	Storage     storage.Storage
+	// Client is nil unless the runtime is kubernetes.
+	Client kubernetes.Interface
 
-	serverFingerPrints []string
+	// runtime runs the environments, and runtimeBackend is the name of
+	// it in the health checks.
+	runtime        runtime.Runtime
+	runtimeBackend string
+	// databaseBackend is the name of the storage in the health checks.
+	databaseBackend string
+	// images fetches the image metadata, it is the registries without
+	// the mirrors if nil.
+	images image.Fetcher
+	// clusters are the clusters of the environments, it is empty if the
+	// environments are in the cluster of the client.
+	clusters []config.ClusterConfig
+	// clusterClients are the clients of the clusters, keyed by the
+	// names. The host keys in the secret of the client are synced to
+	// them, since the environments mount the secret in their cluster.
+	clusterClients map[string]kubernetes.Interface
+
+	hostKeyPath string
+	hostKeysCfg config.HostKeysConfig
+	// hostKeySources are the host keys accepted by containerssh, keyed
+	// by the sources. They are reloaded in the background.
+	hostKeysMu     sync.RWMutex
+	hostKeySources map[string][]hostKey
+	addrs          []string
+	adminAddr      string
+	// adminToken is the bearer token of the admin API, which is open
+	// if it is empty.
+	adminToken string
+	timeouts   config.TimeoutsConfig
+	// environment is the config.EnvironmentConfig, which can be
+	// updated at runtime.
+	environment atomic.Value
+	// tlsConfig is nil if TLS is disabled.
+	tlsConfig      *tls.Config
+	clientSubjects map[string]string
+
+	informerFactory informers.SharedInformerFactory
+	podInformer     cache.SharedIndexInformer
+	// elector runs the background tasks on the leader replica.
+	elector *leader.Elector
+	// limiter is nil if the rate limits are disabled.
+	limiter *rateLimiter
+	// ssh is the backend returned to the containerssh config webhook,
+	// and sshCAData is the CA of the kubernetes backend.
+	ssh       config.SSHConfig
+	sshCAData string
+	// sshNames parses the usernames of the sshproxy backend.
+	sshNames sshname.Parser
+	// certAuthority is nil if the SSH certificates are disabled.
+	certAuthority *certAuthority
 	// imageInfo          []types.ImageInfo
 }
 
 type Opt struct {
-	Debug       bool
-	KubeConfig  string
+	Debug      bool
+	KubeConfig string
+	// Clusters places the environments in several clusters.
+	Clusters    []config.ClusterConfig
 	HostKeyPath string
-	DbUrl       string
+	HostKeys    config.HostKeysConfig
+	Database    config.DatabaseConfig
+	// Addrs are the listen addresses of the API server, see
+	// config.ParseAddr for the format.
+	Addrs []string
+	// AdminAddr is the listen address of the admin router, which
+	// serves the metrics and the audit logs. It is disabled if empty.
+	AdminAddr string
+	// AdminTokenFile has the bearer token of the admin API.
+	AdminTokenFile string
+	// TrustedProxies are the reverse proxies whose X-Forwarded-For
+	// headers are trusted, none if empty.
+	TrustedProxies []string
+	Timeouts       config.TimeoutsConfig
+	// Environment is used to create the environments.
+	Environment config.EnvironmentConfig
+	TLS         config.TLSConfig
+	// LeaderElection is used to run the background tasks on one of
+	// the replicas.
+	LeaderElection config.LeaderElectionConfig
+	RateLimit      config.RateLimitConfig
+	SSH            config.SSHConfig
+	Runtime        config.RuntimeConfig
+	// Registry is used to fetch the image metadata.
+	Registry config.RegistryConfig
 }
 
 func New(opt Opt) (*Server, error) {
-	// use the current context in kubeconfig
-	k8sConfig, err := clientcmd.BuildConfigFromFlags(
-		"", opt.KubeConfig)
+	store, err := newStorage(context.Background(), opt.Database)
 	if err != nil {
 		return nil, err
 	}
-	cli, err := kubernetes.NewForConfig(k8sConfig)
-	if err != nil {
-		return nil, err
-	}
-
-	// Connect to database
-	conn, err := pgx.Connect(context.Background(), opt.DbUrl)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to connect to database: %v\n", err)
-		os.Exit(1)
-	}
-	err = util.ApplySchema(conn)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to apply schema: %v\n", err)
-		os.Exit(1)
-	}
-
-	queries := query.New(conn)
 
 	router := gin.New()
-	router.Use(ginlogrus.Logger(logrus.StandardLogger()))
+	// Use the request context in the handlers, to propagate the trace.
+	router.ContextWithFallback = true
+	router.Use(otelgin.Middleware(tracing.ServiceName))
+	router.Use(RequestIDMiddleware())
+	router.Use(LoggerMiddleware())
 	router.Use(gin.Recovery())
+	router.Use(MetricsMiddleware())
+	router.Use(VersionMiddleware())
 	if gin.Mode() == gin.DebugMode {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 	admin := gin.New()
+	for _, r := range []*gin.Engine{router, admin} {
+		// The client IP is the key of the rate limits, it must not be
+		// forged with the X-Forwarded-For header.
+		if err := r.SetTrustedProxies(opt.TrustedProxies); err != nil {
+			return nil, errors.Wrap(err, "invalid trusted proxies")
+		}
+	}
+
 	s := &Server{
-		Router:             router,
-		AdminRouter:        admin,
-		Client:             cli,
-		Queries:            queries,
-		serverFingerPrints: make([]string, 0),
-	}
-	if opt.HostKeyPath != "" {
-		// read private key file
-		pemBytes, err := os.ReadFile(opt.HostKeyPath)
+		Router:          router,
+		AdminRouter:     admin,
+		Storage:         store,
+		runtimeBackend:  opt.Runtime.Backend,
+		databaseBackend: opt.Database.Backend,
+		clusters:        opt.Clusters,
+		hostKeyPath:     opt.HostKeyPath,
+		hostKeysCfg:     opt.HostKeys,
+		addrs:           opt.Addrs,
+		adminAddr:       opt.AdminAddr,
+		timeouts:        opt.Timeouts,
+		clientSubjects:  opt.TLS.Subjects,
+		limiter:         newRateLimiter(opt.RateLimit),
+		ssh:             opt.SSH,
+		images:          image.New(opt.Registry),
+	}
+	s.SetEnvironmentConfig(opt.Environment)
+	switch opt.Runtime.Backend {
+	case config.RuntimeBackendDocker:
+		if s.runtime, err = dockerruntime.New(opt.Runtime.Docker, s.EnvironmentConfig); err != nil {
+			return nil, err
+		}
+		s.elector = leader.New(nil, leader.Opt{})
+	default:
+		if err := s.initKubernetes(opt); err != nil {
+			return nil, err
+		}
+	}
+	if opt.SSH.SessionIdleTimeout.Duration > 0 {
+		s.RegisterLeaderTask("session-reaper", s.reapIdleSessions)
+	}
+	if s.sshNames, err = sshname.NewParser(
+		opt.SSH.Username.Formats, opt.SSH.Username.DefaultEnvironment); err != nil {
+		return nil, err
+	}
+	if s.certAuthority, err = newCertAuthority(opt.SSH.Certificate); err != nil {
+		return nil, err
+	}
+	if opt.SSH.Backend == config.SSHBackendKubernetes && opt.SSH.Kubernetes.CACertFile != "" {
+		ca, err := os.ReadFile(opt.SSH.Kubernetes.CACertFile)
 		if err != nil {
-			return nil, errors.Wrapf(
-				err, "reading private key %s failed", opt.HostKeyPath)
+			return nil, errors.Wrap(err, "failed to read the CA of the ssh kubernetes backend")
 		}
-		if privateKey, err := ssh.ParsePrivateKey(pemBytes); err != nil {
+		s.sshCAData = string(ca)
+	}
+	if opt.TLS.Enabled() {
+		if s.tlsConfig, err = newTLSConfig(opt.TLS); err != nil {
 			return nil, err
-		} else {
-			logrus.Debugf("load host key from %s", opt.HostKeyPath)
-			fingerPrint := ssh.FingerprintSHA256(privateKey.PublicKey())
-			s.serverFingerPrints = append(s.serverFingerPrints, fingerPrint)
 		}
 	}
+	if opt.AdminTokenFile != "" {
+		token, err := os.ReadFile(opt.AdminTokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the admin token")
+		}
+		if s.adminToken = strings.TrimSpace(string(token)); s.adminToken == "" {
+			return nil, errors.Newf("admin token file %s is empty", opt.AdminTokenFile)
+		}
+	}
+	router.Use(s.AuditMiddleware())
+	admin.Use(s.AuditMiddleware())
+	if err := s.reloadHostKeys(context.Background()); err != nil {
+		return nil, errors.Wrap(err, "failed to load the host keys")
+	}
+	logrus.WithField("fingerprints", s.hostKeyFingerprints()).Debug("host keys loaded")
 	s.BindHandlers(true)
 	return s, nil
 }
 
+// newStorage connects to the database of the backend, postgres by
+// default.
+func newStorage(ctx context.Context, cfg config.DatabaseConfig) (storage.Storage, error) {
+	if cfg.Backend == config.DatabaseBackendSQLite {
+		s, err := sqlite.New(ctx, cfg.Path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to open the sqlite database")
+		}
+		return s, nil
+	}
+	s, err := postgres.New(ctx, cfg.URL)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the postgres database")
+	}
+	return s, nil
+}
+
+// initKubernetes creates the kubernetes client of the runtime, and the
+// informer of the environment pods for the metrics.
+func (s *Server) initKubernetes(opt Opt) error {
+	// use the current context in kubeconfig
+	k8sConfig, err := clientcmd.BuildConfigFromFlags(
+		"", opt.KubeConfig)
+	if err != nil {
+		return err
+	}
+	k8sConfig.Wrap(tracing.WrapTransport)
+	cli, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		return err
+	}
+	s.Client = cli
+	s.runtime = k8sruntime.New(cli, k8sConfig, s.EnvironmentConfig)
+	if len(opt.Clusters) != 0 {
+		if s.runtime, err = s.newClusterRuntime(opt.Clusters); err != nil {
+			return err
+		}
+	}
+
+	// Only watch the pods of the environments.
+	s.informerFactory = informers.NewSharedInformerFactoryWithOptions(
+		cli, 0, informers.WithNamespace(opt.Environment.Namespace),
+		informers.WithTweakListOptions(func(o *metav1.ListOptions) {
+			o.LabelSelector = consts.PodLabelUID
+		}))
+	pods := s.informerFactory.Core().V1().Pods()
+	s.podInformer = pods.Informer()
+	prometheus.MustRegister(environmentCollector{lister: pods.Lister()})
+
+	s.elector = leader.New(cli, leader.Opt{
+		Enabled:       opt.LeaderElection.Enabled,
+		Namespace:     opt.LeaderElection.Namespace,
+		LeaseName:     opt.LeaderElection.LeaseName,
+		LeaseDuration: opt.LeaderElection.LeaseDuration.Duration,
+		RenewDeadline: opt.LeaderElection.RenewDeadline.Duration,
+		RetryPeriod:   opt.LeaderElection.RetryPeriod.Duration,
+	})
+	return nil
+}
+
 func (s *Server) BindHandlers(auth bool) {
 	engine := s.Router
 
 	engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerfiles.Handler))
+	engine.GET("/healthz", s.handleHealthz)
+	engine.GET("/readyz", s.handleReadyz)
+	// The clients get the version without the API version prefix
+	// to negotiate it.
+	engine.GET("/version", s.handleVersion)
+
+	s.AdminRouter.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	admin := s.AdminRouter.Group("/")
+	admin.Use(s.AdminAuthMiddleware())
+	admin.GET("/audit", s.auditList)
+	admin.GET("/sessions", s.sessionListAll)
+	// The session events update the storage, so they are only accepted
+	// from the hook of containerssh with the admin token.
+	admin.POST("/session", s.OnSessionEvent)
+	admin.GET("/hostkeys", s.hostKeyList)
+	admin.POST("/hostkeys", s.hostKeyCreate)
+	admin.POST("/hostkeys/roll", s.hostKeyRoll)
+	admin.POST("/hostkeys/:name/activate", s.hostKeyActivate)
+	admin.DELETE("/hostkeys/:name", s.hostKeyRemove)
 
 	v1 := engine.Group("/v1")
 
 	v1.GET("/", s.handlePing)
-	v1.POST("/auth", s.auth)
-	v1.POST("/config", s.OnConfig)
-	v1.POST("/pubkey", s.OnPubKey)
+	v1.GET("/version", s.handleVersion)
+	v1.POST("/auth", s.RateLimitMiddleware(rateLimitClassAuth), s.auth)
+	v1.POST("/config", s.RateLimitMiddleware(rateLimitClassWebhook), s.OnConfig)
+	v1.POST("/pubkey", s.RateLimitMiddleware(rateLimitClassWebhook), s.OnPubKey)
 
 	authorized := engine.Group("/v1/users")
+	authorized.Use(s.ClientCertMiddleware())
 	if auth {
 		authorized.Use(s.AuthMiddleware())
 	} else {
 		authorized.Use(s.NoAuthMiddleware())
 	}
+	authorized.Use(s.UserRateLimitMiddleware())
 
 	// env
-	authorized.POST("/:identity_token/environments", s.environmentCreate)
+	authorized.POST("/:identity_token/environments",
+		s.CreateConcurrencyMiddleware(), s.environmentCreate)
 	authorized.GET("/:identity_token/environments", s.environmentList)
 	authorized.GET("/:identity_token/environments/:name", s.environmentGet)
 	authorized.DELETE("/:identity_token/environments/:name", s.environmentRemove)
+	authorized.GET("/:identity_token/environments/:name/logs", s.environmentLogs)
+	authorized.POST("/:identity_token/environments/:name/exec", s.environmentExec)
+	authorized.GET("/:identity_token/clusters", s.clusterList)
 	// image
 	authorized.GET("/:identity_token/images/:name", s.imageGet)
 	authorized.GET("/:identity_token/images", s.imageList)
+	authorized.GET("/:identity_token/sessions", s.sessionList)
+}
+
+// Run serves the API and the admin routers until the context is done, then
+// shuts down the servers gracefully and stops the background workers.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if s.informerFactory != nil {
+		// The informers are stopped when the context is cancelled.
+		s.informerFactory.Start(ctx.Done())
+	}
+	electorDone := make(chan struct{})
+	if s.elector != nil {
+		go func() {
+			defer close(electorDone)
+			s.elector.Run(ctx)
+		}()
+	} else {
+		close(electorDone)
+	}
+	go s.watchHostKeys(ctx)
+
+	var listeners []servingListener
+	addrs := s.addrs
+	if len(addrs) == 0 {
+		addrs = []string{":8080"}
+	}
+	for _, addr := range addrs {
+		listeners = append(listeners, servingListener{
+			addr: addr, handler: s.Router, tlsConfig: s.tlsConfig})
+	}
+	if s.adminAddr != "" {
+		listeners = append(listeners, servingListener{
+			addr: s.adminAddr, handler: s.AdminRouter})
+	}
+
+	servers := make([]*http.Server, 0, len(listeners))
+	errCh := make(chan error, len(listeners))
+	for _, l := range listeners {
+		ln, err := listen(l.addr)
+		if err != nil {
+			shutdownServers(servers, s.timeouts.Shutdown.Duration)
+			return err
+		}
+		srv := s.newHTTPServer(l.handler, l.tlsConfig)
+		servers = append(servers, srv)
+		go func(l servingListener) {
+			logrus.WithFields(logrus.Fields{
+				"addr": l.addr,
+				"tls":  l.tlsConfig != nil,
+			}).Info("server listening")
+			if l.tlsConfig != nil {
+				// The certificate is given by the TLS config.
+				errCh <- srv.ServeTLS(ln, "", "")
+			} else {
+				errCh <- srv.Serve(ln)
+			}
+		}(l)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		logrus.Info("shutting down the server")
+	case err = <-errCh:
+		logrus.WithError(err).Error("server stopped unexpectedly, shutting down")
+	}
+	shutdownServers(servers, s.timeouts.Shutdown.Duration)
+	cancel()
+	// Wait for the background tasks to stop and the lease to be
+	// released before closing the database.
+	<-electorDone
+	if s.Storage != nil {
+		if err := s.Storage.Close(context.Background()); err != nil {
+			logrus.WithError(err).Warn("failed to close the database connection")
+		}
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
 }
 
-func (s *Server) Run() error {
-	return s.Router.Run()
+type servingListener struct {
+	addr      string
+	handler   http.Handler
+	tlsConfig *tls.Config
+}
+
+func (s *Server) newHTTPServer(handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: s.timeouts.ReadHeader.Duration,
+		ReadTimeout:       s.timeouts.Read.Duration,
+		WriteTimeout:      s.timeouts.Write.Duration,
+		IdleTimeout:       s.timeouts.Idle.Duration,
+	}
+}
+
+// shutdownServers stops accepting new connections, and waits for the
+// in-flight requests until the timeout.
+func shutdownServers(servers []*http.Server, timeout time.Duration) {
+	if timeout == 0 {
+		timeout = config.Default().Timeouts.Shutdown.Duration
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				logrus.WithError(err).Warn("failed to shutdown the server gracefully")
+				srv.Close()
+			}
+		}(srv)
+	}
+	wg.Wait()
+}
+
+// RegisterLeaderTask adds the background task, which runs on the leader
+// replica only. The context is cancelled when the leadership is lost or
+// the server is stopping. It must be called before Run.
+func (s *Server) RegisterLeaderTask(name string, run func(ctx context.Context)) {
+	if s.elector == nil {
+		s.elector = leader.New(s.Client, leader.Opt{})
+	}
+	s.elector.Register(name, run)
+}
+
+// SetEnvironmentConfig updates the config used to create the environments.
+// It is safe to call it when the server is running.
+func (s *Server) SetEnvironmentConfig(cfg config.EnvironmentConfig) {
+	s.environment.Store(cfg)
+}
+
+// EnvironmentConfig returns the current environment config, or the
+// default one if it is not set.
+func (s *Server) EnvironmentConfig() config.EnvironmentConfig {
+	if cfg, ok := s.environment.Load().(config.EnvironmentConfig); ok {
+		return cfg
+	}
+	return config.Default().Environment
+}
+
+// SetRuntime replaces the runtime of the environments, e.g. with the
+// fakes in the tests. It must be called before Run.
+func (s *Server) SetRuntime(r runtime.Runtime) {
+	s.runtime = r
+}
+
+// SetImageFetcher replaces the fetcher of the image metadata, e.g. with
+// image.Fake in the tests. It must be called before Run.
+func (s *Server) SetImageFetcher(f image.Fetcher) {
+	s.images = f
+}
+
+// SetAdminToken sets the bearer token of the admin API, which is open if
+// it is empty. It must be called before Run.
+func (s *Server) SetAdminToken(token string) {
+	s.adminToken = token
+}
+
+// fetchImageMetadata fetches the metadata of the image.
+func (s *Server) fetchImageMetadata(ctx context.Context, name string) (types.ImageMeta, error) {
+	if s.images == nil {
+		return image.New(config.RegistryConfig{}).FetchMetadata(ctx, name)
+	}
+	return s.images.FetchMetadata(ctx, name)
 }
@@ -0,0 +1,101 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tensorchord/envd-server/client"
+	k8sruntime "github.com/tensorchord/envd-server/pkg/runtime/kubernetes"
+)
+
+func TestRunGracefulShutdown(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	socket := filepath.Join(t.TempDir(), "envd-server.sock")
+	s := &Server{
+		Router:      gin.New(),
+		AdminRouter: gin.New(),
+		Client:      fake.NewSimpleClientset(),
+		addrs:       []string{"unix://" + socket},
+	}
+	s.runtime = k8sruntime.New(s.Client, nil, s.EnvironmentConfig)
+	s.BindHandlers(false)
+	started := make(chan struct{})
+	s.Router.GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- s.Run(ctx)
+	}()
+	// Wait for the socket to be created.
+	for i := 0; ; i++ {
+		if _, err := os.Stat(socket); err == nil {
+			break
+		} else if i > 100 {
+			t.Fatalf("Expected the socket %s to be created", socket)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cli, err := client.NewClientWithOpts(client.WithHost("unix://" + socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cli.Close()
+	if _, err := cli.EnvironmentList(context.Background(), "alice"); err != nil {
+		t.Errorf("Expected no error listing over the unix socket, got %v", err)
+	}
+
+	// The in-flight request should be served when the server is stopping.
+	httpClient := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}}
+	respCh := make(chan string, 1)
+	go func() {
+		resp, err := httpClient.Get("http://envd/slow")
+		if err != nil {
+			respCh <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		respCh <- string(body)
+	}()
+	<-started
+	cancel()
+
+	if body := <-respCh; body != "done" {
+		t.Errorf("Expected the in-flight request to finish, got %s", body)
+	}
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Errorf("Expected no error from Run, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected Run to return after the shutdown")
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,205 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/metrics"
+	"github.com/tensorchord/envd-server/pkg/query"
+)
+
+const (
+	defaultSessionListLimit = 100
+	maxSessionListLimit     = 1000
+
+	sessionReapInterval = 5 * time.Minute
+)
+
+// startSession records the session of the connection. The failure is only
+// logged, since it should not deny the connection.
+func (s *Server) startSession(c *gin.Context, connectionID, owner, env, addr string) {
+	if connectionID == "" {
+		return
+	}
+	// The request may be cancelled after containerssh gets the response.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Storage.StartSSHSession(ctx, query.StartSSHSessionParams{
+		ConnectionID:  connectionID,
+		OwnerToken:    owner,
+		Environment:   env,
+		SourceAddress: addr,
+	}); err != nil {
+		requestLogger(c).WithError(err).WithField("connection_id", connectionID).
+			Warn("failed to record the ssh session")
+		return
+	}
+	metrics.SSHSessionEventsTotal.WithLabelValues(types.SSHSessionEventConnect).Inc()
+}
+
+// reapIdleSessions ends the sessions idle for longer than the timeout
+// periodically. It runs on the leader replica.
+func (s *Server) reapIdleSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionReapInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.endIdleSessions(ctx)
+		}
+	}
+}
+
+func (s *Server) endIdleSessions(ctx context.Context) {
+	n, err := s.Storage.EndIdleSSHSessions(ctx, time.Now().Add(-s.ssh.SessionIdleTimeout.Duration))
+	if err != nil {
+		logrus.WithError(err).Warn("failed to end the idle ssh sessions")
+		return
+	}
+	if n > 0 {
+		logrus.WithField("sessions", n).Info("idle ssh sessions ended")
+	}
+}
+
+// OnSessionEvent tracks the SSH sessions with the events of the hook next
+// to containerssh. It is served by the admin server.
+func (s *Server) OnSessionEvent(c *gin.Context) {
+	var req types.SSHSessionEvent
+	if err := c.BindJSON(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	if req.ConnectionID == "" {
+		respondWithError(c, errdefs.InvalidParameter(errors.New("connection ID is required")))
+		return
+	}
+
+	var updated int64
+	var err error
+	switch req.Type {
+	case types.SSHSessionEventConnect:
+		owner, name, err := s.sshTarget(req.Username)
+		if err != nil {
+			respondWithError(c, errdefs.InvalidParameter(err))
+			return
+		}
+		s.startSession(c, req.ConnectionID, owner, name, req.RemoteAddress)
+		c.Status(http.StatusNoContent)
+		return
+	case types.SSHSessionEventActivity:
+		updated, err = s.Storage.UpdateSSHSession(c, query.UpdateSSHSessionParams{
+			ConnectionID: req.ConnectionID,
+			BytesIn:      req.BytesIn,
+			BytesOut:     req.BytesOut,
+		})
+	case types.SSHSessionEventDisconnect:
+		updated, err = s.Storage.EndSSHSession(c, query.EndSSHSessionParams{
+			ConnectionID: req.ConnectionID,
+			BytesIn:      req.BytesIn,
+			BytesOut:     req.BytesOut,
+		})
+	default:
+		respondWithError(c, errdefs.InvalidParameter(
+			errors.Newf("unknown session event type %q", req.Type)))
+		return
+	}
+	if err != nil {
+		respondWithError(c, errors.Wrap(err, "failed to update the ssh session"))
+		return
+	}
+	if updated == 0 {
+		respondWithError(c, errdefs.NotFound(
+			errors.Newf("cannot find the active session of the connection %s", req.ConnectionID)))
+		return
+	}
+	metrics.SSHSessionEventsTotal.WithLabelValues(req.Type).Inc()
+	c.Status(http.StatusNoContent)
+}
+
+// @Summary     List the SSH sessions.
+// @Description List the SSH sessions of the user, newest first.
+// @Tags        session
+// @Accept      json
+// @Produce     json
+// @Param       identity_token path     string true  "identity token" example("a332139d39b89a241400013700e665a3")
+// @Param       environment    query    string false "environment name"
+// @Param       active         query    bool   false "only the connected sessions"
+// @Param       before         query    int    false "list the sessions before the ID"
+// @Param       limit          query    int    false "maximum number of the sessions"
+// @Success     200            {object} types.SSHSessionListResponse
+// @Failure     429            {object} types.ErrorResponse
+// @Router      /users/{identity_token}/sessions [get]
+func (s *Server) sessionList(c *gin.Context) {
+	var req types.SSHSessionListRequest
+	if err := c.BindQuery(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	req.Owner = c.GetString("identity_token")
+	s.listSessions(c, req)
+}
+
+// sessionListAll lists the sessions of all the users. It is served on the
+// admin router.
+func (s *Server) sessionListAll(c *gin.Context) {
+	var req types.SSHSessionListRequest
+	if err := c.BindQuery(&req); err != nil {
+		respondWithError(c, errdefs.InvalidParameter(err))
+		return
+	}
+	s.listSessions(c, req)
+}
+
+func (s *Server) listSessions(c *gin.Context, req types.SSHSessionListRequest) {
+	if req.Limit <= 0 {
+		req.Limit = defaultSessionListLimit
+	} else if req.Limit > maxSessionListLimit {
+		req.Limit = maxSessionListLimit
+	}
+	sessions, err := s.Storage.ListSSHSessions(c, query.ListSSHSessionsParams{
+		OwnerToken:  req.Owner,
+		Environment: req.Environment,
+		Active:      req.Active,
+		BeforeID:    req.Before,
+		MaxItems:    req.Limit,
+	})
+	if err != nil {
+		respondWithError(c, errors.Wrap(err, "failed to list the ssh sessions"))
+		return
+	}
+
+	res := types.SSHSessionListResponse{Items: []types.SSHSession{}}
+	for _, ss := range sessions {
+		item := types.SSHSession{
+			ID:             ss.ID,
+			ConnectionID:   ss.ConnectionID,
+			Owner:          ss.OwnerToken,
+			Environment:    ss.Environment,
+			SourceAddress:  ss.SourceAddress,
+			Active:         !ss.EndedAt.Valid,
+			StartedAt:      ss.StartedAt,
+			LastActivityAt: ss.LastActivityAt,
+			BytesIn:        ss.BytesIn,
+			BytesOut:       ss.BytesOut,
+		}
+		if ss.EndedAt.Valid {
+			endedAt := ss.EndedAt.Time
+			item.EndedAt = &endedAt
+		}
+		res.Items = append(res.Items, item)
+	}
+	c.JSON(http.StatusOK, res)
+}
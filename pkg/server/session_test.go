@@ -0,0 +1,196 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/storage/memory"
+	"github.com/tensorchord/envd-server/pkg/storage/postgres"
+)
+
+type testSession struct {
+	owner, env        string
+	bytesIn, bytesOut int64
+	ended             bool
+}
+
+// sessionDB keeps the sessions in memory for the session queries.
+type sessionDB struct {
+	sessions map[string]*testSession
+}
+
+func (db sessionDB) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	switch {
+	case strings.Contains(sql, "StartSSHSession"):
+		id := args[0].(string)
+		if _, ok := db.sessions[id]; !ok {
+			db.sessions[id] = &testSession{owner: args[1].(string), env: args[2].(string)}
+		}
+		return pgconn.CommandTag("INSERT 0 1"), nil
+	case strings.Contains(sql, "UpdateSSHSession"), strings.Contains(sql, "EndSSHSession"):
+		ss, ok := db.sessions[args[2].(string)]
+		if !ok || ss.ended {
+			return pgconn.CommandTag("UPDATE 0"), nil
+		}
+		ss.bytesIn, ss.bytesOut = args[0].(int64), args[1].(int64)
+		ss.ended = strings.Contains(sql, "EndSSHSession")
+		return pgconn.CommandTag("UPDATE 1"), nil
+	}
+	return nil, fmt.Errorf("unexpected query %s", sql)
+}
+
+func (db sessionDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, pgx.ErrNoRows
+}
+
+func (db sessionDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return nil
+}
+
+func TestOnSessionEvent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := sessionDB{sessions: map[string]*testSession{}}
+	s := &Server{Router: gin.New(), Storage: postgres.NewWithDB(db)}
+	s.Router.POST("/session", s.OnSessionEvent)
+
+	tcs := []struct {
+		event        types.SSHSessionEvent
+		expectedCode int
+	}{
+		{
+			event: types.SSHSessionEvent{Type: types.SSHSessionEventConnect, ConnectionID: "c1",
+				Username: "alice/mnist", RemoteAddress: "10.0.0.1"},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			event: types.SSHSessionEvent{Type: types.SSHSessionEventConnect, ConnectionID: "c2",
+				Username: "alice"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			event: types.SSHSessionEvent{Type: types.SSHSessionEventActivity, ConnectionID: "c1",
+				BytesIn: 10, BytesOut: 200},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			event:        types.SSHSessionEvent{Type: types.SSHSessionEventActivity, ConnectionID: "c3"},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			event: types.SSHSessionEvent{Type: types.SSHSessionEventDisconnect, ConnectionID: "c1",
+				BytesIn: 20, BytesOut: 400},
+			expectedCode: http.StatusNoContent,
+		},
+		{
+			// The session is ended already.
+			event:        types.SSHSessionEvent{Type: types.SSHSessionEventDisconnect, ConnectionID: "c1"},
+			expectedCode: http.StatusNotFound,
+		},
+		{
+			event:        types.SSHSessionEvent{Type: "exec", ConnectionID: "c1"},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			event:        types.SSHSessionEvent{Type: types.SSHSessionEventActivity},
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+	for i, tc := range tcs {
+		body, _ := json.Marshal(tc.event)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/session", bytes.NewReader(body)))
+		if w.Code != tc.expectedCode {
+			t.Errorf("Expected status %d in case %d, got %d: %s", tc.expectedCode, i, w.Code, w.Body)
+		}
+	}
+
+	ss := db.sessions["c1"]
+	if ss == nil || ss.owner != "alice" || ss.env != "mnist" || !ss.ended ||
+		ss.bytesIn != 20 || ss.bytesOut != 400 {
+		t.Errorf("Expected the ended session of alice/mnist with 20/400 bytes, got %+v", ss)
+	}
+}
+
+func TestSessionEventAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	s := &Server{Router: gin.New(), AdminRouter: gin.New(), Storage: memory.New(),
+		adminToken: "admin-token"}
+	s.BindHandlers(false)
+	body, _ := json.Marshal(types.SSHSessionEvent{Type: types.SSHSessionEventConnect,
+		ConnectionID: "c1", Username: "alice/mnist"})
+
+	tcs := []struct {
+		router       *gin.Engine
+		path         string
+		token        string
+		expectedCode int
+	}{
+		// The events are not accepted by the API server.
+		{router: s.Router, path: "/v1/session", expectedCode: http.StatusNotFound},
+		{router: s.AdminRouter, path: "/session", expectedCode: http.StatusUnauthorized},
+		{router: s.AdminRouter, path: "/session", token: "alice", expectedCode: http.StatusUnauthorized},
+		{router: s.AdminRouter, path: "/session", token: "admin-token", expectedCode: http.StatusNoContent},
+	}
+	for i, tc := range tcs {
+		req := httptest.NewRequest(http.MethodPost, tc.path, bytes.NewReader(body))
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		w := httptest.NewRecorder()
+		tc.router.ServeHTTP(w, req)
+		if w.Code != tc.expectedCode {
+			t.Errorf("Expected status %d in case %d, got %d: %s", tc.expectedCode, i, w.Code, w.Body)
+		}
+	}
+
+	resp, err := s.Storage.ListSSHSessions(context.Background(), query.ListSSHSessionsParams{
+		OwnerToken: "alice", MaxItems: 10})
+	if err != nil || len(resp) != 1 {
+		t.Errorf("Expected only the authorized session recorded, got %+v, %v", resp, err)
+	}
+}
+
+func TestEndIdleSessions(t *testing.T) {
+	store := memory.New()
+	s := &Server{Storage: store}
+	if err := store.StartSSHSession(context.Background(), query.StartSSHSessionParams{
+		ConnectionID: "c1", OwnerToken: "alice", Environment: "mnist"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		timeout        time.Duration
+		expectedActive int
+	}{
+		{timeout: time.Hour, expectedActive: 1},
+		{timeout: 0, expectedActive: 0},
+	}
+	for _, tc := range tcs {
+		time.Sleep(time.Millisecond)
+		s.ssh.SessionIdleTimeout.Duration = tc.timeout
+		s.endIdleSessions(context.Background())
+		sessions, err := store.ListSSHSessions(context.Background(),
+			query.ListSSHSessionsParams{Active: true, MaxItems: 10})
+		if err != nil || len(sessions) != tc.expectedActive {
+			t.Errorf("Expected %d active sessions with the timeout %s, got %v, %v",
+				tc.expectedActive, tc.timeout, sessions, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/tensorchord/envd-server/pkg/config"
+)
+
+// sourceAddressOption restricts the client addresses of the certificate.
+// It is the only critical option supported, since the commands are not
+// run by envd-server.
+const sourceAddressOption = "source-address"
+
+// certAuthority authenticates the OpenSSH user certificates signed by the
+// trusted CAs, instead of the public keys registered by the users.
+type certAuthority struct {
+	keys []ssh.PublicKey
+	// principals maps the principals to the identity tokens.
+	principals map[string]string
+	clock      func() time.Time
+}
+
+// newCertAuthority loads the CA keys, and returns nil if the certificates
+// are disabled.
+func newCertAuthority(cfg config.SSHCertificateConfig) (*certAuthority, error) {
+	if cfg.TrustedCAKeysFile == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(cfg.TrustedCAKeysFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read the trusted CA keys %s", cfg.TrustedCAKeysFile)
+	}
+	a := &certAuthority{principals: cfg.Principals, clock: time.Now}
+	for len(bytes.TrimSpace(data)) > 0 {
+		key, _, _, rest, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse the trusted CA keys %s", cfg.TrustedCAKeysFile)
+		}
+		a.keys = append(a.keys, key)
+		data = rest
+	}
+	if len(a.keys) == 0 {
+		return nil, errors.Newf("no CA key in %s", cfg.TrustedCAKeysFile)
+	}
+	return a, nil
+}
+
+func (a *certAuthority) isAuthority(key ssh.PublicKey) bool {
+	for _, k := range a.keys {
+		if bytes.Equal(k.Marshal(), key.Marshal()) {
+			return true
+		}
+	}
+	return false
+}
+
+// principalOf returns the principal of the certificate which is the
+// identity token of the owner.
+func (a *certAuthority) principalOf(owner string, cert *ssh.Certificate) string {
+	for _, p := range cert.ValidPrincipals {
+		token, ok := a.principals[p]
+		if !ok {
+			token = p
+		}
+		if token == owner {
+			return p
+		}
+	}
+	return ""
+}
+
+// authenticate checks that the certificate is signed by a trusted CA for
+// the owner, valid now and from the address. The error is the reason of
+// the denial.
+func (a *certAuthority) authenticate(owner string, cert *ssh.Certificate, addr net.IP) error {
+	if cert.CertType != ssh.UserCert {
+		return errors.New("not a user certificate")
+	}
+	if !a.isAuthority(cert.SignatureKey) {
+		return errors.New("certificate is not signed by a trusted CA")
+	}
+	// The certificate without principals is valid for all the users,
+	// which is not allowed.
+	principal := a.principalOf(owner, cert)
+	if principal == "" {
+		return errors.Newf("no principal of %s in the certificate %q", owner, cert.KeyId)
+	}
+	checker := ssh.CertChecker{Clock: a.clock}
+	if err := checker.CheckCert(principal, cert); err != nil {
+		return err
+	}
+	if src, ok := cert.CriticalOptions[sourceAddressOption]; ok {
+		return checkSourceAddress(addr, src)
+	}
+	return nil
+}
+
+// checkSourceAddress checks the address against the comma-separated list
+// of addresses and CIDRs in the source-address option.
+func checkSourceAddress(addr net.IP, sourceAddrs string) error {
+	if addr == nil {
+		return errors.New("source-address is required but the client address is unknown")
+	}
+	for _, s := range strings.Split(sourceAddrs, ",") {
+		if allowed := net.ParseIP(s); allowed != nil {
+			if allowed.Equal(addr) {
+				return nil
+			}
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return errors.Newf("invalid source-address %q in the certificate", s)
+		}
+		if ipNet.Contains(addr) {
+			return nil
+		}
+	}
+	return errors.Newf("client address %s is not in the source-address %s", addr, sourceAddrs)
+}
@@ -0,0 +1,169 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.containerssh.io/libcontainerssh/auth"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/tensorchord/envd-server/pkg/config"
+)
+
+func newTestSigner(t *testing.T) ssh.Signer {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func TestCertAuthority(t *testing.T) {
+	ca, otherCA, user := newTestSigner(t), newTestSigner(t), newTestSigner(t)
+	caFile := filepath.Join(t.TempDir(), "trusted_ca_keys")
+	if err := os.WriteFile(caFile, append([]byte("# company CA\n"),
+		ssh.MarshalAuthorizedKey(ca.PublicKey())...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newCertAuthority(config.SSHCertificateConfig{
+		TrustedCAKeysFile: caFile,
+		Principals:        map[string]string{"bob": "a332139d39b89a24"},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error loading the CA keys, got %v", err)
+	}
+	now := time.Now()
+	a.clock = func() time.Time { return now }
+
+	tcs := []struct {
+		modify      func(*ssh.Certificate)
+		signer      ssh.Signer
+		owner       string
+		addr        string
+		expectedErr bool
+	}{
+		{owner: "alice"},
+		{owner: "a332139d39b89a24", modify: func(c *ssh.Certificate) { c.ValidPrincipals = []string{"bob"} }},
+		{owner: "bob", modify: func(c *ssh.Certificate) { c.ValidPrincipals = []string{"alice"} }, expectedErr: true},
+		{owner: "alice", modify: func(c *ssh.Certificate) { c.ValidPrincipals = nil }, expectedErr: true},
+		{owner: "alice", signer: otherCA, expectedErr: true},
+		{owner: "alice", modify: func(c *ssh.Certificate) { c.CertType = ssh.HostCert }, expectedErr: true},
+		{
+			owner:       "alice",
+			modify:      func(c *ssh.Certificate) { c.ValidBefore = uint64(now.Add(-time.Minute).Unix()) },
+			expectedErr: true,
+		},
+		{
+			owner:       "alice",
+			modify:      func(c *ssh.Certificate) { c.ValidAfter = uint64(now.Add(time.Minute).Unix()) },
+			expectedErr: true,
+		},
+		{
+			owner:       "alice",
+			modify:      func(c *ssh.Certificate) { c.CriticalOptions = map[string]string{"force-command": "ls"} },
+			expectedErr: true,
+		},
+		{
+			owner: "alice",
+			addr:  "10.0.1.5",
+			modify: func(c *ssh.Certificate) {
+				c.CriticalOptions = map[string]string{sourceAddressOption: "192.168.0.1,10.0.0.0/16"}
+			},
+		},
+		{
+			owner: "alice",
+			addr:  "10.1.0.5",
+			modify: func(c *ssh.Certificate) {
+				c.CriticalOptions = map[string]string{sourceAddressOption: "192.168.0.1,10.0.0.0/16"}
+			},
+			expectedErr: true,
+		},
+	}
+	for i, tc := range tcs {
+		cert := &ssh.Certificate{
+			Key:             user.PublicKey(),
+			KeyId:           "alice@example.com",
+			CertType:        ssh.UserCert,
+			ValidPrincipals: []string{"alice"},
+			ValidAfter:      uint64(now.Add(-time.Minute).Unix()),
+			ValidBefore:     uint64(now.Add(time.Hour).Unix()),
+		}
+		if tc.modify != nil {
+			tc.modify(cert)
+		}
+		signer := tc.signer
+		if signer == nil {
+			signer = ca
+		}
+		if err := cert.SignCert(rand.Reader, signer); err != nil {
+			t.Fatal(err)
+		}
+		err := a.authenticate(tc.owner, cert, net.ParseIP(tc.addr))
+		if (err != nil) != tc.expectedErr {
+			t.Errorf("Expected error %v in case %d, got %v", tc.expectedErr, i, err)
+		}
+	}
+}
+
+func TestOnPubKeyCertificate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ca, user := newTestSigner(t), newTestSigner(t)
+	cert := &ssh.Certificate{
+		Key:             user.PublicKey(),
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"alice"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		authority *certAuthority
+		username  string
+		expected  bool
+	}{
+		// The user is not registered, the certificate is enough.
+		{authority: &certAuthority{keys: []ssh.PublicKey{ca.PublicKey()}, clock: time.Now},
+			username: "alice/mnist", expected: true},
+		{authority: &certAuthority{keys: []ssh.PublicKey{ca.PublicKey()}, clock: time.Now},
+			username: "bob/mnist", expected: false},
+		{authority: nil, username: "alice/mnist", expected: false},
+	}
+	for _, tc := range tcs {
+		s := &Server{Router: gin.New(), certAuthority: tc.authority}
+		s.Router.POST("/pubkey", s.OnPubKey)
+
+		var req auth.PublicKeyAuthRequest
+		req.Username = tc.username
+		req.PublicKey.PublicKey = string(ssh.MarshalAuthorizedKey(cert))
+		body, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		s.Router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/pubkey", bytes.NewReader(body)))
+		var res auth.ResponseBody
+		if err := json.Unmarshal(w.Body.Bytes(), &res); w.Code != http.StatusOK || err != nil {
+			t.Fatalf("Expected the auth response, got %d: %s", w.Code, w.Body)
+		}
+		if res.Success != tc.expected {
+			t.Errorf("Expected success %v for %s, got %v", tc.expected, tc.username, res.Success)
+		}
+	}
+}
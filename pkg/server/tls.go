@@ -0,0 +1,141 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+)
+
+// newTLSConfig creates the TLS config of the API server. The certificate
+// is reloaded when the files are modified, e.g. renewed by cert-manager.
+func newTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+		ClientAuth:     cfg.ClientAuthType(),
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read the client CA %s", cfg.ClientCAFile)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.Newf("no certificate found in the client CA %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// certReloader loads the certificate again if the files are modified
+// since the last load.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reloadIfModified(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if reloaded, err := r.reloadIfModified(); err != nil {
+		logrus.WithError(err).Warn("failed to reload the TLS certificate, keep the current one")
+	} else if reloaded {
+		logrus.WithField("cert", r.certFile).Info("TLS certificate reloaded")
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) reloadIfModified() (bool, error) {
+	modTime, err := latestModTime(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	modified := !modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if !modified {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to load the TLS certificate")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return true, nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var latest time.Time
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return latest, errors.Wrapf(err, "failed to stat %s", f)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// ClientCertMiddleware checks that the verified client certificate belongs
+// to the user in the path. The requests without client certificates are
+// left to the auth middleware.
+func (s *Server) ClientCertMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.TLS == nil || len(c.Request.TLS.VerifiedChains) == 0 {
+			c.Next()
+			return
+		}
+		cert := c.Request.TLS.VerifiedChains[0][0]
+		if user := s.userFromCertificate(cert); user != c.Param("identity_token") {
+			respondWithError(c, errdefs.Forbidden(errors.Newf(
+				"the client certificate %s does not belong to the user", cert.Subject)))
+			return
+		}
+		c.Next()
+	}
+}
+
+// userFromCertificate maps the subject of the certificate to the
+// identity token, or uses the common name if it is not mapped.
+func (s *Server) userFromCertificate(cert *x509.Certificate) string {
+	if user, ok := s.clientSubjects[cert.Subject.String()]; ok {
+		return user
+	}
+	return cert.Subject.CommonName
+}
@@ -0,0 +1,212 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tensorchord/envd-server/client"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+	k8sruntime "github.com/tensorchord/envd-server/pkg/runtime/kubernetes"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "envd-test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca := &testCA{cert: cert, key: key, dir: t.TempDir()}
+	ca.write(t, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+func (ca *testCA) write(t *testing.T, name, blockType string, der []byte) string {
+	path := filepath.Join(ca.dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// issue writes the certificate and the key signed by the CA, and returns
+// the paths of them.
+func (ca *testCA) issue(t *testing.T, name string, serial int64,
+	usage x509.ExtKeyUsage) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca.write(t, name+".pem", "CERTIFICATE", der),
+		ca.write(t, name+"-key.pem", "EC PRIVATE KEY", keyDer)
+}
+
+func TestTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ca := newTestCA(t)
+	certFile, keyFile := ca.issue(t, "server", 2, x509.ExtKeyUsageServerAuth)
+	caFile := filepath.Join(ca.dir, "ca.pem")
+
+	tlsConfig, err := newTLSConfig(config.TLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Router:         gin.New(),
+		AdminRouter:    gin.New(),
+		Client:         fake.NewSimpleClientset(),
+		clientSubjects: map[string]string{"CN=carol": "alice"},
+	}
+	s.runtime = k8sruntime.New(s.Client, nil, s.EnvironmentConfig)
+	s.BindHandlers(false)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: s.Router, TLSConfig: tlsConfig}
+	go func() {
+		_ = srv.ServeTLS(ln, "", "")
+	}()
+	defer srv.Close()
+	host := "tcp://" + ln.Addr().String()
+
+	tcs := []struct {
+		name        string
+		clientCert  string
+		owner       string
+		expectedErr func(error) bool
+	}{
+		{
+			name:       "matched common name",
+			clientCert: "alice",
+			owner:      "alice",
+		},
+		{
+			name:       "mapped subject",
+			clientCert: "carol",
+			owner:      "alice",
+		},
+		{
+			name:        "another user",
+			clientCert:  "alice",
+			owner:       "bob",
+			expectedErr: errdefs.IsForbidden,
+		},
+		{
+			name:        "no client certificate",
+			clientCert:  "",
+			owner:       "alice",
+			expectedErr: func(err error) bool { return err != nil },
+		},
+	}
+	for _, tc := range tcs {
+		var clientCertFile, clientKeyFile string
+		if tc.clientCert != "" {
+			clientCertFile, clientKeyFile = ca.issue(
+				t, tc.clientCert, 3, x509.ExtKeyUsageClientAuth)
+		}
+		cli, err := client.NewClientWithOpts(client.WithHost(host),
+			client.WithTLSClientConfig(caFile, clientCertFile, clientKeyFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = cli.EnvironmentList(context.Background(), tc.owner)
+		cli.Close()
+		switch {
+		case tc.expectedErr == nil && err != nil:
+			t.Errorf("Expected no error for %s, got %v", tc.name, err)
+		case tc.expectedErr != nil && !tc.expectedErr(err):
+			t.Errorf("Unexpected error for %s: %v", tc.name, err)
+		}
+	}
+
+	// Renew the server certificate, the new connections should use it.
+	ca.issue(t, "server", 4, x509.ExtKeyUsageServerAuth)
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(certFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	clientCertFile, clientKeyFile := ca.issue(t, "alice", 5, x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{clientCert},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if serial := conn.ConnectionState().PeerCertificates[0].SerialNumber; serial.Int64() != 4 {
+		t.Errorf("Expected the reloaded certificate with serial 4, got %v", serial)
+	}
+}
@@ -0,0 +1,74 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/cockroachdb/errors"
+	"github.com/gin-gonic/gin"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/api/types/versions"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/version"
+)
+
+// apiVersionPath matches the API version prefix of the request path.
+var apiVersionPath = regexp.MustCompile(`^/(v[0-9]+(?:\.[0-9]+)*)(?:/|$)`)
+
+// VersionMiddleware advertises the supported API versions in the response
+// headers, and rejects the requests of the unsupported API versions.
+func VersionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(types.HeaderAPIVersion, types.APIVersion)
+		c.Header(types.HeaderMinAPIVersion, types.MinAPIVersion)
+
+		m := apiVersionPath.FindStringSubmatch(c.Request.URL.Path)
+		if m == nil {
+			c.Next()
+			return
+		}
+		if err := checkAPIVersion(m[1]); err != nil {
+			respondWithError(c, err)
+			return
+		}
+		c.Next()
+	}
+}
+
+func checkAPIVersion(v string) error {
+	if versions.GreaterThan(v, types.APIVersion) {
+		return errdefs.InvalidParameter(errors.Newf(
+			"client version %s is too new. Maximum supported API version is %s",
+			v, types.APIVersion))
+	}
+	if versions.LessThan(v, types.MinAPIVersion) {
+		return errdefs.InvalidParameter(errors.Newf(
+			"client version %s is too old. Minimum supported API version is %s, please upgrade your client to a newer version",
+			v, types.MinAPIVersion))
+	}
+	return nil
+}
+
+// @Summary     Show the version of the server.
+// @Description Get the version of the server and the supported API versions.
+// @Tags        root
+// @Produce     json
+// @Success     200 {object} types.VersionResponse
+// @Router      /version [get]
+func (s *Server) handleVersion(c *gin.Context) {
+	v := version.GetVersion()
+	c.JSON(http.StatusOK, types.VersionResponse{
+		Version:       v.Version,
+		GitCommit:     v.GitCommit,
+		BuildDate:     v.BuildDate,
+		GoVersion:     v.GoVersion,
+		Platform:      v.Platform,
+		APIVersion:    types.APIVersion,
+		MinAPIVersion: types.MinAPIVersion,
+	})
+}
@@ -0,0 +1,52 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tensorchord/envd-server/api/types"
+)
+
+func TestVersionMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(VersionMiddleware())
+	router.GET("/version", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/v1/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tcs := []struct {
+		path     string
+		code     int
+		expected string
+	}{
+		{path: "/version", code: http.StatusOK},
+		{path: "/v1/", code: http.StatusOK},
+		{path: "/v2/users/alice/environments", code: http.StatusBadRequest, expected: "too new"},
+		{path: "/v0.9/", code: http.StatusBadRequest, expected: "too old"},
+		{path: "/v1.1", code: http.StatusBadRequest, expected: "too new"},
+		{path: "/v1/unknown", code: http.StatusNotFound},
+	}
+	for _, tc := range tcs {
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tc.code {
+			t.Errorf("Expected status %d for %s, got %d", tc.code, tc.path, w.Code)
+		}
+		if got := w.Header().Get(types.HeaderAPIVersion); got != types.APIVersion {
+			t.Errorf("Expected API version header %s for %s, got %s", types.APIVersion, tc.path, got)
+		}
+		if !strings.Contains(w.Body.String(), tc.expected) {
+			t.Errorf("Expected %q in the response of %s, got %s", tc.expected, tc.path, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,239 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package memory is the storage in memory for the tests, which behaves
+// as the database backends but is lost when the process exits.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/storage"
+)
+
+type Storage struct {
+	mu sync.Mutex
+	// The rows are kept in the order of the IDs.
+	users     []query.User
+	images    []query.ImageInfo
+	auditLogs []query.AuditLog
+	sessions  []query.SshSession
+	lastID    int64
+	closed    bool
+	// now returns the time of the rows.
+	now func() time.Time
+}
+
+var _ storage.Storage = &Storage{}
+
+func New() *Storage {
+	return &Storage{now: time.Now}
+}
+
+func (s *Storage) nextID() int64 {
+	s.lastID++
+	return s.lastID
+}
+
+func (s *Storage) Ping(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("the storage is closed")
+	}
+	return nil
+}
+
+func (s *Storage) Close(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *Storage) CreateUser(_ context.Context, arg query.CreateUserParams) (query.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := query.User{
+		ID:            s.nextID(),
+		IdentityToken: arg.IdentityToken,
+		PublicKey:     append([]byte(nil), arg.PublicKey...),
+	}
+	s.users = append(s.users, u)
+	return u, nil
+}
+
+func (s *Storage) GetUser(_ context.Context, identityToken string) (query.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, u := range s.users {
+		if u.IdentityToken == identityToken {
+			return u, nil
+		}
+	}
+	return query.User{}, errors.Wrapf(storage.ErrNotFound, "user %s", identityToken)
+}
+
+func (s *Storage) CreateImageInfo(_ context.Context, arg query.CreateImageInfoParams) (query.ImageInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := query.ImageInfo{
+		ID:         s.nextID(),
+		OwnerToken: arg.OwnerToken,
+		Name:       arg.Name,
+		Digest:     arg.Digest,
+		Created:    arg.Created,
+		Size:       arg.Size,
+		Labels:     arg.Labels,
+	}
+	i.Labels.Bytes = append([]byte(nil), arg.Labels.Bytes...)
+	s.images = append(s.images, i)
+	return i, nil
+}
+
+func (s *Storage) GetImageInfo(_ context.Context, arg query.GetImageInfoParams) (query.ImageInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, i := range s.images {
+		if i.OwnerToken == arg.OwnerToken && i.Name == arg.Name {
+			return i, nil
+		}
+	}
+	return query.ImageInfo{}, errors.Wrapf(storage.ErrNotFound, "image %s", arg.Name)
+}
+
+func (s *Storage) ListImageByOwner(_ context.Context, ownerToken string) ([]query.ImageInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []query.ImageInfo
+	for _, i := range s.images {
+		if i.OwnerToken == ownerToken {
+			items = append(items, i)
+		}
+	}
+	return items, nil
+}
+
+func (s *Storage) CreateAuditLog(_ context.Context, arg query.CreateAuditLogParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auditLogs = append(s.auditLogs, query.AuditLog{
+		ID:            s.nextID(),
+		CreatedAt:     s.now(),
+		RequestID:     arg.RequestID,
+		Actor:         arg.Actor,
+		Action:        arg.Action,
+		TargetType:    arg.TargetType,
+		Target:        arg.Target,
+		Outcome:       arg.Outcome,
+		Message:       arg.Message,
+		SourceAddress: arg.SourceAddress,
+	})
+	return nil
+}
+
+func (s *Storage) ListAuditLogs(_ context.Context, arg query.ListAuditLogsParams) ([]query.AuditLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []query.AuditLog
+	for i := len(s.auditLogs) - 1; i >= 0 && int32(len(items)) < arg.MaxItems; i-- {
+		l := s.auditLogs[i]
+		if (arg.Actor == "" || l.Actor == arg.Actor) &&
+			(arg.Action == "" || l.Action == arg.Action) &&
+			(arg.BeforeID == 0 || l.ID < arg.BeforeID) {
+			items = append(items, l)
+		}
+	}
+	return items, nil
+}
+
+func (s *Storage) StartSSHSession(_ context.Context, arg query.StartSSHSessionParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ss := range s.sessions {
+		if ss.ConnectionID == arg.ConnectionID {
+			return nil
+		}
+	}
+	now := s.now()
+	s.sessions = append(s.sessions, query.SshSession{
+		ID:             s.nextID(),
+		ConnectionID:   arg.ConnectionID,
+		OwnerToken:     arg.OwnerToken,
+		Environment:    arg.Environment,
+		SourceAddress:  arg.SourceAddress,
+		StartedAt:      now,
+		LastActivityAt: now,
+	})
+	return nil
+}
+
+func (s *Storage) UpdateSSHSession(_ context.Context, arg query.UpdateSSHSessionParams) (int64, error) {
+	return s.updateSSHSession(arg.ConnectionID, arg.BytesIn, arg.BytesOut, false), nil
+}
+
+func (s *Storage) EndSSHSession(_ context.Context, arg query.EndSSHSessionParams) (int64, error) {
+	return s.updateSSHSession(arg.ConnectionID, arg.BytesIn, arg.BytesOut, true), nil
+}
+
+// updateSSHSession updates the active session of the connection, and
+// returns the number of the sessions updated.
+func (s *Storage) updateSSHSession(connectionID string, bytesIn, bytesOut int64, end bool) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.sessions {
+		ss := &s.sessions[i]
+		if ss.ConnectionID != connectionID || ss.EndedAt.Valid {
+			continue
+		}
+		if bytesIn > ss.BytesIn {
+			ss.BytesIn = bytesIn
+		}
+		if bytesOut > ss.BytesOut {
+			ss.BytesOut = bytesOut
+		}
+		ss.LastActivityAt = s.now()
+		if end {
+			ss.EndedAt = sql.NullTime{Time: ss.LastActivityAt, Valid: true}
+		}
+		return 1
+	}
+	return 0
+}
+
+func (s *Storage) EndIdleSSHSessions(_ context.Context, idleSince time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for i := range s.sessions {
+		ss := &s.sessions[i]
+		if !ss.EndedAt.Valid && ss.LastActivityAt.Before(idleSince) {
+			ss.EndedAt = sql.NullTime{Time: ss.LastActivityAt, Valid: true}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Storage) ListSSHSessions(_ context.Context, arg query.ListSSHSessionsParams) ([]query.SshSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []query.SshSession
+	for i := len(s.sessions) - 1; i >= 0 && int32(len(items)) < arg.MaxItems; i-- {
+		ss := s.sessions[i]
+		if (arg.OwnerToken == "" || ss.OwnerToken == arg.OwnerToken) &&
+			(arg.Environment == "" || ss.Environment == arg.Environment) &&
+			(!arg.Active || !ss.EndedAt.Valid) &&
+			(arg.BeforeID == 0 || ss.ID < arg.BeforeID) {
+			items = append(items, ss)
+		}
+	}
+	return items, nil
+}
@@ -0,0 +1,23 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tensorchord/envd-server/pkg/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	s := New()
+	storagetest.Run(t, s)
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ping(context.Background()); err == nil {
+		t.Errorf("Expected the closed storage unreachable")
+	}
+}
@@ -0,0 +1,58 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package migrations has the schema of the storage backends. Each backend
+// has the same migrations in its dialect, named VERSION_NAME.sql, which
+// are applied in the order of the versions.
+package migrations
+
+import (
+	"embed"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cockroachdb/errors"
+)
+
+const (
+	Postgres = "postgres"
+	SQLite   = "sqlite"
+)
+
+//go:embed postgres/*.sql sqlite/*.sql
+var files embed.FS
+
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string
+}
+
+// Load returns the migrations of the dialect sorted by the versions.
+func Load(dialect string) ([]Migration, error) {
+	entries, err := fs.ReadDir(files, dialect)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unknown dialect %s", dialect)
+	}
+	migrations := make([]Migration, 0, len(entries))
+	for _, e := range entries {
+		version, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		v, err := strconv.ParseInt(version, 10, 64)
+		if !ok || err != nil || v <= 0 {
+			return nil, errors.Newf("invalid migration %s, must be VERSION_NAME.sql", e.Name())
+		}
+		sql, err := files.ReadFile(path.Join(dialect, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: v, Name: name, SQL: string(sql)})
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
@@ -0,0 +1,34 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package migrations
+
+import "testing"
+
+func TestSameMigrations(t *testing.T) {
+	postgres, err := Load(Postgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := Load(SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(postgres) == 0 || len(postgres) != len(sqlite) {
+		t.Fatalf("Expected the same migrations, got %d in postgres and %d in sqlite",
+			len(postgres), len(sqlite))
+	}
+	for i := range postgres {
+		if postgres[i].Version != sqlite[i].Version || postgres[i].Name != sqlite[i].Name {
+			t.Errorf("Expected the migration %d_%s in sqlite, got %d_%s", postgres[i].Version,
+				postgres[i].Name, sqlite[i].Version, sqlite[i].Name)
+		}
+		if i > 0 && postgres[i].Version == postgres[i-1].Version {
+			t.Errorf("Expected the unique versions, got %d twice", postgres[i].Version)
+		}
+	}
+	if _, err := Load("mysql"); err == nil {
+		t.Errorf("Expected the error of the unknown dialect")
+	}
+}
@@ -0,0 +1,51 @@
+-- Users
+CREATE TABLE IF NOT EXISTS users (
+  id BIGSERIAL PRIMARY KEY,
+  identity_token text NOT NULL,
+  public_key bytea NOT NULL
+);
+
+
+-- Image info
+CREATE TABLE IF NOT EXISTS image_info (
+  id BIGSERIAL PRIMARY KEY,
+  owner_token text NOT NULL,
+  name text NOT NULL,
+  digest text NOT NULL,
+  created bigint NOT NULL,
+  size bigint NOT NULL,
+  labels JSONB
+);
+
+-- Audit logs
+CREATE TABLE IF NOT EXISTS audit_logs (
+  id BIGSERIAL PRIMARY KEY,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  request_id text NOT NULL,
+  actor text NOT NULL,
+  action text NOT NULL,
+  target_type text NOT NULL,
+  target text NOT NULL,
+  outcome text NOT NULL,
+  message text NOT NULL,
+  source_address text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_actor_idx ON audit_logs (actor, id);
+
+-- SSH sessions, the environment is the image for the kubernetes backend
+CREATE TABLE IF NOT EXISTS ssh_sessions (
+  id BIGSERIAL PRIMARY KEY,
+  connection_id text NOT NULL UNIQUE,
+  owner_token text NOT NULL,
+  environment text NOT NULL,
+  source_address text NOT NULL,
+  started_at timestamptz NOT NULL DEFAULT now(),
+  last_activity_at timestamptz NOT NULL DEFAULT now(),
+  ended_at timestamptz,
+  bytes_in bigint NOT NULL DEFAULT 0,
+  bytes_out bigint NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS ssh_sessions_owner_idx ON ssh_sessions (owner_token, id);
+CREATE INDEX IF NOT EXISTS ssh_sessions_active_idx ON ssh_sessions (owner_token, environment) WHERE ended_at IS NULL;
@@ -0,0 +1,53 @@
+-- The times are unix microseconds, and the labels are JSON text.
+
+-- Users
+CREATE TABLE IF NOT EXISTS users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  identity_token text NOT NULL,
+  public_key blob NOT NULL
+);
+
+
+-- Image info
+CREATE TABLE IF NOT EXISTS image_info (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  owner_token text NOT NULL,
+  name text NOT NULL,
+  digest text NOT NULL,
+  created integer NOT NULL,
+  size integer NOT NULL,
+  labels text
+);
+
+-- Audit logs
+CREATE TABLE IF NOT EXISTS audit_logs (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  created_at integer NOT NULL,
+  request_id text NOT NULL,
+  actor text NOT NULL,
+  action text NOT NULL,
+  target_type text NOT NULL,
+  target text NOT NULL,
+  outcome text NOT NULL,
+  message text NOT NULL,
+  source_address text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_logs_actor_idx ON audit_logs (actor, id);
+
+-- SSH sessions, the environment is the image for the kubernetes backend
+CREATE TABLE IF NOT EXISTS ssh_sessions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  connection_id text NOT NULL UNIQUE,
+  owner_token text NOT NULL,
+  environment text NOT NULL,
+  source_address text NOT NULL,
+  started_at integer NOT NULL,
+  last_activity_at integer NOT NULL,
+  ended_at integer,
+  bytes_in integer NOT NULL DEFAULT 0,
+  bytes_out integer NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS ssh_sessions_owner_idx ON ssh_sessions (owner_token, id);
+CREATE INDEX IF NOT EXISTS ssh_sessions_active_idx ON ssh_sessions (owner_token, environment) WHERE ended_at IS NULL;
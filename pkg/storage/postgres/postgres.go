@@ -0,0 +1,143 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package postgres is the storage of the queries generated by sqlc.
+package postgres
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tensorchord/envd-server/pkg/metrics"
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/storage"
+	"github.com/tensorchord/envd-server/pkg/storage/migrations"
+	"github.com/tensorchord/envd-server/pkg/tracing"
+)
+
+type Storage struct {
+	*query.Queries
+	// pool is nil if the storage is created with a DBTX.
+	pool *pgxpool.Pool
+}
+
+var _ storage.Storage = &Storage{}
+
+// New connects to the database and applies the migrations. The queries
+// of the concurrent requests are served by the connections in the pool.
+func New(ctx context.Context, url string) (*Storage, error) {
+	pool, err := pgxpool.Connect(ctx, url)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to the database")
+	}
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, errors.Wrap(err, "failed to apply the migrations")
+	}
+	s := NewWithDB(tracing.NewTracedDB(metrics.NewInstrumentedDB(pool)))
+	s.pool = pool
+	return s, nil
+}
+
+// NewWithDB returns the storage of the DBTX without the migrations, e.g.
+// a fake of it in the tests.
+func NewWithDB(db query.DBTX) *Storage {
+	return &Storage{Queries: query.New(notFoundDB{db: db})}
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	if s.pool == nil {
+		return nil
+	}
+	return s.pool.Ping(ctx)
+}
+
+func (s *Storage) Close(context.Context) error {
+	if s.pool == nil {
+		return nil
+	}
+	s.pool.Close()
+	return nil
+}
+
+// migrate applies the migrations not in schema_migrations. The table is
+// locked so that the replicas apply each of them once.
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	ms, err := migrations.Load(migrations.Postgres)
+	if err != nil {
+		return err
+	}
+	if _, err := pool.Exec(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (version bigint PRIMARY KEY)`); err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if err := applyMigration(ctx, pool, m); err != nil {
+			return errors.Wrapf(err, "failed to apply migration %d_%s", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, pool *pgxpool.Pool, m migrations.Migration) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// It is a no-op after committed.
+	defer func() { _ = tx.Rollback(ctx) }()
+	if _, err := tx.Exec(ctx, `LOCK TABLE schema_migrations`); err != nil {
+		return err
+	}
+	var applied bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`,
+		m.Version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, m.Version); err != nil {
+		return err
+	}
+	logrus.WithField("migration", m.Name).Debugf("migration %d applied", m.Version)
+	return tx.Commit(ctx)
+}
+
+// notFoundDB marks pgx.ErrNoRows as storage.ErrNotFound.
+type notFoundDB struct {
+	db query.DBTX
+}
+
+func (n notFoundDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return n.db.Exec(ctx, sql, args...)
+}
+
+func (n notFoundDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	return n.db.Query(ctx, sql, args...)
+}
+
+func (n notFoundDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return notFoundRow{row: n.db.QueryRow(ctx, sql, args...)}
+}
+
+type notFoundRow struct {
+	row pgx.Row
+}
+
+func (r notFoundRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.Mark(err, storage.ErrNotFound)
+	}
+	return err
+}
@@ -0,0 +1,27 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/tensorchord/envd-server/pkg/storage/storagetest"
+)
+
+// TestStorage runs against the empty database of ENVD_SERVER_TEST_DBURL.
+func TestStorage(t *testing.T) {
+	url := os.Getenv("ENVD_SERVER_TEST_DBURL")
+	if url == "" {
+		t.Skip("ENVD_SERVER_TEST_DBURL is not set")
+	}
+	s, err := New(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(context.Background())
+	storagetest.Run(t, s)
+}
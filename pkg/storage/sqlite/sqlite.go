@@ -0,0 +1,358 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package sqlite is the storage in an embedded SQLite database, for the
+// single node and the development installs. It uses the pure Go driver
+// modernc.org/sqlite, which needs no cgo.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgtype"
+	"github.com/sirupsen/logrus"
+	_ "modernc.org/sqlite"
+
+	"github.com/tensorchord/envd-server/pkg/metrics"
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/storage"
+	"github.com/tensorchord/envd-server/pkg/storage/migrations"
+	"github.com/tensorchord/envd-server/pkg/util"
+)
+
+// DriverName is the name of the database/sql driver.
+const DriverName = "sqlite"
+
+type Storage struct {
+	db *sql.DB
+	// now returns the time of the rows, which is the database time in
+	// postgres.
+	now func() time.Time
+}
+
+var _ storage.Storage = &Storage{}
+
+// New opens the database file, which is created if it does not exist,
+// and applies the migrations.
+func New(ctx context.Context, path string) (*Storage, error) {
+	db, err := sql.Open(DriverName,
+		"file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open the database")
+	}
+	// SQLite has one writer, the writes wait for the others instead of
+	// failing with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	if err := migrate(ctx, db); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "failed to apply the migrations")
+	}
+	return &Storage{db: db, now: time.Now}, nil
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	ms, err := migrations.Load(migrations.SQLite)
+	if err != nil {
+		return err
+	}
+	if _, err := db.ExecContext(ctx,
+		`CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY)`); err != nil {
+		return err
+	}
+	for _, m := range ms {
+		if err := applyMigration(ctx, db, m); err != nil {
+			return errors.Wrapf(err, "failed to apply migration %d_%s", m.Version, m.Name)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migrations.Migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// It is a no-op after committed.
+	defer func() { _ = tx.Rollback() }()
+	var applied bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = ?)`,
+		m.Version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, m.SQL); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, m.Version); err != nil {
+		return err
+	}
+	logrus.WithField("migration", m.Name).Debugf("migration %d applied", m.Version)
+	return tx.Commit()
+}
+
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *Storage) Close(context.Context) error {
+	return s.db.Close()
+}
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (identity_token, public_key) VALUES (?, ?)
+RETURNING id, identity_token, public_key
+`
+
+func (s *Storage) CreateUser(ctx context.Context, arg query.CreateUserParams) (query.User, error) {
+	var u query.User
+	err := s.queryRow(ctx, createUser, arg.IdentityToken, arg.PublicKey).
+		Scan(&u.ID, &u.IdentityToken, &u.PublicKey)
+	return u, err
+}
+
+const getUser = `-- name: GetUser :one
+SELECT id, identity_token, public_key FROM users
+WHERE identity_token = ? LIMIT 1
+`
+
+func (s *Storage) GetUser(ctx context.Context, identityToken string) (query.User, error) {
+	var u query.User
+	err := s.queryRow(ctx, getUser, identityToken).Scan(&u.ID, &u.IdentityToken, &u.PublicKey)
+	return u, notFound(err)
+}
+
+const createImageInfo = `-- name: CreateImageInfo :one
+INSERT INTO image_info (owner_token, name, digest, created, size, labels) VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, owner_token, name, digest, created, size, labels
+`
+
+func (s *Storage) CreateImageInfo(ctx context.Context, arg query.CreateImageInfoParams) (query.ImageInfo, error) {
+	var labels interface{}
+	if arg.Labels.Status == pgtype.Present {
+		labels = string(arg.Labels.Bytes)
+	}
+	return scanImageInfo(s.queryRow(ctx, createImageInfo, arg.OwnerToken, arg.Name,
+		arg.Digest, arg.Created, arg.Size, labels))
+}
+
+const getImageInfo = `-- name: GetImageInfo :one
+SELECT id, owner_token, name, digest, created, size, labels FROM image_info
+WHERE owner_token = ? AND name = ? LIMIT 1
+`
+
+func (s *Storage) GetImageInfo(ctx context.Context, arg query.GetImageInfoParams) (query.ImageInfo, error) {
+	i, err := scanImageInfo(s.queryRow(ctx, getImageInfo, arg.OwnerToken, arg.Name))
+	return i, notFound(err)
+}
+
+const listImageByOwner = `-- name: ListImageByOwner :many
+SELECT id, owner_token, name, digest, created, size, labels FROM image_info
+WHERE owner_token = ?
+`
+
+func (s *Storage) ListImageByOwner(ctx context.Context, ownerToken string) ([]query.ImageInfo, error) {
+	rows, err := s.query(ctx, listImageByOwner, ownerToken)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []query.ImageInfo
+	for rows.Next() {
+		i, err := scanImageInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+const createAuditLog = `-- name: CreateAuditLog :exec
+INSERT INTO audit_logs (
+  created_at, request_id, actor, action, target_type, target, outcome, message, source_address
+) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+`
+
+func (s *Storage) CreateAuditLog(ctx context.Context, arg query.CreateAuditLogParams) error {
+	_, err := s.exec(ctx, createAuditLog, s.now().UnixMicro(), arg.RequestID, arg.Actor,
+		arg.Action, arg.TargetType, arg.Target, arg.Outcome, arg.Message, arg.SourceAddress)
+	return err
+}
+
+const listAuditLogs = `-- name: ListAuditLogs :many
+SELECT id, created_at, request_id, actor, action, target_type, target, outcome, message, source_address FROM audit_logs
+WHERE (?1 = '' OR actor = ?1)
+  AND (?2 = '' OR action = ?2)
+  AND (?3 = 0 OR id < ?3)
+ORDER BY id DESC
+LIMIT ?4
+`
+
+func (s *Storage) ListAuditLogs(ctx context.Context, arg query.ListAuditLogsParams) ([]query.AuditLog, error) {
+	rows, err := s.query(ctx, listAuditLogs, arg.Actor, arg.Action, arg.BeforeID, arg.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []query.AuditLog
+	for rows.Next() {
+		var i query.AuditLog
+		var createdAt int64
+		if err := rows.Scan(&i.ID, &createdAt, &i.RequestID, &i.Actor, &i.Action, &i.TargetType,
+			&i.Target, &i.Outcome, &i.Message, &i.SourceAddress); err != nil {
+			return nil, err
+		}
+		i.CreatedAt = time.UnixMicro(createdAt)
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+const startSSHSession = `-- name: StartSSHSession :exec
+INSERT INTO ssh_sessions (
+  connection_id, owner_token, environment, source_address, started_at, last_activity_at
+) VALUES (?1, ?2, ?3, ?4, ?5, ?5)
+ON CONFLICT (connection_id) DO NOTHING
+`
+
+func (s *Storage) StartSSHSession(ctx context.Context, arg query.StartSSHSessionParams) error {
+	_, err := s.exec(ctx, startSSHSession, arg.ConnectionID, arg.OwnerToken,
+		arg.Environment, arg.SourceAddress, s.now().UnixMicro())
+	return err
+}
+
+const updateSSHSession = `-- name: UpdateSSHSession :execrows
+UPDATE ssh_sessions
+SET bytes_in = MAX(bytes_in, ?1),
+  bytes_out = MAX(bytes_out, ?2),
+  last_activity_at = ?4
+WHERE connection_id = ?3 AND ended_at IS NULL
+`
+
+func (s *Storage) UpdateSSHSession(ctx context.Context, arg query.UpdateSSHSessionParams) (int64, error) {
+	return s.execRows(ctx, updateSSHSession, arg.BytesIn, arg.BytesOut,
+		arg.ConnectionID, s.now().UnixMicro())
+}
+
+const endSSHSession = `-- name: EndSSHSession :execrows
+UPDATE ssh_sessions
+SET bytes_in = MAX(bytes_in, ?1),
+  bytes_out = MAX(bytes_out, ?2),
+  last_activity_at = ?4,
+  ended_at = ?4
+WHERE connection_id = ?3 AND ended_at IS NULL
+`
+
+func (s *Storage) EndSSHSession(ctx context.Context, arg query.EndSSHSessionParams) (int64, error) {
+	return s.execRows(ctx, endSSHSession, arg.BytesIn, arg.BytesOut,
+		arg.ConnectionID, s.now().UnixMicro())
+}
+
+const endIdleSSHSessions = `-- name: EndIdleSSHSessions :execrows
+UPDATE ssh_sessions
+SET ended_at = last_activity_at
+WHERE ended_at IS NULL AND last_activity_at < ?1
+`
+
+func (s *Storage) EndIdleSSHSessions(ctx context.Context, idleSince time.Time) (int64, error) {
+	return s.execRows(ctx, endIdleSSHSessions, idleSince.UnixMicro())
+}
+
+const listSSHSessions = `-- name: ListSSHSessions :many
+SELECT id, connection_id, owner_token, environment, source_address, started_at, last_activity_at, ended_at, bytes_in, bytes_out FROM ssh_sessions
+WHERE (?1 = '' OR owner_token = ?1)
+  AND (?2 = '' OR environment = ?2)
+  AND (NOT ?3 OR ended_at IS NULL)
+  AND (?4 = 0 OR id < ?4)
+ORDER BY id DESC
+LIMIT ?5
+`
+
+func (s *Storage) ListSSHSessions(ctx context.Context, arg query.ListSSHSessionsParams) ([]query.SshSession, error) {
+	rows, err := s.query(ctx, listSSHSessions, arg.OwnerToken, arg.Environment,
+		arg.Active, arg.BeforeID, arg.MaxItems)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []query.SshSession
+	for rows.Next() {
+		var i query.SshSession
+		var startedAt, lastActivityAt int64
+		var endedAt sql.NullInt64
+		if err := rows.Scan(&i.ID, &i.ConnectionID, &i.OwnerToken, &i.Environment, &i.SourceAddress,
+			&startedAt, &lastActivityAt, &endedAt, &i.BytesIn, &i.BytesOut); err != nil {
+			return nil, err
+		}
+		i.StartedAt = time.UnixMicro(startedAt)
+		i.LastActivityAt = time.UnixMicro(lastActivityAt)
+		if endedAt.Valid {
+			i.EndedAt = sql.NullTime{Time: time.UnixMicro(endedAt.Int64), Valid: true}
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanImageInfo(row scanner) (query.ImageInfo, error) {
+	var i query.ImageInfo
+	var labels sql.NullString
+	if err := row.Scan(&i.ID, &i.OwnerToken, &i.Name, &i.Digest,
+		&i.Created, &i.Size, &labels); err != nil {
+		return i, err
+	}
+	i.Labels = pgtype.JSONB{Status: pgtype.Null}
+	if labels.Valid {
+		i.Labels = pgtype.JSONB{Bytes: []byte(labels.String), Status: pgtype.Present}
+	}
+	return i, nil
+}
+
+// notFound marks sql.ErrNoRows as storage.ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return errors.Mark(err, storage.ErrNotFound)
+	}
+	return err
+}
+
+// The helpers record the latency of the queries like the instrumented
+// DBTX of postgres.
+
+func (s *Storage) exec(ctx context.Context, q string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(q, time.Now())
+	return s.db.ExecContext(ctx, q, args...)
+}
+
+func (s *Storage) execRows(ctx context.Context, q string, args ...interface{}) (int64, error) {
+	result, err := s.exec(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *Storage) query(ctx context.Context, q string, args ...interface{}) (*sql.Rows, error) {
+	defer observeQuery(q, time.Now())
+	return s.db.QueryContext(ctx, q, args...)
+}
+
+func (s *Storage) queryRow(ctx context.Context, q string, args ...interface{}) *sql.Row {
+	defer observeQuery(q, time.Now())
+	return s.db.QueryRowContext(ctx, q, args...)
+}
+
+func observeQuery(q string, start time.Time) {
+	metrics.DBQueryDuration.WithLabelValues(util.QueryName(q)).
+		Observe(time.Since(start).Seconds())
+}
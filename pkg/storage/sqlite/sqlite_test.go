@@ -0,0 +1,35 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/tensorchord/envd-server/pkg/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "envd-server.db")
+	s, err := New(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storagetest.Run(t, s)
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// The migrations are applied once.
+	s, err = New(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Expected the database opened again, got %v", err)
+	}
+	defer s.Close(context.Background())
+	if _, err := s.GetUser(context.Background(), "alice"); err != nil {
+		t.Errorf("Expected the user kept, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package storage is the persistence of the users, the images, the audit
+// logs and the SSH sessions, in postgres or an embedded SQLite, and in
+// memory for the tests.
+package storage
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/errors"
+
+	"github.com/tensorchord/envd-server/pkg/query"
+)
+
+// ErrNotFound is returned by the queries of one row if it does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Storage is used by the handlers. The rows are the models of the
+// queries generated by sqlc, which all the backends return.
+type Storage interface {
+	CreateUser(ctx context.Context, arg query.CreateUserParams) (query.User, error)
+	GetUser(ctx context.Context, identityToken string) (query.User, error)
+
+	CreateImageInfo(ctx context.Context, arg query.CreateImageInfoParams) (query.ImageInfo, error)
+	GetImageInfo(ctx context.Context, arg query.GetImageInfoParams) (query.ImageInfo, error)
+	ListImageByOwner(ctx context.Context, ownerToken string) ([]query.ImageInfo, error)
+
+	CreateAuditLog(ctx context.Context, arg query.CreateAuditLogParams) error
+	// ListAuditLogs returns the logs newest first.
+	ListAuditLogs(ctx context.Context, arg query.ListAuditLogsParams) ([]query.AuditLog, error)
+
+	// StartSSHSession ignores the connection started already.
+	StartSSHSession(ctx context.Context, arg query.StartSSHSessionParams) error
+	// UpdateSSHSession and EndSSHSession return the number of the active
+	// sessions updated, the bytes never decrease.
+	UpdateSSHSession(ctx context.Context, arg query.UpdateSSHSessionParams) (int64, error)
+	EndSSHSession(ctx context.Context, arg query.EndSSHSessionParams) (int64, error)
+	// EndIdleSSHSessions ends the active sessions without the activity
+	// since the time, at the last activity. It returns the number of
+	// them.
+	EndIdleSSHSessions(ctx context.Context, idleSince time.Time) (int64, error)
+	// ListSSHSessions returns the sessions newest first.
+	ListSSHSessions(ctx context.Context, arg query.ListSSHSessionsParams) ([]query.SshSession, error)
+
+	// Ping checks the connectivity for the health checks.
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
@@ -0,0 +1,196 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+// Package storagetest is the shared test suite of the storage backends.
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgtype"
+
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/storage"
+)
+
+// Run runs the suite against the storage, which must be empty.
+func Run(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	if err := s.Ping(ctx); err != nil {
+		t.Fatalf("Expected the storage reachable, got %v", err)
+	}
+
+	t.Run("users", func(t *testing.T) {
+		created, err := s.CreateUser(ctx, query.CreateUserParams{
+			IdentityToken: "alice", PublicKey: []byte("ssh-ed25519 AAAA")})
+		if err != nil {
+			t.Fatalf("Expected the user created, got %v", err)
+		}
+		u, err := s.GetUser(ctx, "alice")
+		if err != nil {
+			t.Fatalf("Expected the user, got %v", err)
+		}
+		if u.ID != created.ID || string(u.PublicKey) != "ssh-ed25519 AAAA" {
+			t.Errorf("Expected the user %+v, got %+v", created, u)
+		}
+		if _, err := s.GetUser(ctx, "nobody"); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Expected the not found error, got %v", err)
+		}
+	})
+
+	t.Run("images", func(t *testing.T) {
+		var labels pgtype.JSONB
+		if err := labels.Set(map[string]string{"ai.tensorchord.envd.ports": "[]"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.CreateImageInfo(ctx, query.CreateImageInfoParams{OwnerToken: "alice",
+			Name: "pytorch:dev", Digest: "sha256:1", Created: 1, Size: 2, Labels: labels}); err != nil {
+			t.Fatalf("Expected the image created, got %v", err)
+		}
+		i, err := s.GetImageInfo(ctx, query.GetImageInfoParams{OwnerToken: "alice", Name: "pytorch:dev"})
+		if err != nil {
+			t.Fatalf("Expected the image, got %v", err)
+		}
+		var got map[string]string
+		if err := i.Labels.AssignTo(&got); err != nil || got["ai.tensorchord.envd.ports"] != "[]" {
+			t.Errorf("Expected the labels kept, got %v, %v", got, err)
+		}
+		if i.Digest != "sha256:1" || i.Created != 1 || i.Size != 2 {
+			t.Errorf("Expected the image info kept, got %+v", i)
+		}
+		if _, err := s.GetImageInfo(ctx, query.GetImageInfoParams{
+			OwnerToken: "bob", Name: "pytorch:dev"}); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("Expected the not found error of the other owner, got %v", err)
+		}
+		tcs := []struct {
+			owner    string
+			expected int
+		}{
+			{owner: "alice", expected: 1},
+			{owner: "bob", expected: 0},
+		}
+		for _, tc := range tcs {
+			images, err := s.ListImageByOwner(ctx, tc.owner)
+			if err != nil || len(images) != tc.expected {
+				t.Errorf("Expected %d images of %s, got %d, %v", tc.expected, tc.owner, len(images), err)
+			}
+		}
+	})
+
+	t.Run("audit", func(t *testing.T) {
+		for _, actor := range []string{"alice", "alice", "bob"} {
+			if err := s.CreateAuditLog(ctx, query.CreateAuditLogParams{
+				RequestID: "r", Actor: actor, Action: "environment.create", TargetType: "environment",
+				Target: "mnist", Outcome: "success"}); err != nil {
+				t.Fatalf("Expected the audit log created, got %v", err)
+			}
+		}
+		all, err := s.ListAuditLogs(ctx, query.ListAuditLogsParams{MaxItems: 10})
+		if err != nil || len(all) != 3 {
+			t.Fatalf("Expected 3 audit logs, got %v, %v", all, err)
+		}
+		if all[0].Actor != "bob" || all[0].ID <= all[1].ID || all[0].CreatedAt.IsZero() {
+			t.Errorf("Expected the newest log first with the time, got %+v", all[0])
+		}
+		tcs := []struct {
+			params   query.ListAuditLogsParams
+			expected int
+		}{
+			{params: query.ListAuditLogsParams{Actor: "alice", MaxItems: 10}, expected: 2},
+			{params: query.ListAuditLogsParams{Action: "environment.remove", MaxItems: 10}, expected: 0},
+			{params: query.ListAuditLogsParams{BeforeID: all[0].ID, MaxItems: 10}, expected: 2},
+			{params: query.ListAuditLogsParams{MaxItems: 1}, expected: 1},
+		}
+		for _, tc := range tcs {
+			logs, err := s.ListAuditLogs(ctx, tc.params)
+			if err != nil || len(logs) != tc.expected {
+				t.Errorf("Expected %d audit logs of %+v, got %d, %v", tc.expected, tc.params, len(logs), err)
+			}
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		start := query.StartSSHSessionParams{ConnectionID: "c1", OwnerToken: "alice",
+			Environment: "mnist", SourceAddress: "10.0.0.1"}
+		for i := 0; i < 2; i++ {
+			if err := s.StartSSHSession(ctx, start); err != nil {
+				t.Fatalf("Expected the session started, got %v", err)
+			}
+		}
+		if n, err := s.UpdateSSHSession(ctx, query.UpdateSSHSessionParams{
+			ConnectionID: "c1", BytesIn: 10, BytesOut: 20}); err != nil || n != 1 {
+			t.Errorf("Expected the session updated, got %d, %v", n, err)
+		}
+		if n, err := s.EndSSHSession(ctx, query.EndSSHSessionParams{
+			ConnectionID: "c1", BytesIn: 5, BytesOut: 30}); err != nil || n != 1 {
+			t.Errorf("Expected the session ended, got %d, %v", n, err)
+		}
+		if n, err := s.UpdateSSHSession(ctx, query.UpdateSSHSessionParams{
+			ConnectionID: "c1", BytesIn: 50}); err != nil || n != 0 {
+			t.Errorf("Expected the ended session not updated, got %d, %v", n, err)
+		}
+
+		sessions, err := s.ListSSHSessions(ctx, query.ListSSHSessionsParams{MaxItems: 10})
+		if err != nil || len(sessions) != 1 {
+			t.Fatalf("Expected the session started once, got %v, %v", sessions, err)
+		}
+		ss := sessions[0]
+		if ss.BytesIn != 10 || ss.BytesOut != 30 {
+			t.Errorf("Expected the bytes never decrease, got %d and %d", ss.BytesIn, ss.BytesOut)
+		}
+		if !ss.EndedAt.Valid || ss.StartedAt.IsZero() || ss.EndedAt.Time.Before(ss.StartedAt) {
+			t.Errorf("Expected the session ended after started, got %+v", ss)
+		}
+
+		start.ConnectionID, start.Environment = "c2", "bert"
+		if err := s.StartSSHSession(ctx, start); err != nil {
+			t.Fatalf("Expected the session started, got %v", err)
+		}
+		tcs := []struct {
+			params   query.ListSSHSessionsParams
+			expected []string
+		}{
+			{params: query.ListSSHSessionsParams{MaxItems: 10}, expected: []string{"c2", "c1"}},
+			{params: query.ListSSHSessionsParams{Active: true, MaxItems: 10}, expected: []string{"c2"}},
+			{params: query.ListSSHSessionsParams{Environment: "mnist", MaxItems: 10}, expected: []string{"c1"}},
+			{params: query.ListSSHSessionsParams{OwnerToken: "bob", MaxItems: 10}, expected: nil},
+			{params: query.ListSSHSessionsParams{MaxItems: 1}, expected: []string{"c2"}},
+		}
+		for _, tc := range tcs {
+			sessions, err := s.ListSSHSessions(ctx, tc.params)
+			if err != nil {
+				t.Errorf("Expected the sessions of %+v, got %v", tc.params, err)
+				continue
+			}
+			var ids []string
+			for _, ss := range sessions {
+				ids = append(ids, ss.ConnectionID)
+			}
+			if len(ids) != len(tc.expected) {
+				t.Errorf("Expected the sessions %v of %+v, got %v", tc.expected, tc.params, ids)
+				continue
+			}
+			for i := range ids {
+				if ids[i] != tc.expected[i] {
+					t.Errorf("Expected the sessions %v of %+v, got %v", tc.expected, tc.params, ids)
+					break
+				}
+			}
+		}
+
+		if n, err := s.EndIdleSSHSessions(ctx, time.Now().Add(-time.Hour)); err != nil || n != 0 {
+			t.Errorf("Expected no idle sessions, got %d, %v", n, err)
+		}
+		if n, err := s.EndIdleSSHSessions(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+			t.Errorf("Expected the idle session ended, got %d, %v", n, err)
+		}
+		sessions, err = s.ListSSHSessions(ctx, query.ListSSHSessionsParams{Active: true, MaxItems: 10})
+		if err != nil || len(sessions) != 0 {
+			t.Errorf("Expected no active sessions, got %v, %v", sessions, err)
+		}
+	})
+}
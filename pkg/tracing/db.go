@@ -0,0 +1,88 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/util"
+)
+
+// TracedDB wraps a query.DBTX and starts a span for every query.
+type TracedDB struct {
+	db query.DBTX
+}
+
+func NewTracedDB(db query.DBTX) *TracedDB {
+	return &TracedDB{db: db}
+}
+
+func (t *TracedDB) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	ctx, span := startQuerySpan(ctx, sql)
+	tag, err := t.db.Exec(ctx, sql, args...)
+	End(span, err)
+	return tag, err
+}
+
+// Query ends the span when the rows are closed.
+func (t *TracedDB) Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	ctx, span := startQuerySpan(ctx, sql)
+	rows, err := t.db.Query(ctx, sql, args...)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	return &tracedRows{Rows: rows, span: span}, nil
+}
+
+// QueryRow ends the span when the row is scanned.
+func (t *TracedDB) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	ctx, span := startQuerySpan(ctx, sql)
+	return tracedRow{row: t.db.QueryRow(ctx, sql, args...), span: span}
+}
+
+type tracedRow struct {
+	row  pgx.Row
+	span trace.Span
+}
+
+func (r tracedRow) Scan(dest ...interface{}) error {
+	err := r.row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		// No rows is the result of the query instead of a failure.
+		r.span.End()
+	} else {
+		End(r.span, err)
+	}
+	return err
+}
+
+type tracedRows struct {
+	pgx.Rows
+	span trace.Span
+}
+
+func (r *tracedRows) Close() {
+	r.Rows.Close()
+	End(r.span, r.Rows.Err())
+}
+
+func startQuerySpan(ctx context.Context, sql string) (context.Context, trace.Span) {
+	name := util.QueryName(sql)
+	return Tracer().Start(ctx, "db."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperationKey.String(name),
+			semconv.DBStatementKey.String(sql),
+		))
+}
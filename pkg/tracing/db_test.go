@@ -0,0 +1,92 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type testDB struct {
+	err error
+}
+
+func (db testDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return nil, db.err
+}
+
+func (db testDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return &testRows{err: db.err}, nil
+}
+
+func (db testDB) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	return &testRows{err: db.err}
+}
+
+// testRows has no rows, and fails with the error if it is set.
+type testRows struct {
+	pgx.Rows
+	err error
+}
+
+func (r *testRows) Close()     {}
+func (r *testRows) Err() error { return r.err }
+func (r *testRows) Next() bool { return false }
+func (r *testRows) Scan(...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	return pgx.ErrNoRows
+}
+
+func TestTracedDB(t *testing.T) {
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+
+	tcs := []struct {
+		err            error
+		expectedStatus codes.Code
+	}{
+		{err: nil, expectedStatus: codes.Unset},
+		{err: pgx.ErrTxClosed, expectedStatus: codes.Error},
+	}
+	for _, tc := range tcs {
+		recorder := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+		db := NewTracedDB(testDB{err: tc.err})
+
+		row := db.QueryRow(context.Background(), "-- name: GetUser :one\nSELECT 1")
+		if n := len(recorder.Ended()); n != 0 {
+			t.Errorf("Expected the span of the row ended on scan, got %d ended spans", n)
+		}
+		row.Scan()
+		rows, err := db.Query(context.Background(), "-- name: ListImageByOwner :many\nSELECT 1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+		}
+		if n := len(recorder.Ended()); n != 1 {
+			t.Errorf("Expected the span of the rows ended on close, got %d ended spans", n)
+		}
+		rows.Close()
+
+		spans := recorder.Ended()
+		if len(spans) != 2 {
+			t.Fatalf("Expected 2 ended spans, got %d", len(spans))
+		}
+		for _, span := range spans {
+			if span.Status().Code != tc.expectedStatus {
+				t.Errorf("Expected status %v of %s, got %v", tc.expectedStatus, span.Name(), span.Status().Code)
+			}
+		}
+	}
+}
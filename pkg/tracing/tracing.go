@@ -0,0 +1,102 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/cockroachdb/errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/tensorchord/envd-server/pkg/version"
+)
+
+const (
+	ServiceName         = "envd-server"
+	instrumentationName = "github.com/tensorchord/envd-server"
+)
+
+type Opt struct {
+	// OTLPEndpoint is the address of the OTLP gRPC collector, e.g. localhost:4317.
+	// The exporter is disabled if it is empty.
+	OTLPEndpoint string
+	OTLPInsecure bool
+	// SampleRatio is the ratio of the root spans to sample.
+	SampleRatio float64
+}
+
+// Init sets up the global propagator, and the global tracer provider if the
+// exporter is configured. The returned function flushes the pending spans.
+func Init(ctx context.Context, opt Opt) (func(context.Context) error, error) {
+	// The incoming trace context is always propagated, even if the spans
+	// of envd-server are not exported.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	if opt.OTLPEndpoint == "" {
+		logrus.Debug("otlp endpoint is not set, tracing is disabled")
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOpts := []otlptracegrpc.Option{
+		otlptracegrpc.WithEndpoint(opt.OTLPEndpoint),
+	}
+	if opt.OTLPInsecure {
+		exporterOpts = append(exporterOpts, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the otlp exporter")
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(ServiceName),
+		semconv.ServiceVersionKey.String(version.GetVersion().String()),
+	))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create the tracing resource")
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(
+			sdktrace.TraceIDRatioBased(opt.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	logrus.WithField("endpoint", opt.OTLPEndpoint).Info("tracing is enabled")
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer of envd-server.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// WrapTransport traces the requests sent by the round tripper.
+// It is used to trace the Kubernetes API calls.
+func WrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(rt)
+}
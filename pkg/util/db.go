@@ -4,19 +4,17 @@
 
 package util
 
-import (
-	"context"
-	_ "embed"
+import "strings"
 
-	"github.com/jackc/pgx/v4"
-	"github.com/sirupsen/logrus"
-)
-
-//go:embed sql/schema.sql
-var schemaSql string
-
-func ApplySchema(conn *pgx.Conn) error {
-	tag, err := conn.Exec(context.Background(), schemaSql)
-	logrus.Debugf("apply schema result: %s", tag)
-	return err
+// QueryName extracts the name from the sqlc header, e.g. `-- name: GetUser :one`.
+func QueryName(sql string) string {
+	const prefix = "-- name: "
+	if !strings.HasPrefix(sql, prefix) {
+		return "unknown"
+	}
+	fields := strings.Fields(strings.TrimPrefix(sql, prefix))
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return fields[0]
 }
@@ -0,0 +1,36 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package util
+
+import "testing"
+
+func TestQueryName(t *testing.T) {
+	tcs := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			sql: `-- name: GetUser :one
+SELECT id, identity_token, public_key FROM users
+WHERE identity_token = $1 LIMIT 1
+`,
+			expected: "GetUser",
+		},
+		{
+			sql:      `SELECT 1`,
+			expected: "unknown",
+		},
+		{
+			sql:      `-- name: `,
+			expected: "unknown",
+		},
+	}
+
+	for _, tc := range tcs {
+		if name := QueryName(tc.sql); name != tc.expected {
+			t.Errorf("Expected query name %s, got %s", tc.expected, name)
+		}
+	}
+}
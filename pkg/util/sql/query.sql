@@ -33,4 +33,56 @@ INSERT INTO image_info (
 ) VALUES (
   $1, $2, $3, $4, $5, $6
 )
-RETURNING *;
\ No newline at end of file
+RETURNING *;
+
+-- name: CreateAuditLog :exec
+INSERT INTO audit_logs (
+  request_id, actor, action, target_type, target, outcome, message, source_address
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8
+);
+
+-- name: ListAuditLogs :many
+SELECT * FROM audit_logs
+WHERE (@actor::text = '' OR actor = @actor)
+  AND (@action::text = '' OR action = @action)
+  AND (@before_id::bigint = 0 OR id < @before_id)
+ORDER BY id DESC
+LIMIT @max_items;
+
+-- name: StartSSHSession :exec
+INSERT INTO ssh_sessions (
+  connection_id, owner_token, environment, source_address
+) VALUES (
+  $1, $2, $3, $4
+)
+ON CONFLICT (connection_id) DO NOTHING;
+
+-- name: UpdateSSHSession :execrows
+UPDATE ssh_sessions
+SET bytes_in = GREATEST(bytes_in, @bytes_in),
+  bytes_out = GREATEST(bytes_out, @bytes_out),
+  last_activity_at = now()
+WHERE connection_id = @connection_id AND ended_at IS NULL;
+
+-- name: EndSSHSession :execrows
+UPDATE ssh_sessions
+SET bytes_in = GREATEST(bytes_in, @bytes_in),
+  bytes_out = GREATEST(bytes_out, @bytes_out),
+  last_activity_at = now(),
+  ended_at = now()
+WHERE connection_id = @connection_id AND ended_at IS NULL;
+
+-- name: EndIdleSSHSessions :execrows
+UPDATE ssh_sessions
+SET ended_at = last_activity_at
+WHERE ended_at IS NULL AND last_activity_at < @idle_since;
+
+-- name: ListSSHSessions :many
+SELECT * FROM ssh_sessions
+WHERE (@owner_token::text = '' OR owner_token = @owner_token)
+  AND (@environment::text = '' OR environment = @environment)
+  AND (NOT @active::boolean OR ended_at IS NULL)
+  AND (@before_id::bigint = 0 OR id < @before_id)
+ORDER BY id DESC
+LIMIT @max_items;
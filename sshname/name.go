@@ -5,19 +5,203 @@
 package sshname
 
 import (
+	"errors"
 	"fmt"
+	"regexp"
 	"strings"
 )
 
+// Format is a format of the ssh username, which is named after its layout.
+type Format string
+
+const (
+	// FormatSlash is the default format, e.g. alice/mnist.
+	FormatSlash Format = "owner/env"
+	// FormatDot is used by the clients which do not accept the slash,
+	// e.g. mnist.alice. The environment cannot contain dots in it.
+	FormatDot Format = "env.owner"
+	// FormatAt is used by the clients which split the user at the last
+	// @, e.g. mnist@alice@envd-server.
+	FormatAt Format = "env@owner"
+)
+
+var (
+	// ErrUnknownFormat is returned if the username matches none of the
+	// formats.
+	ErrUnknownFormat = errors.New("unknown ssh username format")
+	// ErrAmbiguous is returned if the username matches more than one of
+	// the formats with different results.
+	ErrAmbiguous = errors.New("ambiguous ssh username")
+
+	// envNameRegexp is the name of the environment pods.
+	envNameRegexp = regexp.MustCompile(`^[a-z0-9]([-a-z0-9.]*[a-z0-9])?$`)
+)
+
+// separator returns the separator of the format, and whether the owner is
+// before it.
+func (f Format) separator() (string, bool) {
+	switch f {
+	case FormatSlash:
+		return "/", true
+	case FormatDot:
+		return ".", false
+	case FormatAt:
+		return "@", false
+	}
+	return "", false
+}
+
+// format returns the username of the owner and the environment.
+func (f Format) format(owner, env string) string {
+	sep, ownerFirst := f.separator()
+	if ownerFirst {
+		return owner + sep + env
+	}
+	return env + sep + owner
+}
+
+// parse splits the username at the first separator, and returns false if
+// the parts are not a valid owner and environment.
+func (f Format) parse(username string) (string, string, bool) {
+	sep, ownerFirst := f.separator()
+	first, second, ok := strings.Cut(username, sep)
+	if !ok {
+		return "", "", false
+	}
+	owner, env := second, first
+	if ownerFirst {
+		owner, env = first, second
+	}
+	return owner, env, validOwner(owner) && envNameRegexp.MatchString(env)
+}
+
+func validOwner(owner string) bool {
+	return owner != "" && !strings.Contains(owner, "/")
+}
+
+// Parser parses the ssh usernames in the formats of a deployment.
+type Parser struct {
+	// Formats are the accepted formats, the first one is used to format
+	// the usernames. It is FormatSlash if empty.
+	Formats []Format
+	// DefaultEnvironment is used if the username is only the owner. It is
+	// disabled if empty.
+	DefaultEnvironment string
+}
+
+// NewParser validates the formats and returns the parser.
+func NewParser(formats []string, defaultEnv string) (Parser, error) {
+	p := Parser{DefaultEnvironment: defaultEnv}
+	seen := make(map[Format]bool)
+	for _, f := range formats {
+		format := Format(f)
+		if sep, _ := format.separator(); sep == "" {
+			return p, fmt.Errorf("unknown ssh username format %q, must be one of %s, %s and %s",
+				f, FormatSlash, FormatDot, FormatAt)
+		}
+		if seen[format] {
+			return p, fmt.Errorf("duplicate ssh username format %q", f)
+		}
+		seen[format] = true
+		p.Formats = append(p.Formats, format)
+	}
+	if defaultEnv != "" && !envNameRegexp.MatchString(defaultEnv) {
+		return p, fmt.Errorf("invalid default environment %q", defaultEnv)
+	}
+	return p, nil
+}
+
+func (p Parser) formats() []Format {
+	if len(p.Formats) == 0 {
+		return []Format{FormatSlash}
+	}
+	return p.Formats
+}
+
+// Parse returns the owner and the environment of the username. The error
+// explains the accepted formats, since it is shown to the user.
+func (p Parser) Parse(username string) (string, string, error) {
+	type candidate struct {
+		owner, env string
+		format     Format
+	}
+	var candidates []candidate
+	hasSeparator := false
+	for _, f := range p.formats() {
+		if sep, _ := f.separator(); strings.Contains(username, sep) {
+			hasSeparator = true
+		}
+		owner, env, ok := f.parse(username)
+		if !ok {
+			continue
+		}
+		duplicate := false
+		for _, c := range candidates {
+			duplicate = duplicate || (c.owner == owner && c.env == env)
+		}
+		if !duplicate {
+			candidates = append(candidates, candidate{owner, env, f})
+		}
+	}
+
+	switch {
+	case len(candidates) == 1:
+		return candidates[0].owner, candidates[0].env, nil
+	case len(candidates) > 1:
+		msgs := make([]string, 0, len(candidates))
+		for _, c := range candidates {
+			msgs = append(msgs, fmt.Sprintf("environment %q of %q (%s)", c.env, c.owner, c.format))
+		}
+		return "", "", fmt.Errorf("%w %q, it may be %s", ErrAmbiguous, username,
+			strings.Join(msgs, " or "))
+	case !hasSeparator && p.DefaultEnvironment != "" && validOwner(username):
+		return username, p.DefaultEnvironment, nil
+	}
+	accepted := make([]string, 0, len(p.formats())+1)
+	for _, f := range p.formats() {
+		accepted = append(accepted, string(f))
+	}
+	if p.DefaultEnvironment != "" {
+		accepted = append(accepted, "owner")
+	}
+	return "", "", fmt.Errorf("%w %q, use one of %s", ErrUnknownFormat, username,
+		strings.Join(accepted, ", "))
+}
+
+// Username returns the username of the environment in the first format.
+// It fails if the username cannot be parsed back to the same owner and
+// environment.
+func (p Parser) Username(owner, env string) (string, error) {
+	username := p.formats()[0].format(owner, env)
+	parsedOwner, parsedEnv, err := p.Parse(username)
+	if err != nil {
+		return "", err
+	}
+	if parsedOwner != owner || parsedEnv != env {
+		return "", fmt.Errorf("environment %q of %q cannot be represented in the ssh username format %s",
+			env, owner, p.formats()[0])
+	}
+	return username, nil
+}
+
+// Username returns the username in the default format owner/env.
 func Username(owner, envName string) (string, error) {
 	return fmt.Sprintf("%s/%s", owner, envName), nil
 }
 
+// GetInfo returns the owner and the environment of the username in the
+// default format owner/env.
 func GetInfo(username string) (string, string, error) {
-	s := strings.Split(username, "/")
-	if len(s) != 2 {
+	return Parser{}.Parse(username)
+}
+
+// GetImage returns the owner and the image from the ssh username in the
+// format owner/image, where the image may contain slashes.
+func GetImage(username string) (string, string, error) {
+	owner, image, ok := strings.Cut(username, "/")
+	if !ok || owner == "" || image == "" {
 		return "", "",
-			fmt.Errorf("failed to get owner and environment name from the ssh username")
+			fmt.Errorf("failed to get owner and image from the ssh username")
 	}
-	return s[0], s[1], nil
+	return owner, image, nil
 }
@@ -0,0 +1,136 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package sshname
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tcs := []struct {
+		formats       []string
+		defaultEnv    string
+		username      string
+		expectedOwner string
+		expectedEnv   string
+		expectedErr   error
+	}{
+		{username: "alice/mnist", expectedOwner: "alice", expectedEnv: "mnist"},
+		{username: "alice/mnist/extra", expectedErr: ErrUnknownFormat},
+		{username: "mnist.alice", expectedErr: ErrUnknownFormat},
+		{username: "alice", expectedErr: ErrUnknownFormat},
+		{
+			formats:  []string{"env.owner"},
+			username: "mnist.alice", expectedOwner: "alice", expectedEnv: "mnist",
+		},
+		{
+			// The owner may contain dots, the environment may not.
+			formats:  []string{"env.owner"},
+			username: "mnist.alice.smith", expectedOwner: "alice.smith", expectedEnv: "mnist",
+		},
+		{
+			formats:  []string{"env@owner"},
+			username: "mnist.v2@alice", expectedOwner: "alice", expectedEnv: "mnist.v2",
+		},
+		{
+			formats:  []string{"owner/env", "env@owner"},
+			username: "alice/mnist", expectedOwner: "alice", expectedEnv: "mnist",
+		},
+		{
+			formats:  []string{"owner/env", "env@owner"},
+			username: "mnist@alice", expectedOwner: "alice", expectedEnv: "mnist",
+		},
+		{
+			formats:  []string{"env.owner", "env@owner"},
+			username: "mnist.alice@bob", expectedErr: ErrAmbiguous,
+		},
+		{
+			formats:  []string{"env.owner", "env@owner"},
+			username: "Mnist@alice", expectedErr: ErrUnknownFormat,
+		},
+		{
+			formats: []string{"owner/env"}, defaultEnv: "dev",
+			username: "alice", expectedOwner: "alice", expectedEnv: "dev",
+		},
+		{
+			// The default is not used if the username has a separator.
+			formats: []string{"owner/env"}, defaultEnv: "dev",
+			username: "alice/", expectedErr: ErrUnknownFormat,
+		},
+	}
+	for _, tc := range tcs {
+		p, err := NewParser(tc.formats, tc.defaultEnv)
+		if err != nil {
+			t.Fatalf("Expected no error creating the parser of %v, got %v", tc.formats, err)
+		}
+		owner, env, err := p.Parse(tc.username)
+		if tc.expectedErr != nil {
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected %v parsing %s in %v, got %v", tc.expectedErr, tc.username, tc.formats, err)
+			}
+			continue
+		}
+		if err != nil || owner != tc.expectedOwner || env != tc.expectedEnv {
+			t.Errorf("Expected %s/%s parsing %s in %v, got %s/%s, %v",
+				tc.expectedOwner, tc.expectedEnv, tc.username, tc.formats, owner, env, err)
+		}
+	}
+}
+
+func TestUsernameRoundTrip(t *testing.T) {
+	tcs := []struct {
+		owner       string
+		env         string
+		expectedErr map[Format]bool
+	}{
+		{owner: "alice", env: "mnist"},
+		{owner: "a332139d39b89a241400013700e665a3", env: "pytorch-example"},
+		{owner: "alice.smith", env: "mnist"},
+		{owner: "alice", env: "mnist.v2", expectedErr: map[Format]bool{FormatDot: true}},
+		{owner: "alice@example.com", env: "mnist", expectedErr: map[Format]bool{}},
+	}
+	for _, tc := range tcs {
+		for _, f := range []Format{FormatSlash, FormatDot, FormatAt} {
+			p := Parser{Formats: []Format{f}}
+			username, err := p.Username(tc.owner, tc.env)
+			if tc.expectedErr[f] {
+				if err == nil {
+					t.Errorf("Expected an error formatting %s/%s in %s, got %s", tc.owner, tc.env, f, username)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("Expected no error formatting %s/%s in %s, got %v", tc.owner, tc.env, f, err)
+				continue
+			}
+			owner, env, err := p.Parse(username)
+			if err != nil || owner != tc.owner || env != tc.env {
+				t.Errorf("Expected %s/%s parsing %s in %s, got %s/%s, %v",
+					tc.owner, tc.env, username, f, owner, env, err)
+			}
+		}
+	}
+}
+
+func TestNewParser(t *testing.T) {
+	tcs := []struct {
+		formats     []string
+		defaultEnv  string
+		expectedErr bool
+	}{
+		{formats: nil},
+		{formats: []string{"owner/env", "env.owner", "env@owner"}, defaultEnv: "dev"},
+		{formats: []string{"owner:env"}, expectedErr: true},
+		{formats: []string{"owner/env", "owner/env"}, expectedErr: true},
+		{formats: []string{"owner/env"}, defaultEnv: "Dev", expectedErr: true},
+	}
+	for _, tc := range tcs {
+		_, err := NewParser(tc.formats, tc.defaultEnv)
+		if (err != nil) != tc.expectedErr {
+			t.Errorf("Expected error %v creating the parser of %v, got %v", tc.expectedErr, tc.formats, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package api
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/client"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/test/util"
+)
+
+var _ = Describe("admin API", Ordered, func() {
+	var h *util.Harness
+	var admin *client.Client
+	BeforeAll(func() {
+		h = util.NewHarness(util.HarnessOpt{Auth: true, AdminToken: "admin-token"})
+		var err error
+		admin, err = h.NewAdminClient()
+		Expect(err).Should(BeNil())
+	})
+	AfterAll(func() {
+		h.Close()
+	})
+
+	It("should reject the requests without the admin token", func() {
+		for _, headers := range []map[string]string{
+			nil,
+			{"Authorization": "Bearer invalid"},
+			{"Authorization": "admin-token"},
+		} {
+			cli, err := client.NewClientWithOpts(client.WithHost(h.Admin.URL),
+				client.WithHTTPHeaders(headers))
+			Expect(err).Should(BeNil())
+			_, err = cli.AuditLogList(context.TODO(), types.AuditLogListRequest{})
+			Expect(errdefs.IsUnauthorized(err)).Should(BeTrue(), "got %v", err)
+			_, err = cli.HostKeyCreate(context.TODO())
+			Expect(errdefs.IsUnauthorized(err)).Should(BeTrue(), "got %v", err)
+		}
+	})
+
+	It("should audit the mutating requests", func() {
+		// The host keys in the secret are disabled in the harness.
+		_, err := admin.HostKeyCreate(context.TODO())
+		Expect(errdefs.IsUnavailable(err)).Should(BeTrue(), "got %v", err)
+
+		resp, err := admin.AuditLogList(context.TODO(), types.AuditLogListRequest{
+			Action: "hostkey.create",
+		})
+		Expect(err).Should(BeNil())
+		var records []string
+		for _, l := range resp.Items {
+			records = append(records, l.Actor+" "+l.Outcome)
+		}
+		// The rejected requests are audited without the actor.
+		Expect(records).Should(ConsistOf("admin "+types.AuditOutcomeError,
+			" "+types.AuditOutcomeFailure, " "+types.AuditOutcomeFailure, " "+types.AuditOutcomeFailure))
+	})
+
+	It("should audit the host key rotation with the key", func() {
+		_ = admin.HostKeyActivate(context.TODO(), "hostkey-1")
+		_ = admin.HostKeyRemove(context.TODO(), "hostkey-2", true)
+		_, _ = admin.HostKeyRoll(context.TODO(), 1)
+
+		resp, err := admin.AuditLogList(context.TODO(), types.AuditLogListRequest{Actor: "admin"})
+		Expect(err).Should(BeNil())
+		var records []string
+		for _, l := range resp.Items {
+			records = append(records, l.Action+" "+l.TargetType+" "+l.Target)
+		}
+		Expect(records).Should(ContainElements(
+			"hostkey.activate hostkey hostkey-1",
+			"hostkey.remove hostkey hostkey-2",
+			"hostkey.roll hostkey "))
+	})
+})
@@ -0,0 +1,53 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package api
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/google/uuid"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/test/util"
+)
+
+var _ = Describe("auth", Ordered, func() {
+	var h *util.Harness
+	BeforeAll(func() {
+		h = util.NewHarness(util.HarnessOpt{Auth: true})
+	})
+	AfterAll(func() {
+		h.Close()
+	})
+
+	It("should reject the unregistered users", func() {
+		cli, err := h.NewClient()
+		Expect(err).Should(BeNil())
+		_, err = cli.EnvironmentList(context.TODO(), uuid.New().String())
+		Expect(errdefs.IsUnauthorized(err)).Should(BeTrue(), "got %v", err)
+	})
+
+	It("should reject the invalid public key", func() {
+		cli, err := h.NewClient()
+		Expect(err).Should(BeNil())
+		_, err = cli.Auth(context.TODO(), types.AuthRequest{
+			IdentityToken: uuid.New().String(),
+			PublicKey:     "ssh-rsa invalid",
+		})
+		Expect(errdefs.IsInvalidParameter(err)).Should(BeTrue(), "got %v", err)
+	})
+
+	It("should accept the registered users", func() {
+		user, err := h.Login(context.TODO(), uuid.New().String())
+		Expect(err).Should(BeNil())
+		resp, err := user.Client.EnvironmentList(context.TODO(), user.IdentityToken)
+		Expect(err).Should(BeNil())
+		Expect(resp.Items).Should(BeEmpty())
+	})
+})
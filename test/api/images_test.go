@@ -0,0 +1,64 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package api
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/google/uuid"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/test/util"
+)
+
+var _ = Describe("images", Ordered, func() {
+	var h *util.Harness
+	var alice, bob *util.User
+	image := util.NewImage("mnist:dev", "mnist")
+	BeforeAll(func() {
+		h = util.NewHarness(util.HarnessOpt{Auth: true})
+		h.Registry.Push(image)
+		var err error
+		alice, err = h.Login(context.TODO(), uuid.New().String())
+		Expect(err).Should(BeNil())
+		bob, err = h.Login(context.TODO(), uuid.New().String())
+		Expect(err).Should(BeNil())
+		_, err = alice.Client.EnvironmentCreate(context.TODO(), alice.IdentityToken,
+			types.EnvironmentCreateRequest{Environment: types.Environment{
+				ObjectMeta: types.ObjectMeta{Name: "mnist"},
+				Spec:       types.EnvironmentSpec{Image: image.Name},
+			}})
+		Expect(err).Should(BeNil())
+	})
+	AfterAll(func() {
+		h.Close()
+	})
+
+	It("should list the images used by the user", func() {
+		resp, err := alice.Client.ImageList(context.TODO(), alice.IdentityToken)
+		Expect(err).Should(BeNil())
+		Expect(resp.Items).Should(HaveLen(1))
+		Expect(resp.Items[0].Digest).Should(Equal(image.Digest))
+
+		resp, err = bob.Client.ImageList(context.TODO(), bob.IdentityToken)
+		Expect(err).Should(BeNil())
+		Expect(resp.Items).Should(BeEmpty())
+	})
+
+	It("should get the image with the metadata from the registry", func() {
+		resp, err := alice.Client.ImageGet(context.TODO(), alice.IdentityToken, image.Name)
+		Expect(err).Should(BeNil())
+		Expect(resp.ImageMeta).Should(Equal(image))
+	})
+
+	It("should not get the image of the other users", func() {
+		_, err := bob.Client.ImageGet(context.TODO(), bob.IdentityToken, image.Name)
+		Expect(errdefs.IsNotFound(err)).Should(BeTrue(), "got %v", err)
+	})
+})
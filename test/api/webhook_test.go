@@ -0,0 +1,129 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.containerssh.io/libcontainerssh/auth"
+	sshconfig "go.containerssh.io/libcontainerssh/config"
+	"go.containerssh.io/libcontainerssh/metadata"
+
+	"github.com/google/uuid"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/test/util"
+)
+
+var _ = Describe("containerssh webhooks", Ordered, func() {
+	var h *util.Harness
+	var user *util.User
+	connectionID := uuid.New().String()
+	remoteAddress := metadata.RemoteAddress{IP: net.ParseIP("10.0.0.1"), Port: 2222}
+	BeforeAll(func() {
+		h = util.NewHarness(util.HarnessOpt{Auth: true, AdminToken: "admin-token"})
+		h.Registry.Push(util.NewImage("mnist:dev", "mnist"))
+		var err error
+		user, err = h.Login(context.TODO(), uuid.New().String())
+		Expect(err).Should(BeNil())
+		_, err = user.Client.EnvironmentCreate(context.TODO(), user.IdentityToken,
+			types.EnvironmentCreateRequest{Environment: types.Environment{
+				ObjectMeta: types.ObjectMeta{Name: "mnist"},
+				Spec:       types.EnvironmentSpec{Image: "mnist:dev"},
+			}})
+		Expect(err).Should(BeNil())
+	})
+	AfterAll(func() {
+		h.Close()
+	})
+
+	pubKeyRequest := func(key string) auth.PublicKeyAuthRequest {
+		var req auth.PublicKeyAuthRequest
+		req.Username = user.IdentityToken + "/mnist"
+		req.ConnectionID = connectionID
+		req.RemoteAddress = remoteAddress
+		req.PublicKey.PublicKey = key
+		return req
+	}
+
+	It("should authenticate the registered key", func() {
+		var res auth.ResponseBody
+		code, err := h.Webhook(context.TODO(), "/v1/pubkey", pubKeyRequest(user.PublicKey), &res)
+		Expect(err).Should(BeNil())
+		Expect(code).Should(Equal(http.StatusOK))
+		Expect(res.Success).Should(BeTrue())
+	})
+
+	It("should not authenticate the other keys", func() {
+		other, err := h.Login(context.TODO(), uuid.New().String())
+		Expect(err).Should(BeNil())
+		var res auth.ResponseBody
+		code, err := h.Webhook(context.TODO(), "/v1/pubkey", pubKeyRequest(other.PublicKey), &res)
+		Expect(err).Should(BeNil())
+		Expect(code).Should(Equal(http.StatusOK))
+		Expect(res.Success).Should(BeFalse())
+	})
+
+	It("should return the config of the environment", func() {
+		var req sshconfig.Request
+		req.Username = user.IdentityToken + "/mnist"
+		req.ConnectionID = connectionID
+		req.RemoteAddress = remoteAddress
+		var res sshconfig.ResponseBody
+		code, err := h.Webhook(context.TODO(), "/v1/config", req, &res)
+		Expect(err).Should(BeNil())
+		Expect(code).Should(Equal(http.StatusOK))
+		Expect(res.Config.Backend).Should(Equal("sshproxy"))
+		Expect(res.Config.SSHProxy.Server).Should(Equal("mnist"))
+	})
+
+	disconnect := types.SSHSessionEvent{
+		Type:         types.SSHSessionEventDisconnect,
+		ConnectionID: connectionID,
+		BytesIn:      10,
+		BytesOut:     20,
+	}
+
+	It("should not accept the session events without the admin token", func() {
+		code, err := h.Webhook(context.TODO(), "/v1/session", disconnect, nil)
+		Expect(err).Should(BeNil())
+		Expect(code).Should(Equal(http.StatusNotFound))
+		code, err = h.AdminWebhook(context.TODO(), "/session", "", disconnect, nil)
+		Expect(err).Should(BeNil())
+		Expect(code).Should(Equal(http.StatusUnauthorized))
+	})
+
+	It("should record the session", func() {
+		code, err := h.AdminWebhook(context.TODO(), "/session", "admin-token", disconnect, nil)
+		Expect(err).Should(BeNil())
+		Expect(code).Should(Equal(http.StatusNoContent))
+
+		resp, err := user.Client.SessionList(context.TODO(), user.IdentityToken,
+			types.SSHSessionListRequest{})
+		Expect(err).Should(BeNil())
+		Expect(resp.Items).Should(HaveLen(1))
+		Expect(resp.Items[0].Environment).Should(Equal("mnist"))
+		Expect(resp.Items[0].SourceAddress).Should(Equal("10.0.0.1"))
+		Expect(resp.Items[0].Active).Should(BeFalse())
+	})
+
+	It("should audit the requests", func() {
+		admin, err := h.NewAdminClient()
+		Expect(err).Should(BeNil())
+		resp, err := admin.AuditLogList(context.TODO(), types.AuditLogListRequest{
+			Actor: user.IdentityToken,
+		})
+		Expect(err).Should(BeNil())
+		var actions []string
+		for _, l := range resp.Items {
+			actions = append(actions, l.Action)
+		}
+		Expect(actions).Should(ContainElement("environment.create"))
+	})
+})
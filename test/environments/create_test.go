@@ -0,0 +1,145 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package environments
+
+import (
+	"context"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/cockroachdb/errors"
+	"github.com/google/uuid"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/errdefs"
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/image"
+	"github.com/tensorchord/envd-server/pkg/query"
+	"github.com/tensorchord/envd-server/pkg/storage/memory"
+	"github.com/tensorchord/envd-server/test/util"
+)
+
+var _ = Describe("environment lifecycle", Ordered, func() {
+	var h *util.Harness
+	var user *util.User
+	BeforeAll(func() {
+		h = util.NewHarness(util.HarnessOpt{Auth: true})
+		h.Registry.Push(util.NewImage("mnist:dev", "mnist"))
+		var err error
+		user, err = h.Login(context.TODO(), uuid.New().String())
+		Expect(err).Should(BeNil())
+	})
+	AfterAll(func() {
+		h.Close()
+	})
+
+	It("should create the environment from the image", func() {
+		resp, err := user.Client.EnvironmentCreate(context.TODO(), user.IdentityToken,
+			types.EnvironmentCreateRequest{Environment: types.Environment{
+				ObjectMeta: types.ObjectMeta{Name: "mnist"},
+				Spec:       types.EnvironmentSpec{Image: "mnist:dev"},
+			}})
+		Expect(err).Should(BeNil())
+		Expect(resp.Created.Name).Should(Equal("mnist"))
+		Expect(resp.Created.Spec.Ports).Should(ConsistOf(
+			types.EnvironmentPort{Name: "ssh", Port: 2222}))
+	})
+
+	It("should get the created environment", func() {
+		resp, err := user.Client.EnvironmentGet(context.TODO(), user.IdentityToken, "mnist")
+		Expect(err).Should(BeNil())
+		Expect(resp.Name).Should(Equal("mnist"))
+		Expect(resp.Spec.Image).Should(Equal("mnist:dev"))
+
+		l, err := user.Client.EnvironmentList(context.TODO(), user.IdentityToken)
+		Expect(err).Should(BeNil())
+		Expect(len(l.Items)).Should(Equal(1))
+	})
+
+	It("should reject the environment with the same name", func() {
+		_, err := user.Client.EnvironmentCreate(context.TODO(), user.IdentityToken,
+			types.EnvironmentCreateRequest{Environment: types.Environment{
+				ObjectMeta: types.ObjectMeta{Name: "mnist"},
+				Spec:       types.EnvironmentSpec{Image: "mnist:dev"},
+			}})
+		Expect(errdefs.IsConflict(err)).Should(BeTrue(), "got %v", err)
+	})
+
+	It("should not create the environment of an unknown image", func() {
+		_, err := user.Client.EnvironmentCreate(context.TODO(), user.IdentityToken,
+			types.EnvironmentCreateRequest{Environment: types.Environment{
+				ObjectMeta: types.ObjectMeta{Name: "bert"},
+				Spec:       types.EnvironmentSpec{Image: "bert:dev"},
+			}})
+		Expect(errdefs.IsNotFound(err)).Should(BeTrue(), "got %v", err)
+	})
+
+	It("should remove the environment", func() {
+		err := user.Client.EnvironmentRemove(context.TODO(), user.IdentityToken, "mnist")
+		Expect(err).Should(BeNil())
+		_, err = user.Client.EnvironmentGet(context.TODO(), user.IdentityToken, "mnist")
+		Expect(errdefs.IsNotFound(err)).Should(BeTrue(), "got %v", err)
+	})
+})
+
+var _ = Describe("environment create from the local image", func() {
+	It("should run the image by the name in the archive", func() {
+		h := util.NewHarness(util.HarnessOpt{Auth: true})
+		defer h.Close()
+		dir := GinkgoT().TempDir()
+		err := util.WriteDockerArchive(filepath.Join(dir, "mnist.tar"), util.NewImage("mnist:dev", "mnist"))
+		Expect(err).Should(BeNil())
+		h.Server.SetImageFetcher(image.New(config.RegistryConfig{LocalDir: dir}))
+		user, err := h.Login(context.TODO(), uuid.New().String())
+		Expect(err).Should(BeNil())
+
+		resp, err := user.Client.EnvironmentCreate(context.TODO(), user.IdentityToken,
+			types.EnvironmentCreateRequest{Environment: types.Environment{
+				ObjectMeta: types.ObjectMeta{Name: "mnist"},
+				Spec:       types.EnvironmentSpec{Image: "docker-archive:mnist.tar"},
+			}})
+		Expect(err).Should(BeNil())
+		Expect(resp.Created.Spec.Ports).Should(ConsistOf(
+			types.EnvironmentPort{Name: "ssh", Port: 2222}))
+
+		pods, err := h.Kubernetes.CoreV1().Pods("").List(context.TODO(), metav1.ListOptions{})
+		Expect(err).Should(BeNil())
+		Expect(pods.Items).Should(HaveLen(1))
+		Expect(pods.Items[0].Spec.Containers[0].Image).Should(Equal("docker.io/library/mnist:dev"))
+	})
+})
+
+// imageInfoFailure fails to save the image info.
+type imageInfoFailure struct {
+	*memory.Storage
+}
+
+func (imageInfoFailure) CreateImageInfo(context.Context, query.CreateImageInfoParams) (query.ImageInfo, error) {
+	return query.ImageInfo{}, errors.New("the database is down")
+}
+
+var _ = Describe("environment create with the database down", func() {
+	It("should not create the environment without the image info", func() {
+		h := util.NewHarness(util.HarnessOpt{Auth: true})
+		defer h.Close()
+		h.Server.Storage = imageInfoFailure{h.Storage}
+		h.Registry.Push(util.NewImage("mnist:dev", "mnist"))
+		user, err := h.Login(context.TODO(), uuid.New().String())
+		Expect(err).Should(BeNil())
+
+		_, err = user.Client.EnvironmentCreate(context.TODO(), user.IdentityToken,
+			types.EnvironmentCreateRequest{Environment: types.Environment{
+				ObjectMeta: types.ObjectMeta{Name: "mnist"},
+				Spec:       types.EnvironmentSpec{Image: "mnist:dev"},
+			}})
+		Expect(errdefs.IsSystem(err)).Should(BeTrue(), "got %v", err)
+		l, err := user.Client.EnvironmentList(context.TODO(), user.IdentityToken)
+		Expect(err).Should(BeNil())
+		Expect(l.Items).Should(BeEmpty())
+	})
+})
@@ -11,6 +11,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 
 	"github.com/google/uuid"
 
@@ -23,20 +24,22 @@ var _ = Describe("environments", Ordered, func() {
 	logger := logrus.WithField("test-case", "environment-list").
 		WithField("identity-token", identityToken)
 	logger.Debug("Running test cases")
-	// TODO(gaocegege): Add creation test case.
 	Describe("with newly created environments", func() {
-		logger.Debug(identityToken)
-		srv, err := util.NewServer(util.NewPod("test", identityToken))
-		Expect(err).Should(BeNil())
-		cli, err := client.NewClientWithOpts()
-		Expect(err).Should(BeNil())
-
-		go func() {
-			err := srv.Run()
+		var h *util.Harness
+		var cli *client.Client
+		BeforeAll(func() {
+			h = util.NewHarness(util.HarnessOpt{
+				Objects: []runtime.Object{util.NewPod("test", identityToken)},
+			})
+			var err error
+			cli, err = h.NewClient()
 			Expect(err).Should(BeNil())
-		}()
+		})
+		AfterAll(func() {
+			h.Close()
+		})
 		It("should get the newly created environments", func() {
-			l, err := srv.Client.CoreV1().Pods("default").List(context.TODO(), v1.ListOptions{})
+			l, err := h.Kubernetes.CoreV1().Pods("default").List(context.TODO(), v1.ListOptions{})
 			Expect(err).Should(BeNil())
 			logger.Debug(l)
 			resp, err := cli.EnvironmentList(context.TODO(), identityToken)
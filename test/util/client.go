@@ -0,0 +1,117 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package util
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/cockroachdb/errors"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/client"
+)
+
+// User is a user registered with /v1/auth.
+type User struct {
+	IdentityToken string
+	// PublicKey is the authorized key of the user, e.g. in the
+	// containerssh webhooks.
+	PublicKey string
+	Signer    ssh.Signer
+	Client    *client.Client
+}
+
+// NewClient returns the client of the API.
+func (h *Harness) NewClient() (*client.Client, error) {
+	return client.NewClientWithOpts(client.WithHost(h.API.URL))
+}
+
+// NewAdminClient returns the client of the admin API, with the admin
+// token of the harness.
+func (h *Harness) NewAdminClient() (*client.Client, error) {
+	opts := []client.Opt{client.WithHost(h.Admin.URL)}
+	if h.adminToken != "" {
+		opts = append(opts, client.WithHTTPHeaders(map[string]string{
+			"Authorization": "Bearer " + h.adminToken,
+		}))
+	}
+	return client.NewClientWithOpts(opts...)
+}
+
+// Login registers the user with a new key, and returns the client of it.
+func (h *Harness) Login(ctx context.Context, identityToken string) (*User, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := h.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	u := &User{
+		IdentityToken: identityToken,
+		PublicKey:     string(ssh.MarshalAuthorizedKey(signer.PublicKey())),
+		Signer:        signer,
+		Client:        cli,
+	}
+	if _, err := cli.Auth(ctx, types.AuthRequest{
+		IdentityToken: identityToken,
+		PublicKey:     u.PublicKey,
+	}); err != nil {
+		return nil, errors.Wrapf(err, "failed to register user %s", identityToken)
+	}
+	return u, nil
+}
+
+// Webhook posts the request to the containerssh webhook of the path,
+// e.g. /v1/pubkey, and decodes the response into res unless it is nil.
+// It returns the status code.
+func (h *Harness) Webhook(ctx context.Context, path string, req, res interface{}) (int, error) {
+	return post(ctx, h.API, path, "", req, res)
+}
+
+// AdminWebhook posts the request to the admin server, e.g. the session
+// events to /session, with the token as the bearer token if it is set.
+func (h *Harness) AdminWebhook(ctx context.Context, path, token string, req, res interface{}) (int, error) {
+	return post(ctx, h.Admin, path, token, req, res)
+}
+
+func post(ctx context.Context, srv *httptest.Server, path, token string,
+	req, res interface{}) (int, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return 0, err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(r)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if res != nil && resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+			return resp.StatusCode, errors.Wrap(err, "failed to decode the response")
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,85 @@
+// This Source Code Form is subject to the terms of the Mozilla Public
+// License, v. 2.0. If a copy of the MPL was not distributed with this
+// file, You can obtain one at https://mozilla.org/MPL/2.0/.
+
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tensorchord/envd-server/api/types"
+	"github.com/tensorchord/envd-server/pkg/consts"
+)
+
+// NewImage returns the metadata of the image built by envd, with the
+// ssh port and the project name in the labels.
+func NewImage(name, project string) types.ImageMeta {
+	return types.ImageMeta{
+		Name:    name,
+		Digest:  fmt.Sprintf("sha256:%064x", len(name)),
+		Created: 1665820800,
+		Size:    1 << 30,
+		Labels: map[string]string{
+			consts.ImageLabelPorts:         `[{"name": "ssh", "port": 2222}]`,
+			consts.ImageLabelContainerName: project,
+		},
+	}
+}
+
+// WriteDockerArchive writes the image of the metadata to the docker archive
+// of the path, with the name as the tag. The image has no files.
+func WriteDockerArchive(path string, meta types.ImageMeta) error {
+	var layer bytes.Buffer
+	if err := tar.NewWriter(&layer).Close(); err != nil {
+		return err
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"created":      time.Unix(meta.Created, 0).UTC(),
+		"architecture": "amd64",
+		"os":           "linux",
+		"config":       map[string]interface{}{"Labels": meta.Labels},
+		"rootfs": map[string]interface{}{
+			"type":     "layers",
+			"diff_ids": []string{fmt.Sprintf("sha256:%x", sha256.Sum256(layer.Bytes()))},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	manifest, err := json.Marshal([]map[string]interface{}{{
+		"Config":   "config.json",
+		"RepoTags": []string{meta.Name},
+		"Layers":   []string{"layer.tar"},
+	}})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	w := tar.NewWriter(&buf)
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{name: "manifest.json", data: manifest},
+		{name: "config.json", data: config},
+		{name: "layer.tar", data: layer.Bytes()},
+	} {
+		if err := w.WriteHeader(&tar.Header{Name: f.name, Mode: 0644, Size: int64(len(f.data))}); err != nil {
+			return err
+		}
+		if _, err := w.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
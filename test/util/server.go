@@ -5,31 +5,87 @@
 package util
 
 import (
+	"net/http/httptest"
+
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
-	ginlogrus "github.com/toorop/gin-logrus"
 	"k8s.io/apimachinery/pkg/runtime"
 	kubernetes "k8s.io/client-go/kubernetes/fake"
 
+	"github.com/tensorchord/envd-server/pkg/config"
+	"github.com/tensorchord/envd-server/pkg/image"
+	k8sruntime "github.com/tensorchord/envd-server/pkg/runtime/kubernetes"
 	"github.com/tensorchord/envd-server/pkg/server"
+	"github.com/tensorchord/envd-server/pkg/storage/memory"
 )
 
-func NewServer(objects ...runtime.Object) (*server.Server, error) {
-	cli := kubernetes.NewSimpleClientset(objects...)
+// Harness runs the server in memory, with the environments in the fake
+// clientset, the database in the memory storage and the images in the
+// fake fetcher. The API and the admin API are served on the local
+// addresses until Close.
+type Harness struct {
+	Server     *server.Server
+	Kubernetes *kubernetes.Clientset
+	Storage    *memory.Storage
+	Registry   *image.Fake
+	API        *httptest.Server
+	Admin      *httptest.Server
+
+	adminToken string
+}
+
+type HarnessOpt struct {
+	// Auth requires the users registered with /v1/auth, instead of
+	// trusting the identity token in the path.
+	Auth bool
+	// Objects are added to the fake clientset, e.g. the pods of NewPod.
+	Objects []runtime.Object
+	// AdminToken is required by the admin API if it is set.
+	AdminToken string
+}
+
+func NewHarness(opt HarnessOpt) *Harness {
+	h := &Harness{
+		adminToken: opt.AdminToken,
+		Kubernetes: kubernetes.NewSimpleClientset(opt.Objects...),
+		Storage:    memory.New(),
+		Registry:   image.NewFake(),
+	}
 
 	router := gin.New()
-	router.Use(ginlogrus.Logger(logrus.StandardLogger()))
+	router.Use(server.RequestIDMiddleware())
+	router.Use(server.LoggerMiddleware())
 	router.Use(gin.Recovery())
+	router.Use(server.VersionMiddleware())
 	if gin.Mode() == gin.DebugMode {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 	admin := gin.New()
+	// Trust no proxies like the server, it never fails without them.
+	_ = router.SetTrustedProxies(nil)
+	_ = admin.SetTrustedProxies(nil)
 	s := &server.Server{
 		Router:      router,
 		AdminRouter: admin,
-		Client:      cli,
+		Client:      h.Kubernetes,
+		Storage:     h.Storage,
 	}
+	s.SetEnvironmentConfig(config.Default().Environment)
+	s.SetRuntime(k8sruntime.New(h.Kubernetes, nil, s.EnvironmentConfig))
+	s.SetImageFetcher(h.Registry)
+	s.SetAdminToken(opt.AdminToken)
+	router.Use(s.AuditMiddleware())
+	admin.Use(s.AuditMiddleware())
+	s.BindHandlers(opt.Auth)
+
+	h.Server = s
+	h.API = httptest.NewServer(router)
+	h.Admin = httptest.NewServer(admin)
+	return h
+}
 
-	s.BindHandlers(false)
-	return s, nil
+// Close stops serving the API and the admin API.
+func (h *Harness) Close() {
+	h.API.Close()
+	h.Admin.Close()
 }